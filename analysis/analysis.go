@@ -0,0 +1,415 @@
+package analysis
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+/*
+診断の重大度
+*/
+type Severity int
+
+const (
+	Warning Severity = iota // 実行はできるが誤りの可能性が高い
+	Error                   // 実行すると必ずエラーになる
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+/*
+構文木の検査で見つかった問題
+*/
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Message  string
+}
+
+/*
+line:column: severity: message の形式の文字列
+*/
+func (d Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+/*
+診断にエラーが含まれているかどうか判定
+*/
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+評価の前に構文木を検査し、見つかった問題を位置の順に返す。
+未定義の識別子の参照はエラー、同じスコープでの再宣言とreturnの後の到達できない文は警告にする。
+predeclared には組み込み関数など、プログラムの外で定義された名前を渡す
+*/
+func Check(node ast.Node, predeclared ...string) []Diagnostic {
+	c := &checker{predeclared: make(map[string]bool, len(predeclared))}
+	for _, name := range predeclared {
+		c.predeclared[name] = true
+	}
+
+	if program, ok := node.(*ast.Program); ok {
+		c.openScope(program)
+		c.statements(program.Statements)
+		c.closeScope()
+	} else if node != nil {
+		c.openScope(node)
+		c.node(node)
+		c.closeScope()
+	}
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i].Pos, c.diagnostics[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+/*
+関数の本体やmatchの分岐に対応するスコープ。ifのブロックはスコープを作らない
+*/
+type scope struct {
+	outer    *scope
+	names    map[string]bool        // スコープ内のどこかで宣言される名前(宣言より前の参照も許す)
+	declared map[string]declaration // ここまでに宣言された名前
+}
+
+type declaration struct {
+	pos      token.Position
+	constant bool
+}
+
+type checker struct {
+	scope       *scope
+	predeclared map[string]bool
+	diagnostics []Diagnostic
+}
+
+/*
+新しいスコープを開き、nodes の中で宣言される名前を登録する。
+関数は実行時に呼ばれるまで本体を評価しないので、後で宣言される名前も参照できるものとして扱う
+*/
+func (c *checker) openScope(nodes ...ast.Node) {
+	c.scope = &scope{
+		outer:    c.scope,
+		names:    make(map[string]bool),
+		declared: make(map[string]declaration),
+	}
+	for _, node := range nodes {
+		c.hoist(node)
+	}
+}
+
+func (c *checker) closeScope() {
+	c.scope = c.scope.outer
+}
+
+/*
+node の中で現在のスコープに束縛される名前を集める。入れ子の関数とmatchの分岐の中は別のスコープなので除く
+*/
+func (c *checker) hoist(node ast.Node) {
+	root := node
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MatchArm:
+			return n == root
+		case *ast.LetStatement:
+			if n.Name != nil {
+				c.scope.names[n.Name.Value] = true
+			}
+			for _, ident := range patternIdentifiers(n.Pattern) {
+				c.scope.names[ident.Value] = true
+			}
+		case *ast.ConstStatement:
+			c.scope.names[n.Name.Value] = true
+		case *ast.FunctionStatement:
+			c.scope.names[n.Name.Value] = true
+		case *ast.ClassStatement:
+			c.scope.names[n.Name.Value] = true
+		}
+		return true
+	})
+}
+
+/*
+分割代入のlet文のパターンで束縛される識別子
+*/
+func patternIdentifiers(pattern ast.Expression) []*ast.Identifier {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		idents := append([]*ast.Identifier{}, pattern.Elements...)
+		if pattern.Rest != nil {
+			idents = append(idents, pattern.Rest)
+		}
+		return idents
+	case *ast.HashPattern:
+		return pattern.Keys
+	}
+	return nil
+}
+
+func (c *checker) report(pos token.Position, severity Severity, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Pos:      pos,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+/*
+文を順に検査する。returnの後に続く文は到達できないので、その最初の文で警告する
+*/
+func (c *checker) statements(stmts []ast.Statement) {
+	returned := false
+	for _, stmt := range stmts {
+		if returned {
+			c.report(stmt.Pos(), Warning, "unreachable code after return")
+			returned = false
+		}
+		c.node(stmt)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+/*
+現在のスコープに名前を宣言する。同じスコープで宣言済みの名前であれば報告する
+*/
+func (c *checker) declare(ident *ast.Identifier, constant bool) {
+	if prev, ok := c.scope.declared[ident.Value]; ok {
+		if prev.constant {
+			c.report(ident.Pos(), Error, "cannot redeclare constant: %s", ident.Value)
+		} else {
+			c.report(ident.Pos(), Warning, "%s is already declared in this scope at %s", ident.Value, prev.pos)
+		}
+	}
+	c.scope.names[ident.Value] = true
+	c.scope.declared[ident.Value] = declaration{pos: ident.Pos(), constant: constant}
+}
+
+/*
+識別子の参照を解決する。どのスコープにも組み込みの名前にもなければエラー
+*/
+func (c *checker) resolve(ident *ast.Identifier) {
+	for s := c.scope; s != nil; s = s.outer {
+		if s.names[ident.Value] {
+			return
+		}
+	}
+	if !c.predeclared[ident.Value] {
+		c.report(ident.Pos(), Error, "identifier not found: %s", ident.Value)
+	}
+}
+
+func (c *checker) expressions(exprs []ast.Expression) {
+	for _, expr := range exprs {
+		c.node(expr)
+	}
+}
+
+func (c *checker) node(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.LetStatement:
+		c.node(n.Value)
+		if n.Name != nil {
+			c.declare(n.Name, false)
+		}
+		for _, ident := range patternIdentifiers(n.Pattern) {
+			c.declare(ident, false)
+		}
+
+	case *ast.ConstStatement:
+		c.node(n.Value)
+		c.declare(n.Name, true)
+
+	case *ast.FunctionStatement:
+		c.declare(n.Name, false)
+		c.function(n.Function)
+
+	case *ast.ClassStatement:
+		c.declare(n.Name, false)
+		// コンストラクタとメソッドの中では self で生成中のインスタンスを参照できる
+		if n.Constructor != nil {
+			c.function(n.Constructor, "self")
+		}
+		for _, method := range n.Methods {
+			c.function(method.Function, "self")
+		}
+
+	case *ast.ReturnStatement:
+		c.node(n.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		c.node(n.Expression)
+
+	case *ast.BlockStatement:
+		c.statements(n.Statements)
+
+	case *ast.Identifier:
+		c.resolve(n)
+
+	case *ast.FunctionLiteral:
+		c.function(n)
+
+	case *ast.ArrayLiteral:
+		c.expressions(n.Elements)
+
+	case *ast.HashLiteral:
+		for _, key := range n.OrderedKeys() {
+			c.node(key)
+			c.node(n.Pairs[key])
+		}
+
+	case *ast.PrefixExpression:
+		c.node(n.Right)
+
+	case *ast.InfixExpression:
+		c.node(n.Left)
+		c.node(n.Right)
+
+	case *ast.IfExpression:
+		c.node(n.Condition)
+		c.branches(n.Consequence, n.Alternative)
+
+	case *ast.CallExpression:
+		c.node(n.Function)
+		c.expressions(n.Arguments)
+		// 名前付き引数の名前はパラメータ名なので参照ではない
+		for _, arg := range n.NamedArguments {
+			c.node(arg.Value)
+		}
+
+	case *ast.IndexExpression:
+		c.node(n.Left)
+		c.node(n.Index)
+
+	case *ast.MatchExpression:
+		c.node(n.Subject)
+		for _, arm := range n.Arms {
+			c.matchArm(arm)
+		}
+
+	case *ast.SpreadExpression:
+		c.node(n.Value)
+
+	case *ast.MemberExpression:
+		// プロパティ名は参照ではない
+		c.node(n.Object)
+
+	case *ast.SliceExpression:
+		c.node(n.Left)
+		c.node(n.Start)
+		c.node(n.End)
+
+	case *ast.YieldExpression:
+		c.node(n.Value)
+
+	case *ast.SpawnExpression:
+		c.node(n.Call)
+	}
+}
+
+/*
+ifの各分岐を検査する。一方の分岐での宣言は他方の分岐での再宣言として扱わない
+*/
+func (c *checker) branches(consequence, alternative *ast.BlockStatement) {
+	before := make(map[string]declaration, len(c.scope.declared))
+	for name, d := range c.scope.declared {
+		before[name] = d
+	}
+
+	c.node(consequence)
+	if alternative == nil {
+		return
+	}
+
+	afterConsequence := c.scope.declared
+	c.scope.declared = before
+	c.node(alternative)
+	for name, d := range afterConsequence {
+		if _, ok := c.scope.declared[name]; !ok {
+			c.scope.declared[name] = d
+		}
+	}
+}
+
+/*
+関数リテラルを新しいスコープで検査する。implicit には本体で暗黙に束縛される名前を渡す
+*/
+func (c *checker) function(fn *ast.FunctionLiteral, implicit ...string) {
+	c.openScope(fn)
+	defer c.closeScope()
+
+	for _, name := range implicit {
+		c.scope.names[name] = true
+	}
+	if fn.Name != nil {
+		c.scope.names[fn.Name.Value] = true
+	}
+	for _, param := range fn.Parameters {
+		c.scope.names[param.Value] = true
+	}
+	// デフォルト値は関数の環境で評価されるので、他のパラメータを参照できる
+	for _, param := range fn.Parameters {
+		c.node(fn.Defaults[param.Value])
+	}
+	c.node(fn.Body)
+}
+
+/*
+matchの分岐を検査する。パターン中の識別子は分岐のスコープに束縛し、
+ハッシュパターンのキーやリテラルなどの式はmatch式のスコープで参照する
+*/
+func (c *checker) matchArm(arm *ast.MatchArm) {
+	var bound []*ast.Identifier
+	c.pattern(arm.Pattern, &bound)
+
+	c.openScope(arm)
+	defer c.closeScope()
+	for _, ident := range bound {
+		c.scope.names[ident.Value] = true
+	}
+	c.node(arm.Body)
+}
+
+func (c *checker) pattern(pattern ast.Expression, bound *[]*ast.Identifier) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			*bound = append(*bound, pattern)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range pattern.Elements {
+			c.pattern(el, bound)
+		}
+	case *ast.HashLiteral:
+		for _, key := range pattern.OrderedKeys() {
+			c.node(key)
+			c.pattern(pattern.Pairs[key], bound)
+		}
+	default:
+		c.node(pattern)
+	}
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// 問題のないプログラム
+		{"let x = 1; puts(x);", nil},
+		{"let f = fn() { g() }; let g = fn() { f() };", nil},
+		{"fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) }", nil},
+		{"let add = fn(a, b = a) { a + b }; add(1, b: 2);", nil},
+		{"let [a, b, ...rest] = [1, 2, 3]; let {c} = {\"c\": 1}; a + b + c + len(rest);", nil},
+		{"match ([1, 2]) { case [x, _] { x } case other { other } }", nil},
+		{"class Point { let x = 1; fn norm() { self.x } }; Point().norm();", nil},
+		{"let c = fn() { if (true) { let y = 1 } else { let y = 2 }; y };", nil},
+
+		// 未定義の識別子
+		{"let x = 1; puts(y);", []string{"1:17: error: identifier not found: y"}},
+		{"let f = fn(a) { a + b };", []string{"1:21: error: identifier not found: b"}},
+		{"match (1) { case x { x } }; x", []string{"1:29: error: identifier not found: x"}},
+		{"fn f() { self }", []string{"1:10: error: identifier not found: self"}},
+		{"foo.bar(name: 1)", []string{"1:1: error: identifier not found: foo"}},
+
+		// 同じスコープでの再宣言
+		{"let x = 1; let x = 2;", []string{"1:16: warning: x is already declared in this scope at 1:5"}},
+		{"let x = 1; if (true) { let x = 2; }", []string{"1:28: warning: x is already declared in this scope at 1:5"}},
+		{"const x = 1; let x = 2;", []string{"1:18: error: cannot redeclare constant: x"}},
+		{"let x = 1; let f = fn() { let x = 2; x };", nil},
+
+		// returnの後の到達できない文
+		{"fn f() { return 1; puts(2); puts(3); }", []string{"1:20: warning: unreachable code after return"}},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		var got []string
+		for _, d := range Check(program, "puts", "len") {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("diagnostics for %q wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // ノードの先頭のトークンの位置
 }
 
 type Statement interface {
@@ -33,6 +34,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -45,13 +53,55 @@ func (p *Program) String() string {
 
 // let文
 type LetStatement struct {
-	Token token.Token // token.LET トークン
-	Name  *Identifier
-	Value Expression
+	Token   token.Token // token.LET トークン
+	Name    *Identifier
+	Pattern Expression // 分割代入の場合の束縛先（この場合Nameはnil）
+	Value   Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+
+// const文
+type ConstStatement struct {
+	Token token.Token // token.CONST トークン
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+/*
+関数宣言文。let name = fn(...) {...} と同じ意味になる
+*/
+type FunctionStatement struct {
+	Token    token.Token // 'fn' トークン
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *FunctionStatement) String() string       { return fs.Function.String() }
 
 // return文
 type ReturnStatement struct {
@@ -61,6 +111,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 
 // 式文
 type ExpressionStatement struct {
@@ -70,6 +121,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 
 /*
 ブロック文
@@ -81,6 +133,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -95,17 +148,41 @@ func (bs *BlockStatement) String() string {
 type Identifier struct {
 	Token token.Token // token.IDENT トークン
 	Value string
+
+	depth int // 束縛先の環境が何個外側の環境か。未解決なら名前で探し始める環境
+	slot  int // 束縛先のスロット番号+1。0なら未解決で、名前で環境を探す
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
+/*
+識別子の束縛先を、depth 個外側の関数の環境の slot 番目のスロットとして記録する。
+slot が負なら未解決とし、depth 個外側の環境から名前で探すことを記録する
+*/
+func (i *Identifier) Resolve(depth, slot int) {
+	i.depth = depth
+	i.slot = slot + 1
+}
+
+/*
+Resolve で記録した束縛先を取得。未解決なら ok は偽で、depth は名前で探し始める環境を表す
+*/
+func (i *Identifier) Slot() (depth, slot int, ok bool) {
+	return i.depth, i.slot - 1, i.slot > 0
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -146,6 +223,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 /*
@@ -158,6 +236,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 // 真偽値リテラル
@@ -168,36 +247,85 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
+/*
+nullリテラル
+*/
+type NullLiteral struct {
+	Token token.Token // 'null' トークン
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) Pos() token.Position  { return nl.Token.Pos }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 /*
 関数リテラル
 */
 type FunctionLiteral struct {
 	Token      token.Token // 'fn' トークン
+	Name       *Identifier // 名前付き関数リテラルの場合の名前(本体から参照できる)
 	Parameters []*Identifier
+	Variadic   bool                  // 最後のパラメータが残りの引数を配列で受け取るかどうか
+	Defaults   map[string]Expression // パラメータ名ごとのデフォルト値
 	Body       *BlockStatement
+	Generator  bool // 本体に yield を含むかどうか
+
+	slots []string // 呼び出し時の環境のスロットに割り当てた名前
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(fl.TokenLiteral())
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	if fl.Name != nil {
+		out.WriteString(" " + fl.Name.String())
+	}
+	out.WriteString(fl.ParametersString())
+	out.WriteString(" ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+/*
+パラメータリストの文字列表現。例: "(a, b = 1, ...rest)"
+*/
+func (fl *FunctionLiteral) ParametersString() string {
+	params := []string{}
+	for i, p := range fl.Parameters {
+		if fl.Variadic && i == len(fl.Parameters)-1 {
+			params = append(params, "..."+p.String())
+		} else if def, ok := fl.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+/*
+呼び出し時の環境のスロットに割り当てる名前をセット。パラメータが先頭から順に並ぶ
+*/
+func (fl *FunctionLiteral) SetSlots(names []string) {
+	fl.slots = names
+}
+
+/*
+呼び出し時の環境のスロットに割り当てた名前を取得
+*/
+func (fl *FunctionLiteral) Slots() []string {
+	return fl.slots
+}
+
 /*
 配列リテラル
 */
@@ -208,6 +336,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -229,16 +358,18 @@ func (al *ArrayLiteral) String() string {
 type HashLiteral struct {
 	Token token.Token // '{' トークン
 	Pairs map[Expression]Expression
+	Keys  []Expression // ソースコードに現れた順のキー
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -248,6 +379,21 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+/*
+キーをソースコードに現れた順に取得。Keys が設定されていない場合は Pairs の順になる
+*/
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // 前置式
 type PrefixExpression struct {
 	Token    token.Token // 前置トークン、例えば「!」
@@ -257,11 +403,16 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
 	out.WriteString(pe.Operator)
+	// typeof のようなキーワード演算子は被演算子と空白で区切る
+	if pe.Token.Type == token.TYPEOF {
+		out.WriteString(" ")
+	}
 	out.WriteString(pe.Right.String())
 	out.WriteString(")")
 
@@ -278,6 +429,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position  { return oe.Token.Pos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -301,6 +453,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -320,13 +473,15 @@ func (ie *IfExpression) String() string {
 呼び出し式
 */
 type CallExpression struct {
-	Token     token.Token // '(' トークン
-	Function  Expression  // Identifier または FunctionLiteral
-	Arguments []Expression
+	Token          token.Token // '(' トークン
+	Function       Expression  // Identifier または FunctionLiteral
+	Arguments      []Expression
+	NamedArguments []*NamedArgument // name: value 形式の引数
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -334,6 +489,9 @@ func (ce *CallExpression) String() string {
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
 	}
+	for _, a := range ce.NamedArguments {
+		args = append(args, a.String())
+	}
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
@@ -353,6 +511,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -364,3 +523,273 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+
+/*
+match式
+*/
+type MatchExpression struct {
+	Token   token.Token // 'match' トークン
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+
+	out.WriteString("match")
+	out.WriteString("(" + me.Subject.String() + ") ")
+	out.WriteString("{ ")
+	out.WriteString(strings.Join(arms, " "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+/*
+match式の分岐。Patternには識別子・リテラル・配列リテラル・ハッシュリテラルを指定できる
+*/
+type MatchArm struct {
+	Token   token.Token // 'case' トークン
+	Pattern Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) Pos() token.Position  { return ma.Token.Pos }
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("case ")
+	out.WriteString(ma.Pattern.String())
+	out.WriteString(" ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+/*
+配列の分割代入パターン
+*/
+type ArrayPattern struct {
+	Token    token.Token // '[' トークン
+	Elements []*Identifier
+	Rest     *Identifier // ...rest で残りの要素を受け取る識別子
+}
+
+func (ap *ArrayPattern) expressionNode()      {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+/*
+ハッシュの分割代入パターン
+*/
+type HashPattern struct {
+	Token token.Token // '{' トークン
+	Keys  []*Identifier
+}
+
+func (hp *HashPattern) expressionNode()      {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	keys := []string{}
+	for _, k := range hp.Keys {
+		keys = append(keys, k.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(keys, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+/*
+スプレッド式。呼び出し引数の中で配列を展開する
+*/
+type SpreadExpression struct {
+	Token token.Token // '...' トークン
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
+/*
+名前付き引数
+*/
+type NamedArgument struct {
+	Token token.Token // 引数名の識別子トークン
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) Pos() token.Position  { return na.Token.Pos }
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
+
+/*
+メンバー式。hash.key は hash["key"] と同じ意味になる
+*/
+type MemberExpression struct {
+	Token    token.Token // '.' トークン
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+/*
+スライス式。StartとEndは省略された場合nil
+*/
+type SliceExpression struct {
+	Token token.Token // '[' トークン
+	Left  Expression
+	Start Expression
+	End   Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+/*
+class文。コンストラクタのパラメータとlet文のフィールド定義はConstructorにまとめて保持する
+*/
+type ClassStatement struct {
+	Token       token.Token // 'class' トークン
+	Name        *Identifier
+	Constructor *FunctionLiteral // パラメータとフィールド定義(let文)を本体に持つ
+	Methods     []*MethodDefinition
+}
+
+func (cs *ClassStatement) statementNode()       {}
+func (cs *ClassStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ClassStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ClassStatement) String() string {
+	var out bytes.Buffer
+
+	members := []string{}
+	for _, s := range cs.Constructor.Body.Statements {
+		members = append(members, s.String())
+	}
+	for _, m := range cs.Methods {
+		members = append(members, m.String())
+	}
+
+	out.WriteString("class ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(cs.Constructor.ParametersString())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(members, " "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+/*
+クラスのメソッド定義
+*/
+type MethodDefinition struct {
+	Token    token.Token // 'fn' トークン
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+func (md *MethodDefinition) TokenLiteral() string { return md.Token.Literal }
+func (md *MethodDefinition) Pos() token.Position  { return md.Token.Pos }
+func (md *MethodDefinition) String() string {
+	return "fn " + md.Name.String() + md.Function.ParametersString() + " " + md.Function.Body.String()
+}
+
+/*
+yield式。ジェネレーター関数の中で値を一つ生成して実行を中断する
+*/
+type YieldExpression struct {
+	Token token.Token // 'yield' トークン
+	Value Expression  // 値のない yield の場合はnil
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) Pos() token.Position  { return ye.Token.Pos }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return "yield"
+	}
+	return "yield " + ye.Value.String()
+}
+
+/*
+spawn式。呼び出しを goroutine で実行する。Callが呼び出し式でない場合は引数なしで呼び出す
+*/
+type SpawnExpression struct {
+	Token token.Token // 'spawn' トークン
+	Call  Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpawnExpression) String() string       { return "spawn " + se.Call.String() }
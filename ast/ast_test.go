@@ -2,6 +2,8 @@ package ast
 
 import (
 	"monkey/token"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +28,258 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestNodeJSONRoundTrip(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	key := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "b"}, Value: "b"}
+	other := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "a"}, Value: "a"}
+	hash := &HashLiteral{
+		Token: token.Token{Type: token.LBRACE, Literal: "{"},
+		Pairs: map[Expression]Expression{key: ident("x"), other: ident("y")},
+		Keys:  []Expression{key, other},
+	}
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("f"),
+			Value: &FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []*Identifier{ident("x"), ident("y")},
+				Defaults:   map[string]Expression{"y": &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: hash},
+				}},
+			},
+		},
+	}}
+
+	data, err := MarshalNode(program)
+	if err != nil {
+		t.Fatalf("MarshalNode returned error: %s", err)
+	}
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		t.Fatalf("UnmarshalNode returned error: %s", err)
+	}
+
+	if node.String() != program.String() {
+		t.Errorf("round trip changed program. want=%q, got=%q", program.String(), node.String())
+	}
+	fn := node.(*Program).Statements[0].(*LetStatement).Value.(*FunctionLiteral)
+	if fn.Defaults["y"].(*IntegerLiteral).Value != 1 {
+		t.Errorf("default value was not restored")
+	}
+
+	if _, err := UnmarshalNode([]byte(`{"node": "Unknown"}`)); err == nil {
+		t.Errorf("UnmarshalNode with unknown node did not return error")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	// let f = fn(x, y = 1) { x + y }; f(2)
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  ident("f"),
+			Value: &FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+				Parameters: []*Identifier{ident("x"), ident("y")},
+				Defaults:   map[string]Expression{"y": &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &InfixExpression{
+						Token: token.Token{Type: token.PLUS, Literal: "+"}, Left: ident("x"), Operator: "+", Right: ident("y"),
+					}},
+				}},
+			},
+		},
+		&ExpressionStatement{Expression: &CallExpression{
+			Token:     token.Token{Type: token.LPAREN, Literal: "("},
+			Function:  ident("f"),
+			Arguments: []Expression{&IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2}},
+		}},
+	}}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			visited = append(visited, node.String())
+		}
+		return true
+	})
+	expected := []string{
+		program.String(),
+		"let f = fn(x, y = 1) (x + y);", "f", "fn(x, y = 1) (x + y)", "x", "y", "1",
+		"(x + y)", "(x + y)", "(x + y)", "x", "y",
+		"f(2)", "f(2)", "f", "2",
+	}
+	if strings.Join(visited, "|") != strings.Join(expected, "|") {
+		t.Errorf("visited nodes wrong.\nwant=%q\ngot= %q", expected, visited)
+	}
+
+	// false を返したノードの子はたどらない
+	var idents []string
+	Inspect(program, func(node Node) bool {
+		if _, ok := node.(*FunctionLiteral); ok {
+			return false
+		}
+		if id, ok := node.(*Identifier); ok {
+			idents = append(idents, id.Value)
+		}
+		return true
+	})
+	if strings.Join(idents, ",") != "f,f" {
+		t.Errorf("identifiers outside function wrong. got=%q", idents)
+	}
+}
+
+func TestCloneAndEqual(t *testing.T) {
+	for name, typ := range nodeTypes {
+		node := populate(reflect.New(typ)).Interface().(Node)
+		clone := Clone(node)
+
+		if clone == node {
+			t.Errorf("Clone(%s) returned the same node", name)
+			continue
+		}
+		if !Equal(node, clone) {
+			t.Errorf("clone of %s is not equal to original", name)
+		}
+		if typ != hashLiteralPtr.Elem() && !reflect.DeepEqual(node, clone) {
+			t.Errorf("clone of %s lost fields.\nwant=%#v\ngot= %#v", name, node, clone)
+		}
+		if shared := sharedPointer(reflect.ValueOf(node), reflect.ValueOf(clone)); shared != "" {
+			t.Errorf("clone of %s shares %s with original", name, shared)
+		}
+
+		// トークンとハッシュリテラルのキーの順序、解決パスの結果以外のフィールドが違えば等しくない
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Name == "Token" || field.PkgPath != "" || (typ == hashLiteralPtr.Elem() && field.Name == "Keys") {
+				continue
+			}
+			changed := Clone(node)
+			v := reflect.ValueOf(changed).Elem().Field(i)
+			switch v.Kind() {
+			case reflect.String:
+				v.SetString("other")
+			case reflect.Int64:
+				v.SetInt(2)
+			case reflect.Bool:
+				v.SetBool(false)
+			default:
+				v.Set(reflect.Zero(v.Type()))
+			}
+			if Equal(node, changed) {
+				t.Errorf("Equal ignores %s.%s", name, field.Name)
+			}
+		}
+	}
+
+	if !Equal(nil, (*Identifier)(nil)) || Equal(nil, &NullLiteral{}) {
+		t.Errorf("Equal handles nil nodes wrong")
+	}
+}
+
+/*
+v の指すノードの全てのフィールドに空でない値を入れる
+*/
+func populate(v reflect.Value) reflect.Value {
+	node := v.Elem()
+	for i := 0; i < node.NumField(); i++ {
+		field := node.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString("x")
+		case reflect.Int64:
+			field.SetInt(1)
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.Struct:
+			field.Set(reflect.ValueOf(token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 1}}))
+		default:
+			field.Set(populateValue(field.Type()))
+		}
+	}
+	if hl, ok := v.Interface().(*HashLiteral); ok {
+		hl.Keys = nil
+		for key := range hl.Pairs {
+			hl.Keys = append(hl.Keys, key)
+		}
+	}
+	return v
+}
+
+func populateValue(t reflect.Type) reflect.Value {
+	switch t.Kind() {
+	case reflect.Interface:
+		if t == reflect.TypeOf((*Statement)(nil)).Elem() {
+			return reflect.ValueOf(&ExpressionStatement{Expression: &Identifier{Value: "s"}})
+		}
+		return reflect.ValueOf(&Identifier{Value: "e"})
+	case reflect.Ptr:
+		return populate(reflect.New(t.Elem()))
+	case reflect.Slice:
+		s := reflect.MakeSlice(t, 1, 1)
+		s.Index(0).Set(populateValue(t.Elem()))
+		return s
+	case reflect.Map:
+		m := reflect.MakeMap(t)
+		key := reflect.ValueOf("k")
+		if t.Key().Kind() == reflect.Interface {
+			key = populateValue(t.Key())
+		}
+		m.SetMapIndex(key, populateValue(t.Elem()))
+		return m
+	}
+	panic("cannot populate " + t.String())
+}
+
+/*
+二つの構文木が共有しているノードのポインタを探す。共有していなければ空文字列を返す
+*/
+func sharedPointer(a, b reflect.Value) string {
+	switch a.Kind() {
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return ""
+		}
+		return sharedPointer(a.Elem(), b.Elem())
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return ""
+		}
+		if a.Pointer() == b.Pointer() {
+			return a.Type().String()
+		}
+		return sharedPointer(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if shared := sharedPointer(a.Field(i), b.Field(i)); shared != "" {
+				return shared
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			if shared := sharedPointer(a.Index(i), b.Index(i)); shared != "" {
+				return shared
+			}
+		}
+	case reflect.Map:
+		if a.Type().Key().Kind() == reflect.String {
+			for _, key := range a.MapKeys() {
+				if shared := sharedPointer(a.MapIndex(key), b.MapIndex(key)); shared != "" {
+					return shared
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,490 @@
+package ast
+
+import "reflect"
+
+/*
+構文木を深くコピーする。トークンも含めて元の構文木と同じ内容で、ノードを一つも共有しない構文木を返す
+*/
+func Clone(node Node) Node {
+	if isNilNode(node) {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		return &Program{Statements: cloneStatements(n.Statements)}
+
+	case *LetStatement:
+		return &LetStatement{Token: n.Token, Name: cloneIdentifier(n.Name), Pattern: cloneExpression(n.Pattern), Value: cloneExpression(n.Value)}
+
+	case *ConstStatement:
+		return &ConstStatement{Token: n.Token, Name: cloneIdentifier(n.Name), Value: cloneExpression(n.Value)}
+
+	case *FunctionStatement:
+		return &FunctionStatement{Token: n.Token, Name: cloneIdentifier(n.Name), Function: cloneFunction(n.Function)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: n.Token, ReturnValue: cloneExpression(n.ReturnValue)}
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: n.Token, Expression: cloneExpression(n.Expression)}
+
+	case *BlockStatement:
+		return cloneBlock(n)
+
+	case *Identifier:
+		return cloneIdentifier(n)
+
+	case *IntegerLiteral:
+		clone := *n
+		return &clone
+
+	case *StringLiteral:
+		clone := *n
+		return &clone
+
+	case *Boolean:
+		clone := *n
+		return &clone
+
+	case *NullLiteral:
+		clone := *n
+		return &clone
+
+	case *FunctionLiteral:
+		return cloneFunction(n)
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: n.Token, Elements: cloneExpressions(n.Elements)}
+
+	case *HashLiteral:
+		clone := &HashLiteral{Token: n.Token, Pairs: make(map[Expression]Expression, len(n.Pairs))}
+		for _, key := range n.OrderedKeys() {
+			k := cloneExpression(key)
+			clone.Pairs[k] = cloneExpression(n.Pairs[key])
+			clone.Keys = append(clone.Keys, k)
+		}
+		return clone
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: n.Token, Operator: n.Operator, Right: cloneExpression(n.Right)}
+
+	case *InfixExpression:
+		return &InfixExpression{Token: n.Token, Left: cloneExpression(n.Left), Operator: n.Operator, Right: cloneExpression(n.Right)}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       n.Token,
+			Condition:   cloneExpression(n.Condition),
+			Consequence: cloneBlock(n.Consequence),
+			Alternative: cloneBlock(n.Alternative),
+		}
+
+	case *CallExpression:
+		clone := &CallExpression{Token: n.Token, Function: cloneExpression(n.Function), Arguments: cloneExpressions(n.Arguments)}
+		if n.NamedArguments != nil {
+			clone.NamedArguments = make([]*NamedArgument, len(n.NamedArguments))
+			for i, arg := range n.NamedArguments {
+				clone.NamedArguments[i] = cloneNamedArgument(arg)
+			}
+		}
+		return clone
+
+	case *IndexExpression:
+		return &IndexExpression{Token: n.Token, Left: cloneExpression(n.Left), Index: cloneExpression(n.Index)}
+
+	case *MatchExpression:
+		clone := &MatchExpression{Token: n.Token, Subject: cloneExpression(n.Subject)}
+		if n.Arms != nil {
+			clone.Arms = make([]*MatchArm, len(n.Arms))
+			for i, arm := range n.Arms {
+				clone.Arms[i] = cloneMatchArm(arm)
+			}
+		}
+		return clone
+
+	case *MatchArm:
+		return cloneMatchArm(n)
+
+	case *ArrayPattern:
+		return &ArrayPattern{Token: n.Token, Elements: cloneIdentifiers(n.Elements), Rest: cloneIdentifier(n.Rest)}
+
+	case *HashPattern:
+		return &HashPattern{Token: n.Token, Keys: cloneIdentifiers(n.Keys)}
+
+	case *SpreadExpression:
+		return &SpreadExpression{Token: n.Token, Value: cloneExpression(n.Value)}
+
+	case *NamedArgument:
+		return cloneNamedArgument(n)
+
+	case *MemberExpression:
+		return &MemberExpression{Token: n.Token, Object: cloneExpression(n.Object), Property: cloneIdentifier(n.Property)}
+
+	case *SliceExpression:
+		return &SliceExpression{Token: n.Token, Left: cloneExpression(n.Left), Start: cloneExpression(n.Start), End: cloneExpression(n.End)}
+
+	case *ClassStatement:
+		clone := &ClassStatement{Token: n.Token, Name: cloneIdentifier(n.Name), Constructor: cloneFunction(n.Constructor)}
+		if n.Methods != nil {
+			clone.Methods = make([]*MethodDefinition, len(n.Methods))
+			for i, method := range n.Methods {
+				clone.Methods[i] = cloneMethod(method)
+			}
+		}
+		return clone
+
+	case *MethodDefinition:
+		return cloneMethod(n)
+
+	case *YieldExpression:
+		return &YieldExpression{Token: n.Token, Value: cloneExpression(n.Value)}
+
+	case *SpawnExpression:
+		return &SpawnExpression{Token: n.Token, Call: cloneExpression(n.Call)}
+	}
+
+	return node
+}
+
+func cloneStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	clone := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		if stmt != nil {
+			clone[i] = Clone(stmt).(Statement)
+		}
+	}
+	return clone
+}
+
+/*
+省略できる式をコピーする。nil の場合は nil を返す
+*/
+func cloneExpression(expr Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	return Clone(expr).(Expression)
+}
+
+func cloneExpressions(exprs []Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	clone := make([]Expression, len(exprs))
+	for i, expr := range exprs {
+		clone[i] = cloneExpression(expr)
+	}
+	return clone
+}
+
+func cloneIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	clone := *ident
+	return &clone
+}
+
+func cloneIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	clone := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		clone[i] = cloneIdentifier(ident)
+	}
+	return clone
+}
+
+func cloneBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: cloneStatements(block.Statements)}
+}
+
+func cloneFunction(fn *FunctionLiteral) *FunctionLiteral {
+	if fn == nil {
+		return nil
+	}
+	clone := &FunctionLiteral{
+		Token:      fn.Token,
+		Name:       cloneIdentifier(fn.Name),
+		Parameters: cloneIdentifiers(fn.Parameters),
+		Variadic:   fn.Variadic,
+		Body:       cloneBlock(fn.Body),
+		Generator:  fn.Generator,
+		slots:      fn.slots,
+	}
+	if fn.Defaults != nil {
+		clone.Defaults = make(map[string]Expression, len(fn.Defaults))
+		for name, def := range fn.Defaults {
+			clone.Defaults[name] = cloneExpression(def)
+		}
+	}
+	return clone
+}
+
+func cloneNamedArgument(arg *NamedArgument) *NamedArgument {
+	if arg == nil {
+		return nil
+	}
+	return &NamedArgument{Token: arg.Token, Name: cloneIdentifier(arg.Name), Value: cloneExpression(arg.Value)}
+}
+
+func cloneMatchArm(arm *MatchArm) *MatchArm {
+	if arm == nil {
+		return nil
+	}
+	return &MatchArm{Token: arm.Token, Pattern: cloneExpression(arm.Pattern), Body: cloneBlock(arm.Body)}
+}
+
+func cloneMethod(method *MethodDefinition) *MethodDefinition {
+	if method == nil {
+		return nil
+	}
+	return &MethodDefinition{Token: method.Token, Name: cloneIdentifier(method.Name), Function: cloneFunction(method.Function)}
+}
+
+/*
+二つの構文木が同じ構造かどうか判定する。トークンの位置や綴りは比較せず、
+ノードの種類と値、演算子、子ノードが等しければ等しいとする。ハッシュリテラルのペアは順序を問わない
+*/
+func Equal(a, b Node) bool {
+	if isNilNode(a) || isNilNode(b) {
+		return isNilNode(a) && isNilNode(b)
+	}
+
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && equalStatements(a.Statements, b.Statements)
+
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Pattern, b.Pattern) && Equal(a.Value, b.Value)
+
+	case *ConstStatement:
+		b, ok := b.(*ConstStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Value, b.Value)
+
+	case *FunctionStatement:
+		b, ok := b.(*FunctionStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Function, b.Function)
+
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && equalStatements(a.Statements, b.Statements)
+
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+
+	case *NullLiteral:
+		_, ok := b.(*NullLiteral)
+		return ok
+
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		if !ok || a.Variadic != b.Variadic || a.Generator != b.Generator || len(a.Defaults) != len(b.Defaults) {
+			return false
+		}
+		for name, def := range a.Defaults {
+			other, ok := b.Defaults[name]
+			if !ok || !Equal(def, other) {
+				return false
+			}
+		}
+		return Equal(a.Name, b.Name) && equalIdentifiers(a.Parameters, b.Parameters) && Equal(a.Body, b.Body)
+
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && equalExpressions(a.Elements, b.Elements)
+
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		// キーはノードのポインタなので、等しいキーを探して値を比較する
+		for key, value := range a.Pairs {
+			found := false
+			for otherKey, otherValue := range b.Pairs {
+				if Equal(key, otherKey) && Equal(value, otherValue) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Right, b.Right)
+
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Operator == b.Operator && Equal(a.Left, b.Left) && Equal(a.Right, b.Right)
+
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) &&
+			Equal(a.Consequence, b.Consequence) && Equal(a.Alternative, b.Alternative)
+
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		if !ok || len(a.NamedArguments) != len(b.NamedArguments) {
+			return false
+		}
+		for i := range a.NamedArguments {
+			if !Equal(a.NamedArguments[i], b.NamedArguments[i]) {
+				return false
+			}
+		}
+		return Equal(a.Function, b.Function) && equalExpressions(a.Arguments, b.Arguments)
+
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+
+	case *MatchExpression:
+		b, ok := b.(*MatchExpression)
+		if !ok || len(a.Arms) != len(b.Arms) {
+			return false
+		}
+		for i := range a.Arms {
+			if !Equal(a.Arms[i], b.Arms[i]) {
+				return false
+			}
+		}
+		return Equal(a.Subject, b.Subject)
+
+	case *MatchArm:
+		b, ok := b.(*MatchArm)
+		return ok && Equal(a.Pattern, b.Pattern) && Equal(a.Body, b.Body)
+
+	case *ArrayPattern:
+		b, ok := b.(*ArrayPattern)
+		return ok && equalIdentifiers(a.Elements, b.Elements) && Equal(a.Rest, b.Rest)
+
+	case *HashPattern:
+		b, ok := b.(*HashPattern)
+		return ok && equalIdentifiers(a.Keys, b.Keys)
+
+	case *SpreadExpression:
+		b, ok := b.(*SpreadExpression)
+		return ok && Equal(a.Value, b.Value)
+
+	case *NamedArgument:
+		b, ok := b.(*NamedArgument)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Value, b.Value)
+
+	case *MemberExpression:
+		b, ok := b.(*MemberExpression)
+		return ok && Equal(a.Object, b.Object) && Equal(a.Property, b.Property)
+
+	case *SliceExpression:
+		b, ok := b.(*SliceExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Start, b.Start) && Equal(a.End, b.End)
+
+	case *ClassStatement:
+		b, ok := b.(*ClassStatement)
+		if !ok || len(a.Methods) != len(b.Methods) {
+			return false
+		}
+		for i := range a.Methods {
+			if !Equal(a.Methods[i], b.Methods[i]) {
+				return false
+			}
+		}
+		return Equal(a.Name, b.Name) && Equal(a.Constructor, b.Constructor)
+
+	case *MethodDefinition:
+		b, ok := b.(*MethodDefinition)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Function, b.Function)
+
+	case *YieldExpression:
+		b, ok := b.(*YieldExpression)
+		return ok && Equal(a.Value, b.Value)
+
+	case *SpawnExpression:
+		b, ok := b.(*SpawnExpression)
+		return ok && Equal(a.Call, b.Call)
+	}
+
+	return false
+}
+
+/*
+nil のインターフェースか、型付きの nil ポインタかどうか判定
+*/
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func equalStatements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalExpressions(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalIdentifiers(a, b []*Identifier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+/*
+JSONで表せる構文木のノードの型。ノードの種類は "node" に型名として書く
+*/
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &LetStatement{}, &ConstStatement{}, &FunctionStatement{},
+		&ReturnStatement{}, &ExpressionStatement{}, &BlockStatement{}, &Identifier{},
+		&IntegerLiteral{}, &StringLiteral{}, &Boolean{}, &NullLiteral{}, &FunctionLiteral{},
+		&ArrayLiteral{}, &HashLiteral{}, &PrefixExpression{}, &InfixExpression{},
+		&IfExpression{}, &CallExpression{}, &IndexExpression{}, &MatchExpression{},
+		&MatchArm{}, &ArrayPattern{}, &HashPattern{}, &SpreadExpression{}, &NamedArgument{},
+		&MemberExpression{}, &SliceExpression{}, &ClassStatement{}, &MethodDefinition{},
+		&YieldExpression{}, &SpawnExpression{},
+	} {
+		t := reflect.TypeOf(node).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+var (
+	nodeType       = reflect.TypeOf((*Node)(nil)).Elem()
+	hashLiteralPtr = reflect.TypeOf((*HashLiteral)(nil))
+)
+
+/*
+構文木をJSONに変換する
+*/
+func MarshalNode(node Node) ([]byte, error) {
+	encoded, err := encodeValue(reflect.ValueOf(node))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+/*
+MarshalNode で変換したJSONから構文木を復元する
+*/
+func UnmarshalNode(data []byte) (Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	v, err := decodeValue(decoded, nodeType)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNil() {
+		return nil, nil
+	}
+	return v.Interface().(Node), nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeValue(v.Elem())
+		}
+		if _, ok := nodeTypes[v.Elem().Type().Name()]; !ok {
+			return nil, fmt.Errorf("cannot encode node of type %s", v.Type())
+		}
+		fields, err := encodeStruct(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		fields["node"] = v.Elem().Type().Name()
+		return fields, nil
+
+	case reflect.Struct:
+		return encodeStruct(v)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			el, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = el
+		}
+		return list, nil
+
+	case reflect.Map:
+		// キーが文字列のマップだけを扱う。HashLiteral は encodeStruct で別に扱う
+		if v.IsNil() {
+			return nil, nil
+		}
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		m := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			el, err := encodeValue(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = el
+		}
+		return m, nil
+
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	}
+
+	return nil, fmt.Errorf("cannot encode value of type %s", v.Type())
+}
+
+func encodeStruct(v reflect.Value) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, v.NumField())
+
+	// ハッシュリテラルのペアはキーの順に [キー, 値] の配列として書く
+	if v.Addr().Type() == hashLiteralPtr {
+		hl := v.Addr().Interface().(*HashLiteral)
+		token, err := encodeValue(v.FieldByName("Token"))
+		if err != nil {
+			return nil, err
+		}
+		pairs := []interface{}{}
+		for _, key := range hl.OrderedKeys() {
+			k, err := encodeValue(reflect.ValueOf(key))
+			if err != nil {
+				return nil, err
+			}
+			value, err := encodeValue(reflect.ValueOf(hl.Pairs[key]))
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, []interface{}{k, value})
+		}
+		fields["Token"] = token
+		fields["Pairs"] = pairs
+		return fields, nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		el, err := encodeValue(v.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		fields[v.Type().Field(i).Name] = el
+	}
+	return fields, nil
+}
+
+func decodeValue(data interface{}, t reflect.Type) (reflect.Value, error) {
+	if data == nil {
+		return reflect.Zero(t), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected node object, got %T", data)
+		}
+		name, _ := fields["node"].(string)
+		nt, ok := nodeTypes[name]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown node type %q", name)
+		}
+		ptr := reflect.PtrTo(nt)
+		if !ptr.AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("node %s cannot be used as %s", name, t)
+		}
+		node := reflect.New(nt)
+		if err := decodeStruct(fields, node.Elem()); err != nil {
+			return reflect.Value{}, err
+		}
+		return node, nil
+
+	case reflect.Struct:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected object for %s, got %T", t, data)
+		}
+		v := reflect.New(t).Elem()
+		if err := decodeStruct(fields, v); err != nil {
+			return reflect.Value{}, err
+		}
+		return v, nil
+
+	case reflect.Slice:
+		list, ok := data.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected array for %s, got %T", t, data)
+		}
+		v := reflect.MakeSlice(t, len(list), len(list))
+		for i, item := range list {
+			el, err := decodeValue(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(el)
+		}
+		return v, nil
+
+	case reflect.Map:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected object for %s, got %T", t, data)
+		}
+		v := reflect.MakeMapWithSize(t, len(m))
+		for key, item := range m {
+			el, err := decodeValue(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), el)
+		}
+		return v, nil
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected string, got %T", data)
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+
+	case reflect.Int, reflect.Int64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected number, got %T", data)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected boolean, got %T", data)
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot decode value of type %s", t)
+}
+
+func decodeStruct(fields map[string]interface{}, v reflect.Value) error {
+	if v.Addr().Type() == hashLiteralPtr {
+		hl := v.Addr().Interface().(*HashLiteral)
+		token, err := decodeValue(fields["Token"], v.FieldByName("Token").Type())
+		if err != nil {
+			return err
+		}
+		v.FieldByName("Token").Set(token)
+
+		pairs, _ := fields["Pairs"].([]interface{})
+		hl.Pairs = make(map[Expression]Expression, len(pairs))
+		for _, item := range pairs {
+			pair, ok := item.([]interface{})
+			if !ok || len(pair) != 2 {
+				return fmt.Errorf("invalid hash literal pair")
+			}
+			key, err := decodeValue(pair[0], expressionType)
+			if err != nil {
+				return err
+			}
+			value, err := decodeValue(pair[1], expressionType)
+			if err != nil {
+				return err
+			}
+			hl.Pairs[key.Interface().(Expression)] = value.Interface().(Expression)
+			hl.Keys = append(hl.Keys, key.Interface().(Expression))
+		}
+		return nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		el, err := decodeValue(fields[field.Name], field.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", v.Type().Name(), field.Name, err)
+		}
+		v.Field(i).Set(el)
+	}
+	return nil
+}
+
+var expressionType = reflect.TypeOf((*Expression)(nil)).Elem()
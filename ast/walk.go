@@ -0,0 +1,196 @@
+package ast
+
+/*
+Walk で構文木をたどる際に各ノードで呼ばれる。Visit が返した Visitor で子ノードをたどり、
+nil を返した場合は子ノードをたどらない
+*/
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/*
+構文木を深さ優先でたどる。まず v.Visit(node) を呼び、戻り値 w が nil でなければ
+node の各子ノードについて w で再帰的にたどり、最後に w.Visit(nil) を呼ぶ
+*/
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Pattern != nil {
+			Walk(v, n.Pattern)
+		}
+		walkExpression(v, n.Value)
+
+	case *ConstStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+
+	case *FunctionStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *NullLiteral:
+		// 子ノードはない
+
+	case *FunctionLiteral:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		// デフォルト値はパラメータの直後にたどる
+		for _, param := range n.Parameters {
+			Walk(v, param)
+			walkExpression(v, n.Defaults[param.Value])
+		}
+		Walk(v, n.Body)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *HashLiteral:
+		for _, key := range n.OrderedKeys() {
+			Walk(v, key)
+			walkExpression(v, n.Pairs[key])
+		}
+
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+		for _, arg := range n.NamedArguments {
+			Walk(v, arg)
+		}
+
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+
+	case *MatchExpression:
+		walkExpression(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+
+	case *MatchArm:
+		walkExpression(v, n.Pattern)
+		Walk(v, n.Body)
+
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			Walk(v, el)
+		}
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *HashPattern:
+		for _, key := range n.Keys {
+			Walk(v, key)
+		}
+
+	case *SpreadExpression:
+		walkExpression(v, n.Value)
+
+	case *NamedArgument:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		Walk(v, n.Property)
+
+	case *SliceExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Start)
+		walkExpression(v, n.End)
+
+	case *ClassStatement:
+		Walk(v, n.Name)
+		if n.Constructor != nil {
+			Walk(v, n.Constructor)
+		}
+		for _, method := range n.Methods {
+			Walk(v, method)
+		}
+
+	case *MethodDefinition:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+
+	case *YieldExpression:
+		walkExpression(v, n.Value)
+
+	case *SpawnExpression:
+		walkExpression(v, n.Call)
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+func walkExpressions(v Visitor, exprs []Expression) {
+	for _, expr := range exprs {
+		walkExpression(v, expr)
+	}
+}
+
+/*
+省略できる式をたどる。nil の場合は何もしない
+*/
+func walkExpression(v Visitor, expr Expression) {
+	if expr != nil {
+		Walk(v, expr)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+構文木を深さ優先でたどり、各ノードで f(node) を呼ぶ。f が false を返した場合は
+そのノードの子ノードをたどらない。子ノードをたどり終えると f(nil) が呼ばれる
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,207 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+命令列。オペコードとオペランドをバイト列として並べたもの
+*/
+type Instructions []byte
+
+/*
+逆アセンブルした命令列。一行に一命令を「オフセット 命令名 オペランド」の形式で書く
+*/
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+/*
+オペコード
+*/
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 定数プールの値を積む
+	OpPop                    // スタックの先頭を捨てる
+
+	OpTrue  // true を積む
+	OpFalse // false を積む
+	OpNull  // null を積む
+
+	OpPrefix // 定数プールにある演算子で前置式を評価する
+	OpInfix  // 定数プールにある演算子で中置式を評価する
+
+	OpJump          // 無条件に分岐する
+	OpJumpNotTruthy // スタックの先頭を取り出し、偽であれば分岐する
+	OpJumpNotNull   // スタックの先頭がnullでなければ残したまま分岐し、nullであれば捨てる
+
+	OpGetGlobal // グローバル変数を積む
+	OpSetGlobal // スタックの先頭をグローバル変数に束縛する
+	OpGetLocal  // ローカル変数を積む
+	OpSetLocal  // スタックの先頭をローカル変数に束縛する
+	OpGetFree   // クロージャが閉じ込めた自由変数を積む
+
+	OpArray  // スタックの先頭の要素から配列を作る
+	OpHash   // スタックの先頭のキーと値の組からハッシュを作る
+	OpIndex  // 添字式を評価する
+	OpMember // 定数プールにある名前でメンバー式を評価する
+
+	OpClosure        // 定数プールのコンパイル済み関数と自由変数からクロージャを作る
+	OpCurrentClosure // 実行中のクロージャを積む
+	OpArguments      // 呼び出す関数を積んだ後、オペランドの位置にある OpCall までの引数の評価を始める
+	OpCall           // 関数を呼び出す
+	OpReturnValue    // スタックの先頭を戻り値として関数から戻る
+	OpReturn         // null を戻り値として関数から戻る
+)
+
+/*
+オペコードの定義。OperandWidths は各オペランドのバイト数
+*/
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpPrefix: {"OpPrefix", []int{2}},
+	OpInfix:  {"OpInfix", []int{2}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJumpNotNull:   {"OpJumpNotNull", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+	OpGetFree:   {"OpGetFree", []int{1}},
+
+	OpArray:  {"OpArray", []int{2}},
+	OpHash:   {"OpHash", []int{2}},
+	OpIndex:  {"OpIndex", []int{}},
+	OpMember: {"OpMember", []int{2}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpArguments:      {"OpArguments", []int{2}},
+	OpCall:           {"OpCall", []int{1}},
+	OpReturnValue:    {"OpReturnValue", []int{}},
+	OpReturn:         {"OpReturn", []int{}},
+}
+
+/*
+オペコードの定義を取得
+*/
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+/*
+オペコードとオペランドから命令を作る
+*/
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+/*
+命令のオペランドを読み込み、オペランドと読み込んだバイト数を返す
+*/
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
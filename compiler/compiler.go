@@ -0,0 +1,621 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+)
+
+/*
+構文木をバイトコードにコンパイルするコンパイラ。
+演算は評価器の関数に任せるので、仮想マシンは評価器と同じ結果とエラーを返す。
+クラス、match式、ジェネレーター、spawn、分割代入、名前付き引数、デフォルト値、スライス、スプレッドには対応しない
+*/
+type Compiler struct {
+	constants []object.Object
+	operators map[string]int // 演算子やメンバー名の文字列定数のインデックス
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+/*
+関数ごとのコンパイル中の命令列
+*/
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	positions map[int]token.Position
+	callNames map[int]string
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+/*
+コンパイル結果
+*/
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	GlobalNames  []string               // グローバル変数のインデックスごとの名前
+	Positions    map[int]token.Position // 命令のオフセットごとの、命令を生成したノードの位置
+	CallNames    map[int]string         // OpCall のオフセットごとの、呼び出す関数の名前
+}
+
+/*
+新規コンパイラを生成
+*/
+func New() *Compiler {
+	return &Compiler{
+		operators:   make(map[string]int),
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{newScope()},
+	}
+}
+
+func newScope() CompilationScope {
+	return CompilationScope{
+		positions: make(map[int]token.Position),
+		callNames: make(map[int]string),
+	}
+}
+
+/*
+コンパイル結果を取得
+*/
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		GlobalNames:  c.symbolTable.Names(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		CallNames:    c.scopes[c.scopeIndex].callNames,
+	}
+}
+
+/*
+ノードをコンパイル
+*/
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	// プログラム
+	case *ast.Program:
+		// 関数は呼ばれた時点のグローバル変数を参照するので、後で定義される名前も先に束縛しておく
+		c.hoistGlobals(node)
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	// 式
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	// ブロック文
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	// let文
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return unsupported(node, "destructuring let")
+		}
+		return c.compileBinding(node.Name, node.Value, false)
+
+	// const文
+	case *ast.ConstStatement:
+		return c.compileBinding(node.Name, node.Value, true)
+
+	// 関数宣言文
+	case *ast.FunctionStatement:
+		return c.compileBinding(node.Name, node.Function, false)
+
+	// return文
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// 整数リテラル
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	// 文字列リテラル
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	// 真偽値
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	// nullリテラル
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	// 前置式
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emitAt(node, code.OpPrefix, c.addString(node.Operator))
+
+	// 中置式
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		// null合体演算子は左辺がnullの場合のみ右辺を評価する
+		if node.Operator == "??" {
+			jumpPos := c.emit(code.OpJumpNotNull, 9999)
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+			return nil
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emitAt(node, code.OpInfix, c.addString(node.Operator))
+
+	// if式
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	// 識別子
+	case *ast.Identifier:
+		c.loadIdentifier(node)
+
+	// 配列リテラル
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if _, ok := el.(*ast.SpreadExpression); ok {
+				return unsupported(el, "spread")
+			}
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	// ハッシュリテラル
+	case *ast.HashLiteral:
+		keys := node.OrderedKeys()
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emitAt(node, code.OpHash, len(keys)*2)
+
+	// 添字式
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emitAt(node, code.OpIndex)
+
+	// メンバー式
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+		c.emitAt(node, code.OpMember, c.addString(node.Property.Value))
+
+	// 関数リテラル
+	case *ast.FunctionLiteral:
+		name := ""
+		if node.Name != nil {
+			name = node.Name.Value
+		}
+		return c.compileFunction(node, name)
+
+	// 呼び出し式
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+
+	case *ast.SliceExpression:
+		return unsupported(node, "slice expression")
+	case *ast.MatchExpression:
+		return unsupported(node, "match expression")
+	case *ast.ClassStatement:
+		return unsupported(node, "class")
+	case *ast.YieldExpression:
+		return unsupported(node, "yield")
+	case *ast.SpawnExpression:
+		return unsupported(node, "spawn")
+	case *ast.SpreadExpression:
+		return unsupported(node, "spread")
+	default:
+		return fmt.Errorf("cannot compile node of type %T", node)
+	}
+
+	return nil
+}
+
+/*
+対応していない構文のエラー
+*/
+func unsupported(node ast.Node, what string) error {
+	return fmt.Errorf("%s: %s is not supported by the bytecode compiler", node.Pos(), what)
+}
+
+/*
+プログラムの中でグローバル変数に束縛される名前を先に定義する。関数の中は除く
+*/
+func (c *Compiler) hoistGlobals(program *ast.Program) {
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.LetStatement:
+			if n.Name != nil {
+				c.symbolTable.Define(n.Name.Value)
+			}
+		case *ast.ConstStatement:
+			c.symbolTable.Define(n.Name.Value)
+		case *ast.FunctionStatement:
+			c.symbolTable.Define(n.Name.Value)
+		}
+		return true
+	})
+}
+
+/*
+let文、const文、関数宣言文をコンパイル。値は束縛する前にコンパイルし、
+値の中の同じ名前は外側の束縛を参照する。関数は自身の名前で自身を参照できる
+*/
+func (c *Compiler) compileBinding(name *ast.Identifier, value ast.Expression, constant bool) error {
+	if symbol, ok := c.symbolTable.Local(name.Value); ok && symbol.Constant {
+		return fmt.Errorf("%s: cannot redeclare constant: %s", name.Pos(), name.Value)
+	}
+
+	if fn, ok := value.(*ast.FunctionLiteral); ok && fn.Name == nil {
+		if err := c.compileFunction(fn, name.Value); err != nil {
+			return err
+		}
+	} else if err := c.Compile(value); err != nil {
+		return err
+	}
+
+	var symbol Symbol
+	if constant {
+		symbol = c.symbolTable.DefineConstant(name.Value)
+	} else {
+		symbol = c.symbolTable.Define(name.Value)
+	}
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	return nil
+}
+
+/*
+識別子の値を積む命令を生成する。どこにも束縛されていない組み込み関数の名前は組み込み関数を積み、
+それ以外の名前は値が束縛されないグローバル変数として実行時のエラーにする。
+Policy で制限される組み込み関数は、実行時に仮想マシンの Policy で探すようグローバル変数として扱う
+*/
+func (c *Compiler) loadIdentifier(node *ast.Identifier) {
+	symbol, ok := c.symbolTable.Resolve(node.Value)
+	if !ok {
+		if builtin, ok := evaluator.Builtin(node.Value); ok && !evaluator.IsRestricted(node.Value) {
+			c.emit(code.OpConstant, c.addConstant(builtin))
+			return
+		}
+		symbol = c.globalTable().Define(node.Value)
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emitAt(node, code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) globalTable() *SymbolTable {
+	table := c.symbolTable
+	for table.Outer != nil {
+		table = table.Outer
+	}
+	return table
+}
+
+/*
+if式をコンパイル。ブロックの最後の式の値をif式の値にする
+*/
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+/*
+ブロックを値を残すようにコンパイル。最後が式文でなければnullを値にする
+*/
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+/*
+関数リテラルをコンパイルしてクロージャを作る命令を生成。name が空でなければ本体から自身を name で参照できる
+*/
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	if node.Generator {
+		return unsupported(node, "generator")
+	}
+	if len(node.Defaults) > 0 {
+		return unsupported(node, "default parameter")
+	}
+
+	c.enterScope()
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	scope := c.scopes[c.scopeIndex]
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Variadic:      node.Variadic,
+		Name:          name,
+		Source:        (&object.Function{Parameters: node.Parameters, Variadic: node.Variadic, Body: node.Body}).Inspect(),
+		Positions:     scope.positions,
+		CallNames:     scope.callNames,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+/*
+呼び出し式をコンパイル。引数の評価を始める前に OpArguments を置き、
+引数の評価でエラーが起きた場合に、エラーを受け取る組み込み関数を呼び出せるようにする
+*/
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	if len(node.NamedArguments) > 0 {
+		return unsupported(node, "named argument")
+	}
+
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+	argumentsPos := c.emit(code.OpArguments, 9999)
+	for _, a := range node.Arguments {
+		if _, ok := a.(*ast.SpreadExpression); ok {
+			return unsupported(a, "spread")
+		}
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+	callPos := c.emitAt(node, code.OpCall, len(node.Arguments))
+	c.scopes[c.scopeIndex].callNames[callPos] = callName(node.Function)
+	c.changeOperand(argumentsPos, callPos)
+
+	return nil
+}
+
+/*
+呼び出し式から関数の名前を取得する
+*/
+func callName(fn ast.Expression) string {
+	switch fn := fn.(type) {
+	case *ast.Identifier:
+		return fn.Value
+	case *ast.MemberExpression:
+		return fn.Property.Value
+	}
+	return "<anonymous>"
+}
+
+/*
+定数プールに値を追加し、インデックスを返す
+*/
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+/*
+演算子やメンバー名の文字列を定数プールに追加する。同じ文字列は同じ定数を使う
+*/
+func (c *Compiler) addString(s string) int {
+	if index, ok := c.operators[s]; ok {
+		return index
+	}
+	index := c.addConstant(&object.String{Value: s})
+	c.operators[s] = index
+	return index
+}
+
+/*
+命令を生成し、命令の位置を返す
+*/
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+/*
+実行時にエラーになりうる命令を、エラーの位置にするノードと共に生成する
+*/
+func (c *Compiler) emitAt(node ast.Node, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	c.scopes[c.scopeIndex].positions[pos] = node.Pos()
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, newScope())
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
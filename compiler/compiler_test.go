@@ -0,0 +1,173 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string) (*Bytecode, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	c := New()
+	err := c.Compile(program)
+	return c.Bytecode(), err
+}
+
+func concat(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestCompileInstructions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected code.Instructions
+	}{
+		{
+			"1 + 2",
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpInfix, 2),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"let x = 1; x ?? 2",
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotNull, 15),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"if (true) { 10 }; 3333;",
+			concat(
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"len([1])",
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArguments, 12),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode, err := compile(t, tt.input)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		if bytecode.Instructions.String() != tt.expected.String() {
+			t.Errorf("wrong instructions for %q.\nwant=\n%s\ngot=\n%s", tt.input, tt.expected, bytecode.Instructions)
+		}
+	}
+}
+
+func TestCompileClosures(t *testing.T) {
+	bytecode, err := compile(t, "let f = fn(a) { fn(b) { a + b + f } };")
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var inner, outer *object.CompiledFunction
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if inner == nil {
+				inner = fn
+			} else {
+				outer = fn
+			}
+		}
+	}
+	if inner == nil || outer == nil {
+		t.Fatalf("compiled functions not found in constants: %v", bytecode.Constants)
+	}
+
+	// a と外側の関数自身の f は自由変数として閉じ込める
+	expectedInner := concat(
+		code.Make(code.OpGetFree, 0),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpInfix, 0),
+		code.Make(code.OpGetFree, 1),
+		code.Make(code.OpInfix, 0),
+		code.Make(code.OpReturnValue),
+	)
+	if inner.Instructions.String() != expectedInner.String() {
+		t.Errorf("wrong inner instructions.\nwant=\n%s\ngot=\n%s", expectedInner, inner.Instructions)
+	}
+	if !strings.Contains(outer.Instructions.String(), "OpCurrentClosure\n0003 OpClosure 1 2") {
+		t.Errorf("outer function does not capture a and f.\n%s", outer.Instructions)
+	}
+}
+
+func TestSymbolTableResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	first := NewEnclosedSymbolTable(global)
+	first.Define("b")
+	second := NewEnclosedSymbolTable(first)
+	second.Define("c")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	}
+	for _, tt := range tests {
+		symbol, ok := second.Resolve(tt.name)
+		if !ok || symbol != tt.expected {
+			t.Errorf("Resolve(%q) wrong. want=%+v, got=%+v", tt.name, tt.expected, symbol)
+		}
+	}
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0].Name != "b" {
+		t.Errorf("free symbols wrong. got=%+v", second.FreeSymbols)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (1) { case 1 { 2 } }", "1:1: match expression is not supported by the bytecode compiler"},
+		{"let f = fn(a = 1) { a };", "1:9: default parameter is not supported by the bytecode compiler"},
+		{"const x = 1; let x = 2;", "1:18: cannot redeclare constant: x"},
+	}
+
+	for _, tt := range tests {
+		_, err := compile(t, tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
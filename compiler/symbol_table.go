@@ -0,0 +1,134 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+/*
+名前の束縛先
+*/
+type Symbol struct {
+	Name     string
+	Scope    SymbolScope
+	Index    int
+	Constant bool // const 文で束縛された名前かどうか
+}
+
+/*
+シンボルテーブル。関数ごとに作り、外側の関数のテーブルを Outer に持つ
+*/
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol // 外側の関数から閉じ込める自由変数
+}
+
+/*
+新規シンボルテーブルを生成
+*/
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+/*
+outer の内側の関数のシンボルテーブルを生成
+*/
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+/*
+名前を束縛する。同じテーブルで定義済みの名前は同じ場所に束縛し直す
+*/
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope != FreeScope && symbol.Scope != FunctionScope {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: LocalScope}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+/*
+名前を定数として束縛する
+*/
+func (s *SymbolTable) DefineConstant(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Constant = true
+	s.store[name] = symbol
+	return symbol
+}
+
+/*
+実行中の関数自身を参照する名前を束縛する
+*/
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+/*
+名前を解決する。外側の関数のローカル変数は自由変数として閉じ込める
+*/
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+/*
+現在のテーブルで定義済みの名前かどうか判定。外側のテーブルは探さない
+*/
+func (s *SymbolTable) Local(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok || symbol.Scope == FreeScope || symbol.Scope == FunctionScope {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+/*
+グローバル変数の名前を定義順に取得
+*/
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,95 @@
+package diagnostic
+
+import (
+	"bytes"
+	"io"
+	"monkey/token"
+	"strings"
+	"unicode"
+)
+
+/*
+抜粋で pos の列の前後に残す文字数。これより長い行は省略記号で切り詰める
+*/
+const excerptRadius = 60
+
+/*
+抜粋で切り詰めた箇所に置く省略記号
+*/
+const ellipsis = "..."
+
+/*
+source の pos の行を取り出し、その下の行の pos の列に ^ を置いた抜粋を返す。
+長い行は pos の列の前後 excerptRadius 文字だけを残す。行が存在しない場合は空文字列を返す
+*/
+func Excerpt(source string, pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	if pos.Line > len(lines) {
+		return ""
+	}
+	line := []rune(strings.TrimRight(lines[pos.Line-1], "\r"))
+
+	column := pos.Column - 1
+	if column > len(line) {
+		column = len(line)
+	}
+	start, end := column-excerptRadius, column+excerptRadius
+	if start < 0 {
+		start = 0
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+
+	var text, caret bytes.Buffer
+	if start > 0 {
+		text.WriteString(ellipsis)
+		caret.WriteString(strings.Repeat(" ", len(ellipsis)))
+	}
+	text.WriteString(string(line[start:end]))
+	if end < len(line) {
+		text.WriteString(ellipsis)
+	}
+
+	for _, ch := range line[start:column] {
+		// タブはそのまま残して、端末上の幅を元の行とそろえる
+		switch {
+		case ch == '\t':
+			caret.WriteRune('\t')
+		case isWide(ch):
+			caret.WriteString("  ")
+		default:
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return text.String() + "\n" + caret.String()
+}
+
+/*
+メッセージの後に、ソースコードの該当箇所の抜粋を字下げして書き出す
+*/
+func Render(out io.Writer, source string, pos token.Position, msg string) {
+	io.WriteString(out, msg+"\n")
+
+	excerpt := Excerpt(source, pos)
+	if excerpt == "" {
+		return
+	}
+	for _, line := range strings.Split(excerpt, "\n") {
+		io.WriteString(out, "\t"+line+"\n")
+	}
+}
+
+/*
+端末上で2文字分の幅で表示される文字かどうか判定
+*/
+func isWide(ch rune) bool {
+	return unicode.In(ch, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(ch >= 0x3000 && ch <= 0x303F) || // CJKの記号と句読点
+		(ch >= 0xFF01 && ch <= 0xFF60) // 全角英数と記号
+}
@@ -0,0 +1,45 @@
+package diagnostic
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func TestExcerpt(t *testing.T) {
+	// 長い行は列の前後だけを残して切り詰める
+	long := strings.Repeat("a", 100) + "!" + strings.Repeat("b", 100)
+	truncated := "..." + strings.Repeat("a", 60) + "!" + strings.Repeat("b", 59) + "...\n" + strings.Repeat(" ", 63) + "^"
+
+	tests := []struct {
+		source   string
+		pos      token.Position
+		expected string
+	}{
+		{"let x 5;", token.Position{Line: 1, Column: 7}, "let x 5;\n      ^"},
+		{"let a = 1;\n\tlet b = ];", token.Position{Line: 2, Column: 10}, "\tlet b = ];\n\t        ^"},
+		{`"日本" + 1`, token.Position{Line: 1, Column: 6}, "\"日本\" + 1\n       ^"},
+		{long, token.Position{Line: 1, Column: 101}, truncated},
+		{strings.Repeat("x", 100), token.Position{Line: 1, Column: 3}, strings.Repeat("x", 62) + "...\n  ^"},
+		{"let x = 1;", token.Position{Line: 3, Column: 1}, ""},
+		{"let x = 1;", token.Position{}, ""},
+	}
+
+	for _, tt := range tests {
+		got := Excerpt(tt.source, tt.pos)
+		if got != tt.expected {
+			t.Errorf("Excerpt(%q, %s) wrong. want=%q, got=%q", tt.source, tt.pos, tt.expected, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var out bytes.Buffer
+	Render(&out, "let x 5;", token.Position{Line: 1, Column: 7}, "1:7: expected =")
+
+	expected := "1:7: expected =\n\tlet x 5;\n\t      ^\n"
+	if out.String() != expected {
+		t.Errorf("Render wrong. want=%q, got=%q", expected, out.String())
+	}
+}
@@ -0,0 +1,95 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+const (
+	elementSize = 16 // 配列の要素ひとつのおおよその大きさ
+	pairSize    = 64 // ハッシュのキーと値の組ひとつのおおよその大きさ
+
+	// MaxAllocation を設定しなくても、ひとつの値として作れる大きさの上限。
+	// メモリを使い切ると recover できずにプロセスが終了するので、作る前に確かめる
+	maxValueSize = 1 << 30
+)
+
+/*
+値そのもののおおよその大きさ。要素の大きさは要素を作ったときに数えるので含めない
+*/
+func allocationSize(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case *object.String:
+		return int64(len(obj.Value))
+	case *object.Bytes:
+		return int64(len(obj.Value))
+	case *object.Array:
+		return int64(len(obj.Elements)) * elementSize
+	case *object.Hash:
+		return int64(len(obj.Pairs)) * pairSize
+	default:
+		return 0
+	}
+}
+
+/*
+大きさ size のものを count 個並べた値を作れるか確かめ、config の MaxAllocation か maxValueSize を超えていればエラーを返す。
+作る前に確かめるので、ひとつで上限を超える値は作らずに済む。掛け算の桁あふれも上限を超えたものとみなす
+*/
+func checkAllocation(config object.Config, count, size int64) *object.Error {
+	if count <= 0 {
+		return nil
+	}
+	if max := config.MaxAllocation; max > 0 && size > max/count {
+		return newErrorOf(object.LimitError, "allocation limit exceeded: %d", max)
+	}
+	if size > maxValueSize/count {
+		return newErrorOf(object.LimitError, "value too large: exceeds %d bytes", maxValueSize)
+	}
+	return nil
+}
+
+/*
+新しい値を作る式かどうか判定。呼び出し式は組み込み関数の呼び出しだけを evalCallExpression で数える
+*/
+func allocates(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.ArrayLiteral, *ast.HashLiteral, *ast.InfixExpression, *ast.SliceExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+作った値の大きさを最も外側の環境の累計に加え、その環境の Config の MaxAllocation を超えればエラーを返す
+*/
+func allocate(env *object.Environment, size int64) *object.Error {
+	max := env.Config().MaxAllocation
+	if max <= 0 || size == 0 {
+		return nil
+	}
+	if env.Allocate(size) > max {
+		return newErrorOf(object.LimitError, "allocation limit exceeded: %d", max)
+	}
+	return nil
+}
+
+/*
+組み込み関数が新しく作ったとみなす戻り値の大きさ。引数や配列の引数の要素をそのまま返した場合は数えない
+*/
+func builtinAllocationSize(result object.Object, args []object.Object) int64 {
+	for _, arg := range args {
+		if result == arg {
+			return 0
+		}
+		if arr, ok := arg.(*object.Array); ok {
+			for _, el := range arr.Elements {
+				if result == el {
+					return 0
+				}
+			}
+		}
+	}
+	return allocationSize(result)
+}
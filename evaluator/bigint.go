@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+)
+
+/*
+int64 同士の算術演算を行う。オーバーフローした場合はfalseを返す
+*/
+func checkedIntegerArithmetic(operator string, left, right int64) (int64, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		return result, (result > left) == (right > 0)
+	case "-":
+		result := left - right
+		return result, (result < left) == (right > 0)
+	case "*":
+		if left == 0 || right == 0 {
+			return 0, true
+		}
+		result := left * right
+		return result, result/right == left && !(left == math.MinInt64 && right == -1)
+	case "/":
+		return left / right, !(left == math.MinInt64 && right == -1)
+	}
+
+	return 0, false
+}
+
+/*
+int64 同士の算術演算がオーバーフローしたことを表すエラーを生成
+*/
+func newOverflowError(operator string, left, right int64) *object.Error {
+	return newErrorOf(object.OverflowError, "integer overflow: %d %s %d", left, operator, right)
+}
+
+/*
+整数または多倍長整数を big.Int に変換する
+*/
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.BigInteger:
+		return obj.Value
+	default:
+		return big.NewInt(obj.(*object.Integer).Value)
+	}
+}
+
+/*
+big.Int を整数オブジェクトにする。int64 に収まる場合は通常の整数にする
+*/
+func newBigInteger(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+	return &object.BigInteger{Value: value}
+}
+
+/*
+符号を反転するとオーバーフローする整数かどうか判定
+*/
+func isMinInt64(obj object.Object) bool {
+	integer, ok := obj.(*object.Integer)
+	return ok && integer.Value == math.MinInt64
+}
+
+/*
+整数型(整数または多倍長整数)かどうか判定
+*/
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIG_INTEGER_OBJ
+}
+
+/*
+多倍長整数を含む中置式を評価
+*/
+func evalBigIntegerInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return newBigInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return newBigInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return newBigInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newErrorOf(object.ZeroDivisionError, "division by zero")
+		}
+		return newBigInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
@@ -3,13 +3,20 @@ package evaluator
 import (
 	"fmt"
 	"monkey/object"
+	"sort"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
 	"puts": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				// 文字列はエスケープせずにそのまま出力する
+				if str, ok := arg.(*object.String); ok {
+					fmt.Fprintln(Stdout, str.Value)
+					continue
+				}
+				fmt.Fprintln(Stdout, arg.Inspect())
 			}
 
 			return NULL
@@ -18,7 +25,7 @@ var builtins = map[string]*object.Builtin{
 	"len": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 
@@ -27,11 +34,23 @@ var builtins = map[string]*object.Builtin{
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
 
-			// 文字列の場合
+			// 文字列の場合。添字と揃えて文字数を返す
 			case *object.String:
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+
+			// 範囲の場合
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
+
+			// 集合の場合
+			case *object.Set:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+
+			// バイト列の場合
+			case *object.Bytes:
 				return &object.Integer{Value: int64(len(arg.Value))}
 			default:
-				return newError("argument to `len` not supported, got %s",
+				return newErrorOf(object.TypeError, "argument to `len` not supported, got %s",
 					args[0].Type())
 			}
 		},
@@ -39,11 +58,11 @@ var builtins = map[string]*object.Builtin{
 	"first": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
+				return newErrorOf(object.TypeError, "argument to `first` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -58,11 +77,11 @@ var builtins = map[string]*object.Builtin{
 	"last": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s",
+				return newErrorOf(object.TypeError, "argument to `last` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -78,11 +97,11 @@ var builtins = map[string]*object.Builtin{
 	"rest": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
+				return newErrorOf(object.TypeError, "argument to `rest` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -100,11 +119,11 @@ var builtins = map[string]*object.Builtin{
 	"push": &object.Builtin{
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
+				return newErrorOf(object.TypeError, "argument to `push` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -118,4 +137,25 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
+	"channel": &object.Builtin{Fn: channel},
+	"send":    &object.Builtin{Fn: send},
+	"recv":    &object.Builtin{Fn: recv},
+	"close":   &object.Builtin{Fn: closeChannel},
+	"keys":    hashBuiltin("keys", hashKeys, 1),
+	"values":  hashBuiltin("values", hashValues, 1),
+	"entries": hashBuiltin("entries", hashEntries, 1),
+	"has":     hashBuiltin("has", hashHas, 2),
+	"delete":  hashBuiltin("delete", hashDelete, 2),
+}
+
+/*
+組み込み関数の名前を昇順で取得
+*/
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,46 @@
+package evaluator
+
+import "monkey/object"
+
+/*
+テスト用の組み込み関数
+*/
+func init() {
+	builtins["assert"] = &object.Builtin{Fn: assertBuiltin}
+	builtins["assertEq"] = &object.Builtin{Fn: assertEqBuiltin}
+}
+
+/*
+assert(cond, msg): 条件が偽ならエラーを発生させる。msgは省略できる
+*/
+func assertBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	if isTruthy(args[0]) {
+		return NULL
+	}
+
+	if len(args) == 1 {
+		return newErrorOf(object.AssertionError, "assertion failed")
+	}
+	if msg, ok := args[1].(*object.String); ok {
+		return newErrorOf(object.AssertionError, "assertion failed: %s", msg.Value)
+	}
+	return newErrorOf(object.AssertionError, "assertion failed: %s", args[1].Inspect())
+}
+
+/*
+assertEq(actual, expected): 2つの値が等しくなければ両方の値を含むエラーを発生させる
+*/
+func assertEqBuiltin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if objectsEqual(args[0], args[1]) {
+		return NULL
+	}
+
+	return newErrorOf(object.AssertionError, "assertion failed: expected %s (%s), got %s (%s)",
+		args[1].Inspect(), args[1].Type(), args[0].Inspect(), args[0].Type())
+}
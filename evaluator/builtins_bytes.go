@@ -0,0 +1,104 @@
+package evaluator
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"monkey/object"
+)
+
+/*
+バイト列の組み込み関数
+*/
+func init() {
+	builtins["bytes"] = &object.Builtin{Fn: bytesBuiltin}
+	builtins["hex"] = &object.Builtin{Fn: hexBuiltin}
+	builtins["base64Encode"] = &object.Builtin{Fn: base64EncodeBuiltin}
+	builtins["base64Decode"] = &object.Builtin{Fn: base64DecodeBuiltin}
+}
+
+/*
+bytes(x): 文字列のUTF-8表現、または0〜255の整数の配列からバイト列を生成する
+*/
+func bytesBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Bytes:
+		return arg
+	case *object.String:
+		return &object.Bytes{Value: []byte(arg.Value)}
+	case *object.Array:
+		value := make([]byte, len(arg.Elements))
+		for i, el := range arg.Elements {
+			integer, ok := el.(*object.Integer)
+			if !ok || integer.Value < 0 || integer.Value > 255 {
+				return newErrorOf(object.ValueError, "byte value out of range: %s", el.Inspect())
+			}
+			value[i] = byte(integer.Value)
+		}
+		return &object.Bytes{Value: value}
+	default:
+		return newErrorOf(object.TypeError, "cannot convert %s to BYTES", arg.Type())
+	}
+}
+
+/*
+文字列またはバイト列の引数をバイト列として取り出す
+*/
+func bytesArgument(name string, args []object.Object) ([]byte, *object.Error) {
+	if len(args) != 1 {
+		return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Bytes:
+		return arg.Value, nil
+	case *object.String:
+		return []byte(arg.Value), nil
+	default:
+		return nil, newErrorOf(object.TypeError, "argument to `%s` must be BYTES or STRING, got %s", name, arg.Type())
+	}
+}
+
+/*
+hex(b): バイト列を16進数の文字列にする
+*/
+func hexBuiltin(args ...object.Object) object.Object {
+	value, err := bytesArgument("hex", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: hex.EncodeToString(value)}
+}
+
+/*
+base64Encode(b): バイト列をBase64の文字列にする
+*/
+func base64EncodeBuiltin(args ...object.Object) object.Object {
+	value, err := bytesArgument("base64Encode", args)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: base64.StdEncoding.EncodeToString(value)}
+}
+
+/*
+base64Decode(s): Base64の文字列をバイト列に戻す
+*/
+func base64DecodeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `base64Decode` must be STRING, got %s", args[0].Type())
+	}
+
+	value, err := base64.StdEncoding.DecodeString(str.Value)
+	if err != nil {
+		return newErrorOf(object.ValueError, "invalid base64 string: %q", str.Value)
+	}
+	return &object.Bytes{Value: value}
+}
@@ -0,0 +1,59 @@
+package evaluator
+
+import "monkey/object"
+
+func init() {
+	builtins["clone"] = &object.Builtin{Fn: cloneBuiltin}
+}
+
+/*
+clone(x): 配列・ハッシュ・集合・バイト列を再帰的に複製する。それ以外の値はそのまま返す
+*/
+func cloneBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return deepCopy(args[0], map[object.Object]object.Object{})
+}
+
+/*
+オブジェクトを再帰的に複製する。複製済みのオブジェクトは同じ複製を使い回すので循環していても停止する
+*/
+func deepCopy(obj object.Object, copies map[object.Object]object.Object) object.Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		arr := &object.Array{Elements: make([]object.Object, len(obj.Elements))}
+		copies[obj] = arr
+		for i, el := range obj.Elements {
+			arr.Elements[i] = deepCopy(el, copies)
+		}
+		return arr
+
+	case *object.Hash:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(obj.Pairs))}
+		copies[obj] = hash
+		for _, pair := range obj.OrderedPairs() {
+			key := pair.Key.(object.Hashable).HashKey()
+			hash.Set(key, object.HashPair{Key: pair.Key, Value: deepCopy(pair.Value, copies)})
+		}
+		return hash
+
+	case *object.Set:
+		set := copySet(obj)
+		copies[obj] = set
+		return set
+
+	case *object.Bytes:
+		value := make([]byte, len(obj.Value))
+		copy(value, obj.Value)
+		return &object.Bytes{Value: value}
+
+	default:
+		return obj
+	}
+}
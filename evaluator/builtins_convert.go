@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+/*
+型を調べる組み込み関数と型変換の組み込み関数
+*/
+func init() {
+	builtins["type"] = &object.Builtin{Fn: typeBuiltin}
+	builtins["int"] = &object.Builtin{Fn: intBuiltin}
+	builtins["str"] = &object.Builtin{Fn: strBuiltin}
+	builtins["bool"] = &object.Builtin{Fn: boolBuiltin}
+}
+
+/*
+type(x): オブジェクトの型名を返す。typeof 演算子と同じ結果になる
+*/
+func typeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	return &object.String{Value: string(args[0].Type())}
+}
+
+/*
+int(x): 整数に変換する。文字列は10進数として解釈し、真偽値は1または0にする
+*/
+func intBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInteger:
+		return arg
+	case *object.Boolean:
+		if arg.Value {
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: 0}
+	case *object.String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return newErrorOf(object.ValueError, "cannot convert %q to INTEGER", arg.Value)
+		}
+		return &object.Integer{Value: value}
+	default:
+		return newErrorOf(object.TypeError, "cannot convert %s to INTEGER", arg.Type())
+	}
+}
+
+/*
+str(x): 文字列に変換する
+*/
+func strBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return arg
+	// バイト列はUTF-8の文字列として解釈する
+	case *object.Bytes:
+		return &object.String{Value: string(arg.Value)}
+	}
+	return &object.String{Value: args[0].Inspect()}
+}
+
+/*
+bool(x): 真偽値に変換する。if式の条件と同じ規則で判定する
+*/
+func boolBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	return nativeBoolToBooleanObject(isTruthy(args[0]))
+}
@@ -0,0 +1,60 @@
+package evaluator
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"monkey/object"
+)
+
+/*
+暗号学的ハッシュ関数の組み込み関数。結果はすべて16進数の文字列で返す
+*/
+func init() {
+	builtins["sha256"] = digestBuiltin("sha256", sha256.New)
+	builtins["sha1"] = digestBuiltin("sha1", sha1.New)
+	builtins["md5"] = digestBuiltin("md5", md5.New)
+	builtins["hmacSha256"] = &object.Builtin{Fn: hmacSha256Builtin}
+}
+
+/*
+文字列またはバイト列のダイジェストを求める組み込み関数を生成する
+*/
+func digestBuiltin(name string, newHash func() hash.Hash) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			value, err := bytesArgument(name, args)
+			if err != nil {
+				return err
+			}
+
+			h := newHash()
+			h.Write(value)
+			return &object.String{Value: hex.EncodeToString(h.Sum(nil))}
+		},
+	}
+}
+
+/*
+hmacSha256(key, s): SHA-256 による HMAC を求める
+*/
+func hmacSha256Builtin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	key, err := bytesArgument("hmacSha256", args[:1])
+	if err != nil {
+		return err
+	}
+	message, err := bytesArgument("hmacSha256", args[1:])
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+	return &object.String{Value: hex.EncodeToString(mac.Sum(nil))}
+}
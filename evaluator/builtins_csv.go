@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"encoding/csv"
+	"monkey/object"
+	"strings"
+)
+
+/*
+CSVの組み込み関数
+*/
+func init() {
+	builtins["csvParse"] = &object.Builtin{Fn: csvParseBuiltin}
+	builtins["csvStringify"] = &object.Builtin{Fn: csvStringifyBuiltin}
+}
+
+/*
+csvParse(s, options): CSVを文字列の配列の配列にする。
+options に {"header": true} を指定すると、1行目を見出しとしてハッシュの配列にする
+*/
+func csvParseBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `csvParse` must be STRING, got %s", args[0].Type())
+	}
+
+	header := false
+	if len(args) == 2 {
+		options, ok := args[1].(*object.Hash)
+		if !ok {
+			return newErrorOf(object.TypeError, "second argument to `csvParse` must be HASH, got %s", args[1].Type())
+		}
+		key := &object.String{Value: "header"}
+		if pair, ok := options.Pairs[key.HashKey()]; ok {
+			header = isTruthy(pair.Value)
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(str.Value))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return newErrorOf(object.ValueError, "cannot parse csv: %s", err)
+	}
+
+	rows := []object.Object{}
+	if header && len(records) > 0 {
+		names := records[0]
+		for _, record := range records[1:] {
+			values := make([]object.Object, len(names))
+			for i := range names {
+				if i < len(record) {
+					values[i] = &object.String{Value: record[i]}
+				} else {
+					values[i] = NULL
+				}
+			}
+			rows = append(rows, newStringHash(names, values))
+		}
+		return &object.Array{Elements: rows}
+	}
+
+	for _, record := range records {
+		fields := make([]object.Object, len(record))
+		for i, field := range record {
+			fields[i] = &object.String{Value: field}
+		}
+		rows = append(rows, &object.Array{Elements: fields})
+	}
+	return &object.Array{Elements: rows}
+}
+
+/*
+csvStringify(rows): 配列の配列をCSVの文字列にする。文字列以外の値は表示用の文字列にする
+*/
+func csvStringifyBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	rows, ok := args[0].(*object.Array)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `csvStringify` must be ARRAY, got %s", args[0].Type())
+	}
+
+	var out strings.Builder
+	writer := csv.NewWriter(&out)
+	for _, row := range rows.Elements {
+		fields, ok := row.(*object.Array)
+		if !ok {
+			return newErrorOf(object.TypeError, "csv row must be ARRAY, got %s", row.Type())
+		}
+
+		record := make([]string, len(fields.Elements))
+		for i, field := range fields.Elements {
+			if str, ok := field.(*object.String); ok {
+				record[i] = str.Value
+			} else {
+				record[i] = field.Inspect()
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	return &object.String{Value: out.String()}
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"os"
+)
+
+/*
+スクリプトに渡されたコマンドライン引数。args() で参照できる
+*/
+var ScriptArgs []string
+
+/*
+環境変数とコマンドライン引数の組み込み関数
+*/
+func init() {
+	builtins["env"] = &object.Builtin{Fn: envBuiltin}
+	builtins["setEnv"] = &object.Builtin{Fn: setEnvBuiltin}
+	builtins["args"] = &object.Builtin{Fn: argsBuiltin}
+}
+
+/*
+env(name): 環境変数の値を返す。設定されていなければNULLを返す
+*/
+func envBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `env` must be STRING, got %s", args[0].Type())
+	}
+
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return NULL
+	}
+	return &object.String{Value: value}
+}
+
+/*
+setEnv(name, value): 環境変数を設定する
+*/
+func setEnvBuiltin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `setEnv` must be STRING, got %s", args[0].Type())
+	}
+	value, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "second argument to `setEnv` must be STRING, got %s", args[1].Type())
+	}
+
+	if err := os.Setenv(name.Value, value.Value); err != nil {
+		return newErrorOf(object.IOError, "cannot set environment variable: %s", err)
+	}
+	return NULL
+}
+
+/*
+args(): スクリプトに渡されたコマンドライン引数を配列で返す
+*/
+func argsBuiltin(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	elements := make([]object.Object, len(ScriptArgs))
+	for i, arg := range ScriptArgs {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
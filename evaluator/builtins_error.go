@@ -0,0 +1,98 @@
+package evaluator
+
+import "monkey/object"
+
+/*
+エラーを生成・判定・捕捉する組み込み関数
+*/
+func init() {
+	builtins["error"] = &object.Builtin{Fn: errorBuiltin}
+	builtins["isError"] = &object.Builtin{Fn: isErrorBuiltin, CatchErrors: true}
+	builtins["try"] = &object.Builtin{Fn: tryBuiltin}
+}
+
+/*
+error(msg, kind): エラーを発生させる。kindはエラーの種類で、省略するとRuntimeError
+*/
+func errorBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	msg, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `error` must be STRING, got %s", args[0].Type())
+	}
+
+	err := &object.Error{Message: msg.Value}
+	if len(args) == 2 {
+		kind, ok := args[1].(*object.String)
+		if !ok {
+			return newErrorOf(object.TypeError, "second argument to `error` must be STRING, got %s", args[1].Type())
+		}
+		err.Kind = object.ErrorKind(kind.Value)
+	}
+	return err
+}
+
+/*
+isError(x): 引数の評価がエラーになったかどうか判定する。エラーでも評価は中断しない
+*/
+func isErrorBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return nativeBoolToBooleanObject(isError(args[0]))
+}
+
+/*
+try(fn, handler): fnを引数なしで呼び出し、エラーになればエラーを表すハッシュを引数にhandlerを呼び出す。
+ハッシュは kind, message, file, line, column, stack を持つ。評価の上限によるエラーは捕捉しない
+*/
+func tryBuiltin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newErrorOf(object.TypeError, "first argument to `try` must be FUNCTION, got %s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newErrorOf(object.TypeError, "second argument to `try` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	result := applyFunction(args[0], []object.Object{})
+	err, ok := result.(*object.Error)
+	if !ok || err.ErrorKind() == object.LimitError {
+		return result
+	}
+	return applyFunction(args[1], []object.Object{errorHash(err)})
+}
+
+/*
+エラーをスクリプトで扱えるハッシュにする。位置が記録されていなければ file, line, column は null
+*/
+func errorHash(err *object.Error) *object.Hash {
+	stack := make([]object.Object, len(err.Stack))
+	for i, name := range err.Stack {
+		stack[i] = &object.String{Value: name}
+	}
+
+	var file, line, column object.Object = NULL, NULL, NULL
+	if err.Pos.IsValid() {
+		if err.Pos.File != "" {
+			file = &object.String{Value: err.Pos.File}
+		}
+		line = &object.Integer{Value: int64(err.Pos.Line)}
+		column = &object.Integer{Value: int64(err.Pos.Column)}
+	}
+
+	return newStringHash(
+		[]string{"kind", "message", "file", "line", "column", "stack"},
+		[]object.Object{
+			&object.String{Value: string(err.ErrorKind())},
+			&object.String{Value: err.Message},
+			file, line, column,
+			&object.Array{Elements: stack},
+		},
+	)
+}
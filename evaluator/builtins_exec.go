@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+	"bytes"
+	"errors"
+	"monkey/object"
+	"os/exec"
+)
+
+func init() {
+	builtins["exec"] = &object.Builtin{Fn: execBuiltin}
+}
+
+/*
+exec(cmd, args): 外部コマンドを実行し、{"stdout": ..., "stderr": ..., "exitCode": ...} を返す。
+argsは省略できる。外部コマンドの実行は環境の Policy で制限する
+*/
+func execBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `exec` must be STRING, got %s", args[0].Type())
+	}
+
+	cmdArgs := []string{}
+	if len(args) == 2 {
+		arr, ok := args[1].(*object.Array)
+		if !ok {
+			return newErrorOf(object.TypeError, "second argument to `exec` must be ARRAY, got %s", args[1].Type())
+		}
+		for _, el := range arr.Elements {
+			str, ok := el.(*object.String)
+			if !ok {
+				return newErrorOf(object.TypeError, "arguments to `exec` must be STRING, got %s", el.Type())
+			}
+			cmdArgs = append(cmdArgs, str.Value)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name.Value, cmdArgs...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// 終了コードが0以外の場合もエラーにはせず結果として返す
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return newErrorOf(object.IOError, "cannot run command: %s", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	return newStringHash(
+		[]string{"stdout", "stderr", "exitCode"},
+		[]object.Object{
+			&object.String{Value: stdout.String()},
+			&object.String{Value: stderr.String()},
+			&object.Integer{Value: int64(exitCode)},
+		},
+	)
+}
@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"errors"
+	"io/fs"
+	"monkey/object"
+	"os"
+)
+
+/*
+ファイル入出力の組み込み関数
+*/
+func init() {
+	builtins["readFile"] = fileBuiltin("readFile", 1, readFile)
+	builtins["writeFile"] = fileBuiltin("writeFile", 2, writeFile)
+	builtins["appendFile"] = fileBuiltin("appendFile", 2, appendFile)
+	builtins["listDir"] = fileBuiltin("listDir", 1, listDir)
+	builtins["fileExists"] = fileBuiltin("fileExists", 1, fileExists)
+}
+
+/*
+ファイル操作の組み込み関数を生成する。引数の数と型を確認する。引数はすべて文字列でなければならない。
+ファイルシステムへのアクセスは環境の Policy で制限する
+*/
+func fileBuiltin(name string, arity int, fn func(args []string) object.Object) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != arity {
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), arity)
+			}
+
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				str, ok := arg.(*object.String)
+				if !ok {
+					return newErrorOf(object.TypeError, "argument to `%s` must be STRING, got %s", name, arg.Type())
+				}
+				strs[i] = str.Value
+			}
+
+			return fn(strs)
+		},
+	}
+}
+
+/*
+readFile(path): ファイルの内容を文字列で返す
+*/
+func readFile(args []string) object.Object {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return newErrorOf(object.IOError, "cannot read file: %s", err)
+	}
+	return &object.String{Value: string(data)}
+}
+
+/*
+writeFile(path, s): ファイルを文字列で上書きする
+*/
+func writeFile(args []string) object.Object {
+	if err := os.WriteFile(args[0], []byte(args[1]), 0644); err != nil {
+		return newErrorOf(object.IOError, "cannot write file: %s", err)
+	}
+	return NULL
+}
+
+/*
+appendFile(path, s): ファイルの末尾に文字列を追加する。ファイルがなければ作成する
+*/
+func appendFile(args []string) object.Object {
+	f, err := os.OpenFile(args[0], os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return newErrorOf(object.IOError, "cannot write file: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(args[1]); err != nil {
+		return newErrorOf(object.IOError, "cannot write file: %s", err)
+	}
+	return NULL
+}
+
+/*
+listDir(path): ディレクトリ内のエントリ名を名前順の配列で返す
+*/
+func listDir(args []string) object.Object {
+	entries, err := os.ReadDir(args[0])
+	if err != nil {
+		return newErrorOf(object.IOError, "cannot read directory: %s", err)
+	}
+
+	names := make([]object.Object, len(entries))
+	for i, entry := range entries {
+		names[i] = &object.String{Value: entry.Name()}
+	}
+	return &object.Array{Elements: names}
+}
+
+/*
+fileExists(path): ファイルまたはディレクトリが存在するかどうか判定する
+*/
+func fileExists(args []string) object.Object {
+	_, err := os.Stat(args[0])
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return newErrorOf(object.IOError, "cannot stat file: %s", err)
+	}
+	return nativeBoolToBooleanObject(err == nil)
+}
@@ -0,0 +1,49 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{fmt.Sprintf(`fileExists("%s")`, path), false},
+		{fmt.Sprintf(`writeFile("%s", "hello")`, path), nil},
+		{fmt.Sprintf(`fileExists("%s")`, path), true},
+		{fmt.Sprintf(`appendFile("%s", ", world")`, path), nil},
+		{fmt.Sprintf(`readFile("%s")`, path), "hello, world"},
+		{fmt.Sprintf(`appendFile("%s", "new")`, filepath.Join(dir, "new.txt")), nil},
+		{fmt.Sprintf(`listDir("%s") == ["new.txt", "out.txt"]`, dir), true},
+		{fmt.Sprintf(`readFile("%s")`, filepath.Join(dir, "missing.txt")),
+			errorMessage("cannot read file: open " + filepath.Join(dir, "missing.txt") + ": no such file or directory")},
+		{`readFile(1)`, errorMessage("argument to `readFile` must be STRING, got INTEGER")},
+		{`writeFile("x")`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFileBuiltinsDisabled(t *testing.T) {
+	evaluated := testEvalWithPolicy(`readFile("/etc/hostname")`, &object.Policy{})
+	testErrorObject(t, evaluated, "filesystem access is disabled: readFile")
+}
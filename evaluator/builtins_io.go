@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/object"
+	"os"
+	"strings"
+)
+
+/*
+puts や input のプロンプトの出力先
+*/
+var Stdout io.Writer = os.Stdout
+
+/*
+input と readLine の読み込み元
+*/
+var stdin = bufio.NewReader(os.Stdin)
+
+/*
+input と readLine の読み込み元を設定する。*bufio.Reader を渡した場合はそのまま共有する
+*/
+func SetInput(r io.Reader) {
+	if br, ok := r.(*bufio.Reader); ok {
+		stdin = br
+		return
+	}
+	stdin = bufio.NewReader(r)
+}
+
+/*
+対話的な入力の組み込み関数
+*/
+func init() {
+	builtins["input"] = &object.Builtin{Fn: inputBuiltin}
+	builtins["readLine"] = &object.Builtin{Fn: readLineBuiltin}
+}
+
+/*
+input(prompt): プロンプトを出力してから1行読み込む。promptは省略できる
+*/
+func inputBuiltin(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 1 {
+		prompt, ok := args[0].(*object.String)
+		if !ok {
+			return newErrorOf(object.TypeError, "argument to `input` must be STRING, got %s", args[0].Type())
+		}
+		fmt.Fprint(Stdout, prompt.Value)
+	}
+
+	return readLine()
+}
+
+/*
+readLine(): 1行読み込んで改行を除いた文字列を返す。入力の終わりではNULLを返す
+*/
+func readLineBuiltin(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	return readLine()
+}
+
+func readLine() object.Object {
+	line, err := stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return newErrorOf(object.IOError, "cannot read input: %s", err)
+	}
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
@@ -0,0 +1,209 @@
+package evaluator
+
+import (
+	"math/big"
+	"monkey/object"
+)
+
+/*
+数学関数の組み込み関数。Monkey には浮動小数点数がないため、すべて整数で計算する
+*/
+func init() {
+	registerConfigured("abs", absBuiltin)
+	builtins["min"] = &object.Builtin{Fn: minBuiltin}
+	builtins["max"] = &object.Builtin{Fn: maxBuiltin}
+	registerConfigured("pow", powBuiltin)
+	builtins["sqrt"] = &object.Builtin{Fn: sqrtBuiltin}
+	builtins["floor"] = &object.Builtin{Fn: floorBuiltin}
+	builtins["ceil"] = &object.Builtin{Fn: ceilBuiltin}
+}
+
+/*
+引数が1つの整数であることを確認する
+*/
+func integerArgument(name string, args []object.Object) (object.Object, *object.Error) {
+	if len(args) != 1 {
+		return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	if !isInteger(args[0]) {
+		return nil, newErrorOf(object.TypeError, "argument to `%s` must be INTEGER, got %s", name, args[0].Type())
+	}
+	return args[0], nil
+}
+
+/*
+abs(n): 絶対値を返す
+*/
+func absBuiltin(config object.Config, args ...object.Object) object.Object {
+	n, err := integerArgument("abs", args)
+	if err != nil {
+		return err
+	}
+
+	if toBigInt(n).Sign() >= 0 {
+		return n
+	}
+	return evalMinusPrefixOperatorExpression(n, config)
+}
+
+/*
+min(a, b, ...) または min(arr): 最小の値を返す
+*/
+func minBuiltin(args ...object.Object) object.Object {
+	return extremum("min", "<", args)
+}
+
+/*
+max(a, b, ...) または max(arr): 最大の値を返す
+*/
+func maxBuiltin(args ...object.Object) object.Object {
+	return extremum("max", ">", args)
+}
+
+/*
+operatorで比較して最も前に来る値を返す。引数が配列1つの場合はその要素から選ぶ
+*/
+func extremum(name string, operator string, args []object.Object) object.Object {
+	if len(args) == 1 {
+		if arr, ok := args[0].(*object.Array); ok {
+			args = arr.Elements
+		}
+	}
+	if len(args) == 0 {
+		return newErrorOf(object.ArgumentError, "`%s` requires at least one value", name)
+	}
+
+	result := args[0]
+	for _, arg := range args[1:] {
+		if arg.Type() != result.Type() && !(isInteger(arg) && isInteger(result)) {
+			return newErrorOf(object.TypeError, "type mismatch in `%s`: %s and %s", name, result.Type(), arg.Type())
+		}
+		better := evalInfixExpression(operator, arg, result, object.Config{})
+		if isError(better) {
+			return better
+		}
+		if better == TRUE {
+			result = arg
+		}
+	}
+
+	return result
+}
+
+/*
+pow(base, exp): べき乗を返す。指数は0以上でなければならない
+*/
+func powBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	if !isInteger(args[0]) || !isInteger(args[1]) {
+		return newErrorOf(object.TypeError, "arguments to `pow` must be INTEGER, got %s and %s",
+			args[0].Type(), args[1].Type())
+	}
+
+	exp := toBigInt(args[1])
+	if exp.Sign() < 0 {
+		return newErrorOf(object.ValueError, "negative exponent: %s", exp)
+	}
+
+	// 多倍長整数に昇格する場合は big.Int で計算する。計算する前に結果の大きさを見積もり、
+	// Config の MaxAllocation を超えるものは作らない
+	checked := config.Overflow == object.OverflowRaise && args[0].Type() == object.INTEGER_OBJ
+	if config.Overflow == object.OverflowPromote || !exp.IsInt64() && !checked ||
+		args[0].Type() == object.BIG_INTEGER_OBJ {
+		base := toBigInt(args[0])
+		if err := checkPowAllocation(config, base, exp); err != nil {
+			return err
+		}
+		return newBigInteger(new(big.Int).Exp(base, exp, nil))
+	}
+
+	// オーバーフローをエラーにする場合、int64 に収まらない指数では絶対値が2以上の底は必ずオーバーフローするので、
+	// 偶奇が同じ小さな指数で計算しても結果は変わらない
+	e := int64(64) + int64(exp.Bit(0))
+	if exp.IsInt64() {
+		e = exp.Int64()
+	}
+
+	// それ以外は int64 の範囲で折り返した値を二乗を繰り返して求める。
+	// オーバーフローをエラーにする場合は、乗算のたびにオーバーフローしていないか確かめる
+	base := args[0].(*object.Integer).Value
+	value := int64(1)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			product, ok := checkedIntegerArithmetic("*", value, base)
+			if !ok && checked {
+				return newErrorOf(object.OverflowError, "integer overflow: pow(%s, %s)", args[0].Inspect(), exp)
+			}
+			value = product
+		}
+		// 最後の二乗は使わないので、オーバーフローしても構わない
+		if e > 1 {
+			square, ok := checkedIntegerArithmetic("*", base, base)
+			if !ok && checked {
+				return newErrorOf(object.OverflowError, "integer overflow: pow(%s, %s)", args[0].Inspect(), exp)
+			}
+			base = square
+		}
+	}
+
+	return &object.Integer{Value: value}
+}
+
+/*
+sqrt(n): 平方根の整数部分を返す
+*/
+func sqrtBuiltin(args ...object.Object) object.Object {
+	n, err := integerArgument("sqrt", args)
+	if err != nil {
+		return err
+	}
+
+	value := toBigInt(n)
+	if value.Sign() < 0 {
+		return newErrorOf(object.ValueError, "square root of negative number: %s", value)
+	}
+
+	return newBigInteger(new(big.Int).Sqrt(value))
+}
+
+/*
+floor(n): 小数点以下を切り捨てる。整数はそのまま返す
+*/
+func floorBuiltin(args ...object.Object) object.Object {
+	n, err := integerArgument("floor", args)
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+/*
+ceil(n): 小数点以下を切り上げる。整数はそのまま返す
+*/
+func ceilBuiltin(args ...object.Object) object.Object {
+	n, err := integerArgument("ceil", args)
+	if err != nil {
+		return err
+	}
+	return n
+}
+
+/*
+base の exp 乗を big.Int で作れるか、結果のビット数から確かめる。|base| が 2 以上なら結果は
+(base のビット数 - 1) * exp ビット以上になるので、そのバイト数が config の MaxAllocation を超えればエラーを返す
+*/
+func checkPowAllocation(config object.Config, base, exp *big.Int) *object.Error {
+	max := config.MaxAllocation
+	if max <= 0 || base.BitLen() <= 1 {
+		return nil
+	}
+
+	size := new(big.Int).Mul(big.NewInt(int64(base.BitLen()-1)), exp)
+	size.Rsh(size, 3)
+	if size.Cmp(big.NewInt(max)) > 0 {
+		return newErrorOf(object.LimitError, "allocation limit exceeded: %d", max)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"abs(-5)", 5},
+		{"abs(5)", 5},
+		{"abs(0)", 0},
+		{"min(3, 1, 2)", 1},
+		{"max(3, 1, 2)", 3},
+		{"min([4, 2, 8])", 2},
+		{"max([4])", 4},
+		{`max("a", "c", "b")`, "c"},
+		{"pow(2, 10)", 1024},
+		{"pow(-3, 3)", -27},
+		{"pow(5, 0)", 1},
+		{"sqrt(16)", 4},
+		{"sqrt(17)", 4},
+		{"sqrt(0)", 0},
+		{"floor(7)", 7},
+		{"ceil(-7)", -7},
+		{"abs(true)", errorMessage("argument to `abs` must be INTEGER, got BOOLEAN")},
+		{"min()", errorMessage("`min` requires at least one value")},
+		{"max([])", errorMessage("`max` requires at least one value")},
+		{`min(1, "a")`, errorMessage("type mismatch in `min`: INTEGER and STRING")},
+		{"pow(2, -1)", errorMessage("negative exponent: -1")},
+		{"sqrt(-4)", errorMessage("square root of negative number: -4")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestPowWithOverflowPromotion(t *testing.T) {
+	config := object.Config{Overflow: object.OverflowPromote}
+	evaluated := testEvalWithConfig("pow(2, 100)", config)
+	if evaluated.Inspect() != "1267650600228229401496703205376" {
+		t.Errorf("pow(2, 100) wrong. got=%s", evaluated.Inspect())
+	}
+
+	evaluated = testEvalWithConfig("sqrt(pow(2, 100))", config)
+	if evaluated.Inspect() != "1125899906842624" {
+		t.Errorf("sqrt(pow(2, 100)) wrong. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestPowAllocationLimit(t *testing.T) {
+	config := object.Config{Overflow: object.OverflowPromote, MaxAllocation: 1 << 16}
+	testErrorObject(t, testEvalWithConfig("pow(2, 1000000000)", config), "allocation limit exceeded: 65536")
+	testErrorObject(t, testEvalWithConfig("pow(3, 1000000)", config), "allocation limit exceeded: 65536")
+
+	// 結果が上限に収まるなら計算する
+	evaluated := testEvalWithConfig("len(str(pow(2, 1000)))", config)
+	testIntegerObject(t, evaluated, 302)
+	testIntegerObject(t, testEvalWithConfig("pow(1, 1000000000)", config), 1)
+}
+
+func TestOverflowModePerInterpreter(t *testing.T) {
+	promoting := testEvalWithConfig("pow(2, 64)", object.Config{Overflow: object.OverflowPromote})
+	if promoting.Inspect() != "18446744073709551616" {
+		t.Errorf("promoting interpreter wrong. got=%s", promoting.Inspect())
+	}
+
+	// 別の環境の設定は影響しない
+	testIntegerObject(t, testEval("pow(2, 64)"), 0)
+}
@@ -0,0 +1,137 @@
+package evaluator
+
+import (
+	"errors"
+	"io"
+	"monkey/object"
+	"net"
+	"strconv"
+)
+
+/*
+tcpRecv で一度に受信する最大バイト数の既定値
+*/
+const defaultRecvSize = 4096
+
+/*
+TCPソケットの組み込み関数。ネットワークへのアクセスは環境の Policy で制限する
+*/
+func init() {
+	builtins["tcpConnect"] = &object.Builtin{Fn: tcpConnect}
+	builtins["tcpSend"] = &object.Builtin{Fn: tcpSend}
+	builtins["tcpRecv"] = &object.Builtin{Fn: tcpRecv}
+	builtins["tcpClose"] = &object.Builtin{Fn: tcpClose}
+}
+
+/*
+第一引数の接続を取り出す
+*/
+func connectionArgument(name string, args []object.Object) (net.Conn, *object.Error) {
+	if len(args) == 0 {
+		return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=0, want=1")
+	}
+	conn, ok := args[0].(*object.Connection)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "first argument to `%s` must be CONNECTION, got %s", name, args[0].Type())
+	}
+	return conn.Conn, nil
+}
+
+/*
+tcpConnect(host, port): TCPで接続する
+*/
+func tcpConnect(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	host, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `tcpConnect` must be STRING, got %s", args[0].Type())
+	}
+	port, ok := args[1].(*object.Integer)
+	if !ok {
+		return newErrorOf(object.TypeError, "second argument to `tcpConnect` must be INTEGER, got %s", args[1].Type())
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(host.Value, strconv.FormatInt(port.Value, 10)))
+	if err != nil {
+		return newErrorOf(object.IOError, "cannot connect: %s", err)
+	}
+	return &object.Connection{Conn: conn}
+}
+
+/*
+tcpSend(conn, data): 文字列またはバイト列を送信し、送信したバイト数を返す
+*/
+func tcpSend(args ...object.Object) object.Object {
+	conn, errObj := connectionArgument("tcpSend", args)
+	if errObj != nil {
+		return errObj
+	}
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	data, errObj := bytesArgument("tcpSend", args[1:])
+	if errObj != nil {
+		return errObj
+	}
+
+	n, err := conn.Write(data)
+	if err != nil {
+		return newErrorOf(object.IOError, "cannot send: %s", err)
+	}
+	return &object.Integer{Value: int64(n)}
+}
+
+/*
+tcpRecv(conn, size): 最大sizeバイトを受信してバイト列で返す。接続が閉じられた場合はNULLを返す。sizeは省略できる
+*/
+func tcpRecv(args ...object.Object) object.Object {
+	conn, errObj := connectionArgument("tcpRecv", args)
+	if errObj != nil {
+		return errObj
+	}
+	if len(args) > 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	size := int64(defaultRecvSize)
+	if len(args) == 2 {
+		integer, ok := args[1].(*object.Integer)
+		if !ok {
+			return newErrorOf(object.TypeError, "second argument to `tcpRecv` must be INTEGER, got %s", args[1].Type())
+		}
+		if integer.Value <= 0 {
+			return newErrorOf(object.ValueError, "receive size must be positive: %d", integer.Value)
+		}
+		size = integer.Value
+	}
+
+	buf := make([]byte, size)
+	n, err := conn.Read(buf)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return NULL
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return newErrorOf(object.IOError, "cannot receive: %s", err)
+	}
+	return &object.Bytes{Value: buf[:n]}
+}
+
+/*
+tcpClose(conn): 接続を閉じる
+*/
+func tcpClose(args ...object.Object) object.Object {
+	conn, errObj := connectionArgument("tcpClose", args)
+	if errObj != nil {
+		return errObj
+	}
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if err := conn.Close(); err != nil {
+		return newErrorOf(object.IOError, "cannot close connection: %s", err)
+	}
+	return NULL
+}
@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"bufio"
+	"fmt"
+	"monkey/object"
+	"net"
+	"testing"
+)
+
+/*
+受信した1行に "echo: " を付けて送り返すサーバーを起動し、ポート番号を返す
+*/
+func startEchoServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %s", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("echo: " + line))
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestTCPBuiltins(t *testing.T) {
+	port := startEchoServer(t)
+
+	input := fmt.Sprintf(`
+let conn = tcpConnect("127.0.0.1", %d);
+let sent = tcpSend(conn, "hello\n");
+let reply = str(tcpRecv(conn));
+let eof = tcpRecv(conn);
+tcpClose(conn);
+[sent, reply, eof]
+`, port)
+
+	evaluated := testEvalWithPolicy(input, object.AllowAll())
+	if evaluated.Inspect() != `[6, "echo: hello\n", null]` {
+		t.Errorf("wrong result. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestTCPBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`tcpSend(1, "x")`, "first argument to `tcpSend` must be CONNECTION, got INTEGER"},
+		{`tcpConnect("127.0.0.1", "80")`, "second argument to `tcpConnect` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEvalWithPolicy(tt.input, object.AllowAll()), tt.expected)
+	}
+
+	testErrorObject(t, testEvalWithPolicy(`tcpConnect("127.0.0.1", 1)`, &object.Policy{}),
+		"network access is disabled: tcpConnect")
+}
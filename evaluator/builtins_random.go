@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"monkey/object"
+)
+
+/*
+randString で使う文字
+*/
+const randStringAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+/*
+識別子を生成する組み込み関数
+*/
+func init() {
+	builtins["uuid"] = &object.Builtin{Fn: uuidBuiltin}
+	registerConfigured("randString", randStringBuiltin)
+}
+
+/*
+uuid(): ランダムなUUID(バージョン4)を返す
+*/
+func uuidBuiltin(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return newErrorOf(object.IOError, "cannot generate uuid: %s", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // バージョン4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 のバリアント
+
+	return &object.String{
+		Value: fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]),
+	}
+}
+
+/*
+randString(n): 英数字からなる長さnのランダムな文字列を返す
+*/
+func randStringBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `randString` must be INTEGER, got %s", args[0].Type())
+	}
+	if n.Value < 0 {
+		return newErrorOf(object.ValueError, "length must not be negative: %d", n.Value)
+	}
+
+	if err := checkAllocation(config, n.Value, 1); err != nil {
+		return err
+	}
+
+	max := big.NewInt(int64(len(randStringAlphabet)))
+	b := make([]byte, n.Value)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return newErrorOf(object.IOError, "cannot generate random string: %s", err)
+		}
+		b[i] = randStringAlphabet[idx.Int64()]
+	}
+
+	return &object.String{Value: string(b)}
+}
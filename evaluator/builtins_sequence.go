@@ -0,0 +1,97 @@
+package evaluator
+
+import "monkey/object"
+
+/*
+配列を生成・組み合わせる組み込み関数
+*/
+func init() {
+	builtins["range"] = &object.Builtin{Fn: rangeBuiltin}
+	registerConfigured("enumerate", enumerateBuiltin)
+	registerConfigured("zip", zipBuiltin)
+}
+
+/*
+range(n), range(a, b), range(a, b, step): 整数の配列を返す。終端は含まない
+*/
+func rangeBuiltin(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	values := make([]int64, len(args))
+	for i, arg := range args {
+		integer, ok := arg.(*object.Integer)
+		if !ok {
+			return newErrorOf(object.TypeError, "arguments to `range` must be INTEGER, got %s", arg.Type())
+		}
+		values[i] = integer.Value
+	}
+
+	start, end, step := int64(0), values[0], int64(1)
+	if len(values) >= 2 {
+		start, end = values[0], values[1]
+	}
+	if len(values) == 3 {
+		step = values[2]
+	}
+	if step == 0 {
+		return newErrorOf(object.ValueError, "range step must not be zero")
+	}
+
+	elements := []object.Object{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		elements = append(elements, &object.Integer{Value: i})
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+/*
+enumerate(arr): [添字, 要素] の組の配列を返す
+*/
+func enumerateBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	elements, err := iterableArgument(config, "argument to `enumerate`", args[0])
+	if err != nil {
+		return err
+	}
+
+	pairs := make([]object.Object, len(elements))
+	for i, el := range elements {
+		pairs[i] = &object.Array{Elements: []object.Object{&object.Integer{Value: int64(i)}, el}}
+	}
+
+	return &object.Array{Elements: pairs}
+}
+
+/*
+zip(a, b): 2つの配列の同じ位置の要素を組にした配列を返す。長さは短い方に合わせる
+*/
+func zipBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	left, err := iterableArgument(config, "first argument to `zip`", args[0])
+	if err != nil {
+		return err
+	}
+	right, err := iterableArgument(config, "second argument to `zip`", args[1])
+	if err != nil {
+		return err
+	}
+
+	length := len(left)
+	if len(right) < length {
+		length = len(right)
+	}
+
+	pairs := make([]object.Object, length)
+	for i := 0; i < length; i++ {
+		pairs[i] = &object.Array{Elements: []object.Object{left[i], right[i]}}
+	}
+
+	return &object.Array{Elements: pairs}
+}
@@ -0,0 +1,89 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"time"
+)
+
+/*
+時刻の組み込み関数。時刻はUNIX時間のミリ秒を表す整数で扱い、書式はGoのレイアウト文字列で指定する
+*/
+func init() {
+	builtins["now"] = &object.Builtin{Fn: nowBuiltin}
+	builtins["sleep"] = &object.Builtin{Fn: sleepBuiltin}
+	builtins["formatTime"] = &object.Builtin{Fn: formatTimeBuiltin}
+	builtins["parseTime"] = &object.Builtin{Fn: parseTimeBuiltin}
+}
+
+/*
+now(): 現在時刻をUNIX時間のミリ秒で返す
+*/
+func nowBuiltin(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &object.Integer{Value: time.Now().UnixMilli()}
+}
+
+/*
+sleep(ms): 指定したミリ秒だけ待つ
+*/
+func sleepBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `sleep` must be INTEGER, got %s", args[0].Type())
+	}
+	if ms.Value < 0 {
+		return newErrorOf(object.ValueError, "sleep duration must not be negative: %d", ms.Value)
+	}
+
+	time.Sleep(time.Duration(ms.Value) * time.Millisecond)
+
+	return NULL
+}
+
+/*
+formatTime(ts, layout): UNIX時間のミリ秒をUTCの時刻として書式化する
+*/
+func formatTimeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	ts, ok := args[0].(*object.Integer)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `formatTime` must be INTEGER, got %s", args[0].Type())
+	}
+	layout, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "second argument to `formatTime` must be STRING, got %s", args[1].Type())
+	}
+
+	return &object.String{Value: time.UnixMilli(ts.Value).UTC().Format(layout.Value)}
+}
+
+/*
+parseTime(s, layout): 時刻の文字列を解析してUNIX時間のミリ秒を返す。タイムゾーンがなければUTCとみなす
+*/
+func parseTimeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `parseTime` must be STRING, got %s", args[0].Type())
+	}
+	layout, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "second argument to `parseTime` must be STRING, got %s", args[1].Type())
+	}
+
+	t, err := time.Parse(layout.Value, str.Value)
+	if err != nil {
+		return newErrorOf(object.ValueError, "cannot parse time %q with layout %q", str.Value, layout.Value)
+	}
+
+	return &object.Integer{Value: t.UnixMilli()}
+}
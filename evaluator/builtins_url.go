@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"net/url"
+	"sort"
+)
+
+/*
+URLの組み込み関数
+*/
+func init() {
+	builtins["urlParse"] = &object.Builtin{Fn: urlParseBuiltin}
+	builtins["urlEncode"] = &object.Builtin{Fn: urlEncodeBuiltin}
+	builtins["urlDecode"] = &object.Builtin{Fn: urlDecodeBuiltin}
+}
+
+/*
+urlParse(s): URLを {"scheme", "host", "port", "path", "query", "fragment"} のハッシュにする。
+queryはパラメータ名から値へのハッシュで、同じ名前が複数ある場合は値を配列にする
+*/
+func urlParseBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `urlParse` must be STRING, got %s", args[0].Type())
+	}
+
+	u, err := url.Parse(str.Value)
+	if err != nil {
+		return newErrorOf(object.ValueError, "cannot parse url: %s", err)
+	}
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]object.Object, len(names))
+	for i, name := range names {
+		if len(query[name]) == 1 {
+			values[i] = &object.String{Value: query[name][0]}
+			continue
+		}
+		elements := make([]object.Object, len(query[name]))
+		for j, v := range query[name] {
+			elements[j] = &object.String{Value: v}
+		}
+		values[i] = &object.Array{Elements: elements}
+	}
+
+	return newStringHash(
+		[]string{"scheme", "host", "port", "path", "query", "fragment"},
+		[]object.Object{
+			&object.String{Value: u.Scheme},
+			&object.String{Value: u.Hostname()},
+			&object.String{Value: u.Port()},
+			&object.String{Value: u.Path},
+			newStringHash(names, values),
+			&object.String{Value: u.Fragment},
+		},
+	)
+}
+
+/*
+urlEncode(s): URLのクエリで使えるように文字列をエスケープする
+*/
+func urlEncodeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `urlEncode` must be STRING, got %s", args[0].Type())
+	}
+
+	return &object.String{Value: url.QueryEscape(str.Value)}
+}
+
+/*
+urlDecode(s): urlEncode でエスケープした文字列を元に戻す
+*/
+func urlDecodeBuiltin(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `urlDecode` must be STRING, got %s", args[0].Type())
+	}
+
+	decoded, err := url.QueryUnescape(str.Value)
+	if err != nil {
+		return newErrorOf(object.ValueError, "cannot decode url: %s", err)
+	}
+	return &object.String{Value: decoded}
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+class文からクラスオブジェクトを生成
+*/
+func newClass(node *ast.ClassStatement, env *object.Environment) *object.Class {
+	constructor := node.Constructor
+	methods := make(map[string]*ast.FunctionLiteral)
+	for _, m := range node.Methods {
+		methods[m.Name.Value] = m.Function
+	}
+
+	return &object.Class{
+		Name: node.Name.Value,
+		Constructor: &object.Function{
+			Parameters: constructor.Parameters,
+			Variadic:   constructor.Variadic,
+			Defaults:   constructor.Defaults,
+			Body:       constructor.Body,
+			Env:        env,
+			Slots:      constructor.Slots(),
+		},
+		Methods: methods,
+		Env:     env,
+	}
+}
+
+/*
+クラスのインスタンスを生成。コンストラクタの引数とlet文で定義されたフィールドをインスタンスのフィールドにする。
+フィールド定義の中ではselfで生成中のインスタンスを参照できる
+*/
+func instantiate(
+	class *object.Class,
+	args []object.Object,
+	named []namedArgument,
+) object.Object {
+	instance := &object.Instance{Class: class, Fields: make(map[string]object.Object)}
+
+	env, err := extendFunctionEnv(class.Constructor, args, named)
+	if err != nil {
+		return err
+	}
+	env.Set("self", instance)
+	captureFields(instance, env)
+
+	// フィールドは定義順に評価し、後のフィールドから self.name で参照できるようにする
+	for _, stmt := range class.Constructor.Body.Statements {
+		result := Eval(stmt, env)
+		if isError(result) {
+			return result
+		}
+		captureFields(instance, env)
+	}
+
+	return instance
+}
+
+/*
+コンストラクタの環境に束縛された名前をインスタンスのフィールドにコピーする
+*/
+func captureFields(instance *object.Instance, env *object.Environment) {
+	for _, name := range env.Names() {
+		if name != "self" {
+			instance.Fields[name], _ = env.Get(name)
+		}
+	}
+}
+
+/*
+インスタンスのメンバーを評価。フィールドがなければselfを束縛したメソッドを返す
+*/
+func evalInstanceMember(instance *object.Instance, name string) object.Object {
+	if val, ok := instance.Fields[name]; ok {
+		return val
+	}
+
+	method, ok := instance.Class.Methods[name]
+	if !ok {
+		return newErrorOf(object.NameError, "undefined property %s for %s", name, instance.Class.Name)
+	}
+
+	env := object.NewEnclosedEnvironment(instance.Class.Env)
+	env.Set("self", instance)
+
+	return &object.Function{
+		Parameters: method.Parameters,
+		Variadic:   method.Variadic,
+		Defaults:   method.Defaults,
+		Body:       method.Body,
+		Env:        env,
+		Generator:  method.Generator,
+		Slots:      method.Slots(),
+	}
+}
@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+spawn式を評価。呼び出す関数と引数は現在の goroutine で評価し、呼び出しだけを新しい goroutine で実行する。
+呼び出しの結果を一度だけ受信できるチャネルを返す
+*/
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	var function object.Object
+	args := []object.Object{}
+	var named []namedArgument
+
+	if call, ok := node.Call.(*ast.CallExpression); ok {
+		function = Eval(call.Function, env)
+		if isError(function) {
+			return function
+		}
+		args = evalCallArguments(call.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if len(call.NamedArguments) > 0 {
+			var err object.Object
+			named, err = evalNamedArguments(call.NamedArguments, env)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		function = Eval(node.Call, env)
+		if isError(function) {
+			return function
+		}
+	}
+
+	result := &object.Channel{Value: make(chan object.Object, 1)}
+	// 別の goroutine のパニックは呼び出し元で回復できないので、ここでエラーオブジェクトにする
+	go func() {
+		var value object.Object
+		func() {
+			defer recoverPanic(&value)
+			value = applyFunctionWithNamed(function, args, named)
+		}()
+		result.Value <- value
+	}()
+
+	return result
+}
+
+/*
+チャネルを生成する。引数にバッファの大きさを指定できる
+*/
+func channel(args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	size := int64(0)
+	if len(args) == 1 {
+		integer, ok := args[0].(*object.Integer)
+		if !ok {
+			return newErrorOf(object.TypeError, "argument to `channel` must be INTEGER, got %s", args[0].Type())
+		}
+		if integer.Value < 0 {
+			return newErrorOf(object.ValueError, "channel size must not be negative: %d", integer.Value)
+		}
+		size = integer.Value
+	}
+
+	return &object.Channel{Value: make(chan object.Object, size)}
+}
+
+/*
+チャネルに値を送信する。受信側が受け取るまで待つ
+*/
+func send(args ...object.Object) (result object.Object) {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `send` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	// 閉じたチャネルへの送信は Go では panic になるのでエラーに変換する
+	defer func() {
+		if recover() != nil {
+			result = newError("send on closed channel")
+		}
+	}()
+	ch.Value <- args[1]
+
+	return NULL
+}
+
+/*
+チャネルから値を受信する。チャネルが閉じている場合はNULLを返す
+*/
+func recv(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `recv` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	val, ok := <-ch.Value
+	if !ok {
+		return NULL
+	}
+
+	return val
+}
+
+/*
+チャネルを閉じる
+*/
+func closeChannel(args ...object.Object) (result object.Object) {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `close` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	defer func() {
+		if recover() != nil {
+			result = newError("close of closed channel")
+		}
+	}()
+	close(ch.Value)
+
+	return NULL
+}
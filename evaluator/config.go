@@ -0,0 +1,49 @@
+package evaluator
+
+import "monkey/object"
+
+/*
+評価の設定を受け取る組み込み関数の本体
+*/
+type configuredFunction func(config object.Config, args ...object.Object) object.Object
+
+/*
+評価の設定によって動作が変わる組み込み関数。環境から名前で探すときに、その環境の Config に合わせた組み込み関数にする
+*/
+var configuredBuiltins = map[string]configuredFunction{}
+
+/*
+評価の設定によって動作が変わる組み込み関数を登録する。設定のない環境からは制限のないものとして使う
+*/
+func registerConfigured(name string, fn configuredFunction) {
+	configuredBuiltins[name] = fn
+	builtins[name] = configuredBuiltin(fn, object.Config{})
+}
+
+/*
+config に合わせた組み込み関数を生成
+*/
+func configuredBuiltin(fn configuredFunction, config object.Config) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return fn(config, args...)
+		},
+	}
+}
+
+/*
+名前で組み込み関数を探し、env の Config と Policy に合わせる
+*/
+func environmentBuiltin(name string, env *object.Environment) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+
+	if fn, ok := configuredBuiltins[name]; ok {
+		if config := env.Config(); config != (object.Config{}) {
+			builtin = configuredBuiltin(fn, config)
+		}
+	}
+	return restrictBuiltin(name, builtin, env), true
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+ctx が終了するまで評価する。関数呼び出しと末尾呼び出しの繰り返しのたびに ctx を確認し、
+終了していれば評価を打ち切ってエラーオブジェクトを返す。spawn で実行中の呼び出しも打ち切る
+*/
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	prev := env.SetContext(ctx)
+	defer env.SetContext(prev)
+	defer env.BeginEvaluation()()
+
+	if err := checkContext(env); err != nil {
+		return err
+	}
+	return Eval(node, env)
+}
+
+/*
+環境にセットされたコンテキストが終了していればエラーを返す
+*/
+func checkContext(env *object.Environment) *object.Error {
+	ctx := env.Context()
+	if ctx == nil {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return canceledError(ctx)
+	default:
+		return nil
+	}
+}
+
+/*
+ctx の終了で評価を打ち切ったことを表すエラーを生成
+*/
+func canceledError(ctx context.Context) *object.Error {
+	return newErrorOf(object.LimitError, "evaluation canceled: %s", ctx.Err())
+}
@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+分割代入のlet文を評価
+*/
+func evalDestructuringLet(
+	node *ast.LetStatement,
+	env *object.Environment,
+) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	var bindings []patternBinding
+	var err *object.Error
+
+	switch pattern := node.Pattern.(type) {
+	case *ast.ArrayPattern:
+		bindings, err = destructureArray(pattern, val)
+	case *ast.HashPattern:
+		bindings, err = destructureHash(pattern, val)
+	default:
+		err = newError("unsupported let target: %s", node.Pattern.String())
+	}
+	if err != nil {
+		return err
+	}
+
+	// 定数を上書きする束縛が1つでもあれば何も束縛しない
+	for _, b := range bindings {
+		if isConstant(env, b.ident) {
+			return newErrorOf(object.NameError, "cannot redeclare constant: %s", b.ident.Value)
+		}
+	}
+	for _, b := range bindings {
+		bind(env, b.ident, b.value, false)
+	}
+
+	return nil
+}
+
+/*
+パターンの識別子と、それに束縛する値。同じ識別子が複数あれば後のものを束縛する
+*/
+type patternBinding struct {
+	ident *ast.Identifier
+	value object.Object
+}
+
+/*
+配列を分割して識別子ごとの値を返す。
+...rest がない場合は要素数が一致しなければエラー、ある場合は不足する要素をNULLで補う
+*/
+func destructureArray(
+	pattern *ast.ArrayPattern,
+	val object.Object,
+) ([]patternBinding, *object.Error) {
+	array, ok := val.(*object.Array)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "cannot destructure %s as ARRAY", val.Type())
+	}
+
+	elements := array.Elements
+	if pattern.Rest == nil && len(elements) != len(pattern.Elements) {
+		return nil, newErrorOf(object.ValueError, "wrong number of values to destructure. got=%d, want=%d",
+			len(elements), len(pattern.Elements))
+	}
+
+	bindings := make([]patternBinding, 0, len(pattern.Elements)+1)
+	for i, ident := range pattern.Elements {
+		if i < len(elements) {
+			bindings = append(bindings, patternBinding{ident, elements[i]})
+		} else {
+			bindings = append(bindings, patternBinding{ident, NULL})
+		}
+	}
+
+	if pattern.Rest != nil {
+		rest := []object.Object{}
+		if len(elements) > len(pattern.Elements) {
+			rest = append(rest, elements[len(pattern.Elements):]...)
+		}
+		bindings = append(bindings, patternBinding{pattern.Rest, &object.Array{Elements: rest}})
+	}
+
+	return bindings, nil
+}
+
+/*
+ハッシュを分割して識別子ごとの値を返す。識別子名を文字列キーとして値を取り出し、存在しないキーはNULLを束縛する
+*/
+func destructureHash(
+	pattern *ast.HashPattern,
+	val object.Object,
+) ([]patternBinding, *object.Error) {
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "cannot destructure %s as HASH", val.Type())
+	}
+
+	bindings := make([]patternBinding, 0, len(pattern.Keys))
+	for _, ident := range pattern.Keys {
+		key := &object.String{Value: ident.Value}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			bindings = append(bindings, patternBinding{ident, pair.Value})
+		} else {
+			bindings = append(bindings, patternBinding{ident, NULL})
+		}
+	}
+
+	return bindings, nil
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+/*
+評価器以外の実行方式から、評価器と同じ意味で演算を行うための関数。
+バイトコードの仮想マシンは演算をこれらに任せて、評価器と同じ結果とエラーを返す
+*/
+
+/*
+前置演算子を config に従って適用
+*/
+func EvalPrefix(operator string, right object.Object, config object.Config) object.Object {
+	return evalPrefixExpression(operator, right, config)
+}
+
+/*
+中置演算子を config に従って適用
+*/
+func EvalInfix(operator string, left, right object.Object, config object.Config) object.Object {
+	return evalInfixExpression(operator, left, right, config)
+}
+
+/*
+添字式を評価
+*/
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+/*
+メンバー式を評価
+*/
+func EvalMember(obj object.Object, property string) object.Object {
+	return evalMemberExpression(obj, property)
+}
+
+/*
+値が真かどうか判定。nullとfalse以外は真
+*/
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+/*
+値そのもののおおよその大きさ。Config の MaxAllocation に対して数える
+*/
+func AllocationSize(obj object.Object) int64 {
+	return allocationSize(obj)
+}
+
+/*
+組み込み関数の戻り値のうち、新しく作られたとみなす大きさ。Config の MaxAllocation に対して数える
+*/
+func BuiltinAllocationSize(result object.Object, args []object.Object) int64 {
+	return builtinAllocationSize(result, args)
+}
+
+/*
+組み込み関数を呼び出す。パニックした場合はエラーオブジェクトを返す
+*/
+func CallBuiltin(fn *object.Builtin, args []object.Object) object.Object {
+	return callBuiltin(fn, args)
+}
+
+/*
+名前から組み込み関数を取得
+*/
+func Builtin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+/*
+環境ごとの Policy や Config によって変わる組み込み関数かどうか判定
+*/
+func IsRestricted(name string) bool {
+	_, restricted := capabilities[name]
+	_, configured := configuredBuiltins[name]
+	return restricted || configured
+}
+
+/*
+名前から組み込み関数を取得し、env の Config に合わせ、Policy で許可されていない操作を行うものは制限する
+*/
+func EnvironmentBuiltin(name string, env *object.Environment) (*object.Builtin, bool) {
+	return environmentBuiltin(name, env)
+}
+
+/*
+関数に引数を適用する。組み込み関数やクラス、評価器で定義された関数のいずれも呼び出せる
+*/
+func Apply(fn object.Object, args []object.Object) object.Object {
+	return applyFunction(fn, args)
+}
@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"bytes"
+	"monkey/object"
+)
+
+/*
+2つのオブジェクトが値として等しいかどうか判定。配列とハッシュは要素を再帰的に比較する
+*/
+func objectsEqual(left, right object.Object) bool {
+	return deepEqual(left, right, map[comparison]bool{})
+}
+
+/*
+比較中のオブジェクトの組
+*/
+type comparison struct {
+	left, right object.Object
+}
+
+/*
+再帰的に値を比較する。比較中の組に再び出会った場合は循環とみなして等しいものとする
+*/
+func deepEqual(left, right object.Object, visiting map[comparison]bool) bool {
+	if left == right {
+		return true
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.BigInteger:
+		return left.Value.Cmp(right.(*object.BigInteger).Value) == 0
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Boolean:
+		return left.Value == right.(*object.Boolean).Value
+	case *object.Null:
+		return true
+	case *object.Bytes:
+		return bytes.Equal(left.Value, right.(*object.Bytes).Value)
+	case *object.Set:
+		other := right.(*object.Set)
+		if len(left.Elements) != len(other.Elements) {
+			return false
+		}
+		for key := range left.Elements {
+			if _, ok := other.Elements[key]; !ok {
+				return false
+			}
+		}
+		return true
+	case *object.Range:
+		r := right.(*object.Range)
+		return left.Start == r.Start && left.End == r.End
+	case *object.Array:
+		pair := comparison{left, right}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		return arraysEqual(left, right.(*object.Array), visiting)
+	case *object.Hash:
+		pair := comparison{left, right}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		return hashesEqual(left, right.(*object.Hash), visiting)
+	default:
+		return false
+	}
+}
+
+func arraysEqual(left, right *object.Array, visiting map[comparison]bool) bool {
+	if len(left.Elements) != len(right.Elements) {
+		return false
+	}
+
+	for i, el := range left.Elements {
+		if !deepEqual(el, right.Elements[i], visiting) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashesEqual(left, right *object.Hash, visiting map[comparison]bool) bool {
+	if len(left.Pairs) != len(right.Pairs) {
+		return false
+	}
+
+	for key, pair := range left.Pairs {
+		other, ok := right.Pairs[key]
+		if !ok || !deepEqual(pair.Value, other.Value, visiting) {
+			return false
+		}
+	}
+
+	return true
+}
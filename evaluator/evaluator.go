@@ -2,17 +2,49 @@ package evaluator
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	// 最も外側の環境でプログラムを評価するたびに、手数と作った値の大きさを数え直す
+	if _, ok := node.(*ast.Program); ok && env != nil && env.Root() == env {
+		defer env.BeginEvaluation()()
+	}
+
+	var result object.Object
+	if err := step(env); err != nil {
+		result = err
+	} else {
+		result = evalNode(node, env)
+	}
+
+	if env != nil && allocates(node) {
+		if err := allocate(env, allocationSize(result)); err != nil {
+			result = err
+		}
+	}
+
+	// 最も内側で評価したノードの位置をエラーに記録する
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+/*
+ノードの種類ごとに評価する
+*/
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// プログラム
 	case *ast.Program:
@@ -34,11 +66,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
+	// nullリテラル
+	case *ast.NullLiteral:
+		return NULL
+
 	// 関数リテラル
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return evalFunctionLiteral(node, env)
 
 	// 配列リテラル
 	case *ast.ArrayLiteral:
@@ -58,10 +92,15 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env.Config())
 
 	// 中置式
 	case *ast.InfixExpression:
+		// null合体演算子は右辺を短絡評価する
+		if node.Operator == "??" {
+			return evalCoalesceExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -71,7 +110,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env.Config())
 
 	// 添字式
 	case *ast.IndexExpression:
@@ -85,6 +124,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalIndexExpression(left, index)
 
+	// スライス式
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	// メンバー式
+	case *ast.MemberExpression:
+		obj := Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value)
+
 	// ブロック文
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
@@ -93,18 +144,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	// match式
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, Eval)
+
 	// 呼び出し式
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
+		return evalCallExpression(node, env, false)
 
 	// return文
 	case *ast.ReturnStatement:
@@ -116,11 +162,50 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	// let文
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return evalDestructuringLet(node, env)
+		}
+		if isConstant(env, node.Name) {
+			return newErrorOf(object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		bind(env, node.Name, val, false)
+
+	// 関数宣言文
+	case *ast.FunctionStatement:
+		if isConstant(env, node.Name) {
+			return newErrorOf(object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
+		bind(env, node.Name, evalFunctionLiteral(node.Function, env), false)
+
+	// class文
+	case *ast.ClassStatement:
+		if isConstant(env, node.Name) {
+			return newErrorOf(object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
+		bind(env, node.Name, newClass(node, env), false)
+
+	// const文
+	case *ast.ConstStatement:
+		if isConstant(env, node.Name) {
+			return newErrorOf(object.NameError, "cannot redeclare constant: %s", node.Name.Value)
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		bind(env, node.Name, val, true)
+
+	// spawn式
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	// yield式
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
 
 	// 識別子
 	case *ast.Identifier:
@@ -130,6 +215,101 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+/*
+関数呼び出しから返ったエラーに呼び出した関数の名前を積む
+*/
+func withCallFrame(result object.Object, call *ast.CallExpression) object.Object {
+	err, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	// 呼び出し自体の誤りで関数の本体に入っていないエラーには積まない
+	if !err.Pos.IsValid() {
+		return err
+	}
+
+	err.Stack = append(err.Stack, callName(call.Function))
+	return err
+}
+
+/*
+呼び出し式を評価。tail が真なら末尾位置の呼び出しとして、ユーザー定義関数は呼び出さずに tailCall を返す
+*/
+func evalCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	function := Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalCallArguments(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) && !catchesErrors(function) {
+		return args[0]
+	}
+
+	var named []namedArgument
+	if len(node.NamedArguments) > 0 {
+		var err object.Object
+		named, err = evalNamedArguments(node.NamedArguments, env)
+		if err != nil {
+			return err
+		}
+	}
+
+	if fn, ok := function.(*object.Function); ok && tail && !fn.Generator {
+		return &tailCall{fn: fn, args: args, named: named, call: node}
+	}
+	result := applyFunctionWithNamed(function, args, named)
+	if _, ok := function.(*object.Builtin); ok && env.Config().MaxAllocation > 0 {
+		if err := allocate(env, builtinAllocationSize(result, args)); err != nil {
+			return err
+		}
+	}
+	return withCallFrame(result, node)
+}
+
+/*
+呼び出し式から関数の名前を取得する
+*/
+func callName(fn ast.Expression) string {
+	switch fn := fn.(type) {
+	case *ast.Identifier:
+		return fn.Value
+	case *ast.MemberExpression:
+		return fn.Property.Value
+	}
+	return "<anonymous>"
+}
+
+/*
+引数のエラーを受け取る組み込み関数かどうか判定
+*/
+func catchesErrors(fn object.Object) bool {
+	builtin, ok := fn.(*object.Builtin)
+	return ok && builtin.CatchErrors
+}
+
+/*
+関数リテラルを評価。名前付きの場合は自身の名前を束縛した環境を閉じ込める
+*/
+func evalFunctionLiteral(node *ast.FunctionLiteral, env *object.Environment) object.Object {
+	fn := &object.Function{
+		Parameters: node.Parameters,
+		Variadic:   node.Variadic,
+		Defaults:   node.Defaults,
+		Env:        env,
+		Body:       node.Body,
+		Generator:  node.Generator,
+		Slots:      node.Slots(),
+	}
+
+	if node.Name != nil {
+		fn.Env = object.NewEnclosedEnvironment(env)
+		fn.Env.Set(node.Name.Value, fn)
+	}
+
+	return fn
+}
+
 /*
 プログラムを評価
 */
@@ -170,14 +350,16 @@ func evalStatements(stmts []ast.Statement, env *object.Environment) object.Objec
 	return result
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, config object.Config) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, config)
+	case "typeof":
+		return &object.String{Value: string(right.Type())}
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newErrorOf(object.TypeError, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -194,9 +376,19 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+func evalMinusPrefixOperatorExpression(right object.Object, config object.Config) object.Object {
+	if bigInt, ok := right.(*object.BigInteger); ok {
+		return newBigInteger(new(big.Int).Neg(bigInt.Value))
+	}
+	if config.Overflow == object.OverflowPromote && isMinInt64(right) {
+		return newBigInteger(new(big.Int).Neg(toBigInt(right)))
+	}
+	if config.Overflow == object.OverflowRaise && isMinInt64(right) {
+		return newErrorOf(object.OverflowError, "integer overflow: -%s", right.Inspect())
+	}
+
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newErrorOf(object.TypeError, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -205,28 +397,119 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 }
 
 /*
-中置式を評価
+中置式を評価。config は整数演算のオーバーフローの扱いと、文字列や配列の繰り返しで作る値の大きさの上限に使う
 */
 func evalInfixExpression(
 	operator string,
 	left, right object.Object,
+	config object.Config,
 ) object.Object {
 	switch {
+	// 所属判定は右辺の型で分岐する
+	case operator == "in":
+		return evalInExpression(left, right)
+	// どちらかが多倍長整数の場合
+	case isInteger(left) && isInteger(right) &&
+		(left.Type() == object.BIG_INTEGER_OBJ || right.Type() == object.BIG_INTEGER_OBJ):
+		return evalBigIntegerInfixExpression(operator, left, right)
 	// 左辺、右辺共に整数の場合
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		// 整数同士を評価して結果を返す
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, config)
 	// 左辺、右辺共に文字列の場合
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	// 左辺、右辺共に配列の場合
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		return evalArrayInfixExpression(operator, left, right)
+	// 左辺、右辺共にハッシュの場合
+	case left.Type() == object.HASH_OBJ && right.Type() == object.HASH_OBJ:
+		return evalHashInfixExpression(operator, left, right)
+	// 文字列・配列と整数の乗算は繰り返しになる
+	case operator == "*" && isRepeatable(left) && right.Type() == object.INTEGER_OBJ:
+		return evalRepetitionExpression(left, right.(*object.Integer).Value, config)
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && isRepeatable(right):
+		return evalRepetitionExpression(right, left.(*object.Integer).Value, config)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorOf(object.TypeError, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+/*
+null合体式を評価。左辺がNULLの場合のみ右辺を評価する
+*/
+func evalCoalesceExpression(
+	node *ast.InfixExpression,
+	env *object.Environment,
+) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if left != NULL {
+		return left
+	}
+
+	return Eval(node.Right, env)
+}
+
+/*
+in式を評価
+*/
+func evalInExpression(left, right object.Object) object.Object {
+	switch right := right.(type) {
+	// 配列の場合は要素に等しい値があるか
+	case *object.Array:
+		for _, element := range right.Elements {
+			if objectsEqual(left, element) {
+				return TRUE
+			}
+		}
+		return FALSE
+
+	// ハッシュの場合はキーが存在するか
+	case *object.Hash:
+		key, ok := left.(object.Hashable)
+		if !ok {
+			return newErrorOf(object.TypeError, "unusable as hash key: %s", left.Type())
+		}
+		_, ok = right.Pairs[key.HashKey()]
+		return nativeBoolToBooleanObject(ok)
+
+	// 集合の場合は要素に含まれるか
+	case *object.Set:
+		key, ok := left.(object.Hashable)
+		if !ok {
+			return newErrorOf(object.TypeError, "unusable as set element: %s", left.Type())
+		}
+		_, ok = right.Elements[key.HashKey()]
+		return nativeBoolToBooleanObject(ok)
+
+	// 文字列の場合は部分文字列か
+	case *object.String:
+		str, ok := left.(*object.String)
+		if !ok {
+			return newErrorOf(object.TypeError, "type mismatch: %s in %s", left.Type(), right.Type())
+		}
+		return nativeBoolToBooleanObject(strings.Contains(right.Value, str.Value))
+
+	// 範囲の場合は範囲内の整数か
+	case *object.Range:
+		integer, ok := left.(*object.Integer)
+		if !ok {
+			return FALSE
+		}
+		return nativeBoolToBooleanObject(
+			integer.Value >= right.Start && integer.Value < right.End)
+
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorOf(object.TypeError, "unknown operator: %s in %s", left.Type(), right.Type())
 	}
 }
 
@@ -242,8 +525,59 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	// ハッシュの場合
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+
+	// 文字列の場合
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
+
+	// 範囲の場合
+	case left.Type() == object.RANGE_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalRangeIndexExpression(left, index)
+
+	// バイト列の場合
+	case left.Type() == object.BYTES_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalBytesIndexExpression(left, index)
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newErrorOf(object.TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+/*
+メンバー式を評価。ハッシュのキーを優先し、見つからなければ型のメソッドを探す
+*/
+func evalMemberExpression(obj object.Object, property string) object.Object {
+	// ハッシュの場合は文字列キーで値を取り出す
+	if hash, ok := obj.(*object.Hash); ok {
+		key := &object.String{Value: property}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			return pair.Value
+		}
+	}
+
+	// インスタンスの場合はフィールド、メソッドの順に探す
+	if instance, ok := obj.(*object.Instance); ok {
+		return evalInstanceMember(instance, property)
+	}
+
+	// 束縛したGoの値の場合はメソッド、フィールドの順に探す
+	if g, ok := obj.(*object.GoObject); ok {
+		if member, ok := g.Member(property); ok {
+			return member
+		}
+		return newErrorOf(object.NameError, "undefined property %s for %s", property, g.Value.Type())
+	}
+
+	if method, ok := lookupMethod(obj, property); ok {
+		return method
+	}
+
+	switch obj.Type() {
+	case object.HASH_OBJ:
+		return NULL
+	case object.STRING_OBJ, object.ARRAY_OBJ:
+		return newErrorOf(object.NameError, "undefined method %s for %s", property, obj.Type())
+	default:
+		return newErrorOf(object.TypeError, "property access not supported: %s", obj.Type())
 	}
 }
 
@@ -253,12 +587,29 @@ func evalIndexExpression(left, index object.Object) object.Object {
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
+	config object.Config,
 ) object.Object {
 	// 左辺の値を取り出す
 	leftVal := left.(*object.Integer).Value
 	// 右辺の値を取り出す
 	rightVal := right.(*object.Integer).Value
 
+	// オーバーフローした場合は多倍長整数で計算し直すか、エラーにする
+	if config.Overflow != object.OverflowWrap {
+		switch operator {
+		case "+", "-", "*", "/":
+			if rightVal == 0 && operator == "/" {
+				break
+			}
+			if _, ok := checkedIntegerArithmetic(operator, leftVal, rightVal); !ok {
+				if config.Overflow == object.OverflowRaise {
+					return newOverflowError(operator, leftVal, rightVal)
+				}
+				return evalBigIntegerInfixExpression(operator, left, right)
+			}
+		}
+	}
+
 	// 演算子で分岐
 	switch operator {
 	case "+":
@@ -268,6 +619,9 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newErrorOf(object.ZeroDivisionError, "division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -277,8 +631,10 @@ func evalIntegerInfixExpression(
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "..":
+		return &object.Range{Start: leftVal, End: rightVal}
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -289,14 +645,103 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s",
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	// 比較は辞書順で行う
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+/*
+配列同士の中置式を評価。+ は両辺を連結した新しい配列を返し、== と != は要素を再帰的に比較する
+*/
+func evalArrayInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftElements := left.(*object.Array).Elements
+	rightElements := right.(*object.Array).Elements
+
+	switch operator {
+	case "+":
+		elements := make([]object.Object, 0, len(leftElements)+len(rightElements))
+		elements = append(elements, leftElements...)
+		elements = append(elements, rightElements...)
+		return &object.Array{Elements: elements}
+	case "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
+	default:
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
+}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+/*
+ハッシュ同士の中置式を評価。== と != はキーと値を再帰的に比較する
+*/
+func evalHashInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	switch operator {
+	case "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
+	default:
+		return newErrorOf(object.TypeError, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+/*
+繰り返しの対象にできる型かどうか判定
+*/
+func isRepeatable(obj object.Object) bool {
+	return obj.Type() == object.STRING_OBJ || obj.Type() == object.ARRAY_OBJ
+}
+
+/*
+文字列または配列をcount回繰り返したものを生成
+*/
+func evalRepetitionExpression(obj object.Object, count int64, config object.Config) object.Object {
+	if count < 0 {
+		return newErrorOf(object.ValueError, "negative repetition count: %d", count)
+	}
+
+	switch obj := obj.(type) {
+	case *object.String:
+		if err := checkAllocation(config, count, int64(len(obj.Value))); err != nil {
+			return err
+		}
+		return &object.String{Value: strings.Repeat(obj.Value, int(count))}
+	default:
+		elements := obj.(*object.Array).Elements
+		if err := checkAllocation(config, count, int64(len(elements))*elementSize); err != nil {
+			return err
+		}
+		repeated := make([]object.Object, 0, len(elements)*int(count))
+		for i := int64(0); i < count; i++ {
+			repeated = append(repeated, elements...)
+		}
+		return &object.Array{Elements: repeated}
+	}
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -350,18 +795,28 @@ func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
+	// 解決済みの識別子はスロットから直接取得する。未束縛なら、スロットの環境までは
+	// 同じ名前が束縛されていないことが解決パスで分かっているので、その外側から名前で探す
+	depth, slot, ok := node.Slot()
+	if ok {
+		if val, ok := env.GetAt(depth, slot); ok {
+			return val
+		}
+		depth++
+	}
+
 	// 環境から識別子を取得
-	if val, ok := env.Get(node.Value); ok {
+	if val, ok := env.GetFrom(depth, node.Value); ok {
 		return val
 	}
 
-	// 組み込み関数を探す
-	if builtin, ok := builtins[node.Value]; ok {
+	// 組み込み関数を探す。環境の設定に合わせ、許可されていない操作を行うものは制限する
+	if builtin, ok := environmentBuiltin(node.Value, env); ok {
 		return builtin
 	}
 
 	// 何も見つからなかった場合はエラーオブジェクトを返す
-	return newError("identifier not found: " + node.Value)
+	return newErrorOf(object.NameError, "identifier not found: %s", node.Value)
 }
 
 /*
@@ -384,6 +839,78 @@ func evalExpressions(
 	return result
 }
 
+/*
+呼び出し式の引数を全て評価。スプレッド式はイテラブルなオブジェクトの要素を展開して位置引数にする
+*/
+func evalCallArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	result := []object.Object{}
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := Eval(spread.Value, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		iterable, ok := evaluated.(object.Iterable)
+		if !ok {
+			return []object.Object{newErrorOf(object.TypeError, "cannot spread %s", evaluated.Type())}
+		}
+		elements, err := iterableElements(iterable, env.Config())
+		if err != nil {
+			return []object.Object{err}
+		}
+		result = append(result, elements...)
+	}
+
+	return result
+}
+
+/*
+名前付き引数
+*/
+type namedArgument struct {
+	name  string
+	value object.Object
+}
+
+/*
+名前付き引数を全て評価。同じ名前が重複している場合はエラーを返す
+*/
+func evalNamedArguments(
+	args []*ast.NamedArgument,
+	env *object.Environment,
+) ([]namedArgument, object.Object) {
+	result := []namedArgument{}
+
+	for _, arg := range args {
+		for _, n := range result {
+			if n.name == arg.Name.Value {
+				return nil, newErrorOf(object.ArgumentError, "duplicate argument: %s", arg.Name.Value)
+			}
+		}
+
+		evaluated := Eval(arg.Value, env)
+		if isError(evaluated) {
+			return nil, evaluated
+		}
+		result = append(result, namedArgument{name: arg.Name.Value, value: evaluated})
+	}
+
+	return result, nil
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -411,43 +938,239 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+/*
+種類を指定してエラーを生成
+*/
+func newErrorOf(kind object.ErrorKind, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
 /*
 関数を適用する
 */
 func applyFunction(fn object.Object, args []object.Object) object.Object {
+	return applyFunctionWithNamed(fn, args, nil)
+}
+
+/*
+評価の手数を数え、最も外側の環境の Config の MaxSteps を超えていればエラーを返す。
+手数は最も外側の環境での評価ごとに数え、超えるとその評価の残りはすべてエラーになる
+*/
+func step(env *object.Environment) *object.Error {
+	if env == nil {
+		return nil
+	}
+	if max := env.Config().MaxSteps; max > 0 && env.Step() > max {
+		return newErrorOf(object.LimitError, "step limit exceeded: %d", max)
+	}
+	return nil
+}
+
+/*
+関数の定義された環境で実行中の呼び出しを数え、Config の MaxCallDepth を超えているか評価が打ち切られていればエラーを返す。
+エラーでなければ呼び出しの終わりに leave を呼ぶ
+*/
+func enterCall(env *object.Environment) (leave func(), err *object.Error) {
+	if env == nil {
+		return func() {}, nil
+	}
+	root := env.Root()
+	if err := checkContext(root); err != nil {
+		return nil, err
+	}
+	max := root.Config().MaxCallDepth
+	if max == 0 {
+		max = object.DefaultMaxCallDepth
+	}
+	if max < 0 {
+		return func() {}, nil
+	}
+	if root.EnterCall() > max {
+		root.LeaveCall()
+		return nil, newErrorOf(object.LimitError, "maximum call depth exceeded: %d", max)
+	}
+	return root.LeaveCall, nil
+}
+
+/*
+名前付き引数を含めて関数を適用する
+*/
+func applyFunctionWithNamed(
+	fn object.Object,
+	args []object.Object,
+	named []namedArgument,
+) object.Object {
 	switch fn := fn.(type) {
 
 	// ユーザー定義関数の場合
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		leave, err := enterCall(fn.Env)
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		extendedEnv, err := extendFunctionEnv(fn, args, named)
+		if err != nil {
+			return err
+		}
+		if fn.Generator {
+			return newGenerator(fn, extendedEnv)
+		}
+		return unwrapReturnValue(runTailCalls(evalTail(fn.Body, extendedEnv, true)))
+
+	// クラスの場合はインスタンスを生成
+	case *object.Class:
+		leave, err := enterCall(fn.Env)
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		return instantiate(fn, args, named)
 
 	// 組み込み関数の場合
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if len(named) > 0 {
+			return newErrorOf(object.ArgumentError, "named arguments not supported for builtin functions")
+		}
+		return callBuiltin(fn, args)
+
+	// 仮想マシンのクロージャなど評価器の外で実行される関数の場合
+	case object.Callable:
+		if len(named) > 0 {
+			return newErrorOf(object.ArgumentError, "named arguments not supported for %s", fn.Type())
+		}
+		return fn.Call(args)
 
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newErrorOf(object.TypeError, "not a function: %s", fn.Type())
 	}
 }
 
 /*
-関数環境を拡張する
+識別子の名前が現在のスコープで定数として束縛されているかどうか判定。解決済みならスロットを直接調べる
+*/
+func isConstant(env *object.Environment, ident *ast.Identifier) bool {
+	if depth, slot, ok := ident.Slot(); ok && depth == 0 {
+		return env.IsConstantAt(slot)
+	}
+	return env.IsConstant(ident.Value)
+}
+
+/*
+現在のスコープに識別子の名前で値を束縛する。解決済みならスロットに直接セットする
+*/
+func bind(env *object.Environment, ident *ast.Identifier, val object.Object, constant bool) {
+	depth, slot, ok := ident.Slot()
+	switch {
+	case ok && depth == 0 && constant:
+		env.SetConstantAt(slot, val)
+	case ok && depth == 0:
+		env.SetAt(slot, val)
+	case constant:
+		env.SetConstant(ident.Value, val)
+	default:
+		env.Set(ident.Value, val)
+	}
+}
+
+/*
+関数環境を拡張する。名前付き引数はパラメータ名で対応付け、
+省略された引数にはデフォルト値を関数の環境で評価してセットする。
+値を決められないパラメータがあるか、可変長パラメータのない関数に引数が多すぎればエラーを返す
 */
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+	named []namedArgument,
+) (*object.Environment, *object.Error) {
 	// 関数が保持する環境で包まれた新しい環境を生成
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewFunctionEnvironment(fn.Env, fn.Slots)
+
+	params := fn.Parameters
+
+	// 可変長パラメータには固定パラメータに割り当てられなかった残りの引数を配列でセット
+	if fn.Variadic {
+		restParam := params[len(params)-1]
+		params = params[:len(params)-1]
+
+		rest := []object.Object{}
+		if len(args) > len(params) {
+			rest = append(rest, args[len(params):]...)
+		}
+		bind(env, restParam, &object.Array{Elements: rest}, false)
+	}
+	if !fn.Variadic && len(args) > len(params) {
+		return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=%d",
+			len(args)+len(named), len(params))
+	}
+
+	// 名前付き引数が固定パラメータに対応しているか確認
+	namedValues := make(map[string]object.Object)
+	for _, arg := range named {
+		paramIdx := -1
+		for i, param := range params {
+			if param.Value == arg.name {
+				paramIdx = i
+				break
+			}
+		}
+		if paramIdx < 0 {
+			return nil, newErrorOf(object.NameError, "unknown argument name: %s", arg.name)
+		}
+		if paramIdx < len(args) {
+			return nil, newErrorOf(object.ArgumentError, "duplicate argument: %s", arg.name)
+		}
+		namedValues[arg.name] = arg.value
+	}
+
+	// 位置引数、名前付き引数、デフォルト値のいずれもないパラメータがあれば引数が足りない
+	for paramIdx, param := range params {
+		if paramIdx < len(args) {
+			continue
+		}
+		_, isNamed := namedValues[param.Value]
+		_, hasDefault := fn.Defaults[param.Value]
+		if !isNamed && !hasDefault {
+			return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=%d",
+				len(args)+len(named), requiredParameters(fn, params))
+		}
+	}
 
 	// 関数パラメータを環境にセット
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+	for paramIdx, param := range params {
+		if val, ok := namedValues[param.Value]; ok {
+			bind(env, param, val, false)
+			continue
+		}
+		if paramIdx >= len(args) {
+			if def, ok := fn.Defaults[param.Value]; ok {
+				val := Eval(def, env)
+				if isError(val) {
+					return nil, val.(*object.Error)
+				}
+				bind(env, param, val, false)
+				continue
+			}
+		}
+		bind(env, param, args[paramIdx], false)
 	}
 
-	return env
+	return env, nil
+}
+
+/*
+デフォルト値を持たない固定パラメータの数
+*/
+func requiredParameters(fn *object.Function, params []*ast.Identifier) int {
+	required := 0
+	for _, param := range params {
+		if _, ok := fn.Defaults[param.Value]; !ok {
+			required++
+		}
+	}
+	return required
 }
 
 /*
@@ -461,21 +1184,71 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+/*
+添字を長さlengthの列に対する位置に変換する。負の添字は末尾からの位置として扱い、範囲外の場合はfalseを返す
+*/
+func normalizeIndex(idx, length int64) (int64, bool) {
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 || idx >= length {
+		return 0, false
+	}
+	return idx, true
+}
+
 /*
 配列の添字式を評価
 */
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-
-	if idx < 0 || idx > max {
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, int64(len(arrayObject.Elements)))
+	if !ok {
 		return NULL
 	}
 
 	return arrayObject.Elements[idx]
 }
 
+/*
+文字列の添字式を評価。文字単位で添字を数え、一文字の文字列を返す
+*/
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	runes := []rune(str.(*object.String).Value)
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, int64(len(runes)))
+	if !ok {
+		return NULL
+	}
+
+	return &object.String{Value: string(runes[idx])}
+}
+
+/*
+バイト列の添字式を評価。要素は0〜255の整数になる
+*/
+func evalBytesIndexExpression(b, index object.Object) object.Object {
+	value := b.(*object.Bytes).Value
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, int64(len(value)))
+	if !ok {
+		return NULL
+	}
+
+	return &object.Integer{Value: int64(value[idx])}
+}
+
+/*
+範囲の添字式を評価
+*/
+func evalRangeIndexExpression(rng, index object.Object) object.Object {
+	rangeObject := rng.(*object.Range)
+	idx, ok := normalizeIndex(index.(*object.Integer).Value, rangeObject.Len())
+	if !ok {
+		return NULL
+	}
+
+	return rangeObject.At(idx)
+}
+
 /*
 ハッシュの添字式を評価
 */
@@ -484,7 +1257,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return newErrorOf(object.TypeError, "unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
@@ -495,6 +1268,19 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+/*
+文字列をキーとするハッシュを生成。keysとvaluesは同じ順に並べる
+*/
+func newStringHash(keys []string, values []object.Object) *object.Hash {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, len(keys))}
+	for i, k := range keys {
+		key := &object.String{Value: k}
+		hash.Set(key.HashKey(), object.HashPair{Key: key, Value: values[i]})
+	}
+
+	return hash
+}
+
 /*
 ハッシュリテラルを評価
 */
@@ -502,9 +1288,10 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.OrderedKeys() {
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -512,7 +1299,7 @@ func evalHashLiteral(
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newErrorOf(object.TypeError, "unusable as hash key: %s", key.Type())
 		}
 
 		value := Eval(valueNode, env)
@@ -520,9 +1307,8 @@ func evalHashLiteral(
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
@@ -1,10 +1,23 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -39,11 +52,30 @@ func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
+	resolver.Resolve(program)
 	env := object.NewEnvironment()
 
 	return Eval(program, env)
 }
 
+func testEvalWithConfig(input string, config object.Config) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver.Resolve(program)
+	env := object.NewEnvironment()
+	env.SetConfig(config)
+
+	return Eval(program, env)
+}
+
+func testEvalWithPolicy(input string, policy *object.Policy) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver.Resolve(program)
+	env := object.NewEnvironment()
+	env.SetPolicy(policy)
+
+	return Eval(program, env)
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -175,6 +207,19 @@ if (10 > 1) {
 
 	return 1;
 }
+
+func TestBareReturnStatements(t *testing.T) {
+	tests := []string{
+		"return;",
+		"fn() { return; 10 }()",
+		"fn() { if (true) { return } 10 }()",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		testNullObject(t, evaluated)
+	}
+}
 `,
 			10,
 		},
@@ -206,6 +251,14 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"5 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { 10 / x }; f(0)",
+			"division by zero",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -260,6 +313,41 @@ if (10 > 1) {
 	}
 }
 
+func TestErrorLocation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"1 + foo",
+			"ERROR: identifier not found: foo at 1:5",
+		},
+		{
+			"let bar = fn() {\n  foo\n};\nbar()",
+			"ERROR: identifier not found: foo at 2:3 in bar() called from main",
+		},
+		{
+			"let baz = fn() { 1 + true };\nlet bar = fn() { baz() };\nbar()",
+			"ERROR: type mismatch: INTEGER + BOOLEAN at 1:20 in baz() called from bar() called from main",
+		},
+		{
+			"let bar = fn() { error(\"boom\") };\nbar()",
+			"ERROR: boom at 1:23 in bar() called from main",
+		},
+		{
+			"len(1)",
+			"ERROR: argument to `len` not supported, got INTEGER at 1:4",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -269,6 +357,7 @@ func TestLetStatements(t *testing.T) {
 		{"let a = 5 * 5; a;", 25},
 		{"let a = 5; let b = a; b;", 5},
 		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let 幅 = 3; let höhe = 4; 幅 * höhe;", 12},
 	}
 
 	for _, tt := range tests {
@@ -361,6 +450,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -448,8 +538,20 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
+		{
+			"(1..4)[-1]",
+			3,
+		},
 	}
 
 	for _, tt := range tests {
@@ -548,3 +650,2249 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestNullLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"let x = null; x", nil},
+		{"null == null", true},
+		{"null != null", false},
+		{"if (false) { 1 } == null", true},
+		{"!null", true},
+		{"1 == null", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestCoalesceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null ?? 5", 5},
+		{"1 ?? 5", 1},
+		{"null ?? null", nil},
+		{"null ?? null ?? 3", 3},
+		{`{"a": 1}["b"] ?? 10`, 10},
+		{`{"a": 1}["a"] ?? 10`, 1},
+		{"false ?? 10", false},
+		// 左辺がNULLでなければ右辺は評価されない
+		{"1 ?? undefinedIdent", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { case 1 { 10 } case _ { 20 } }`, 10},
+		{`match (2) { case 1 { 10 } case _ { 20 } }`, 20},
+		{`match (3) { case 1 { 10 } }`, nil},
+		{`match ("a") { case "b" { 1 } case "a" { 2 } }`, 2},
+		{`match ([1, 2]) { case [h, t] { h + t } }`, 3},
+		{`match ([1, 2, 3]) { case [h, t] { 1 } case [a, b, c] { c } }`, 3},
+		{`match ([1, [2, 3]]) { case [1, [x, y]] { x * y } }`, 6},
+		{`match ({"type": 5, "v": 1}) { case {"type": t} { t } }`, 5},
+		{`match ({"v": 1}) { case {"type": t} { t } case _ { 0 } }`, 0},
+		{`match ({"type": "num", "v": 7}) { case {"type": "str", "v": v} { 0 } case {"type": "num", "v": v} { v } }`, 7},
+		{`match (5) { case x { x * 2 } }`, 10},
+		// 束縛は分岐内のみ有効
+		{`let x = 1; match (5) { case x { x } }; x`, 1},
+		{`let f = fn(n) { match (n) { case 0 { 0 } case _ { return 9; } } }; f(1)`, 9},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let f = fn() { let a = 10; a }; f() + a;", 15},
+		{"const a = 5; let f = fn() { const a = 1; a }; f();", 1},
+		{"const a = 5; const a = 6;", "cannot redeclare constant: a"},
+		{"const a = 5; let a = 6;", "cannot redeclare constant: a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestLetArrayDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b, c] = [1, 2, 3]; a + b + c;", 6},
+		{"let [a, b] = [1, [2, 3]]; b[1];", 3},
+		{"let [h, ...t] = [1, 2, 3]; len(t);", 2},
+		{"let [h, ...t] = [1, 2, 3]; h;", 1},
+		{"let [a, b, ...t] = [1]; b;", nil},
+		{"let [a, b, ...t] = [1]; len(t);", 0},
+		{"let [a, b] = [1, 2, 3];", "wrong number of values to destructure. got=3, want=2"},
+		{"let [a, b] = 1;", "cannot destructure INTEGER as ARRAY"},
+		{"const a = 1; let [a] = [2];", "cannot redeclare constant: a"},
+		// 関数の中ではスロットに束縛する。同じ名前が複数あれば後の値を束縛する
+		{"let f = fn(x) { let [a, b] = x; a * b }; f([3, 4]);", 12},
+		{"let f = fn() { let [a, a] = [1, 2]; a }; f();", 2},
+		{"let f = fn() { const a = 1; let [a] = [2]; a }; f();", "cannot redeclare constant: a"},
+		// 束縛する前のスロットの名前は外側の環境から探す
+		{"let a = 5; let f = fn() { let b = a; let [a] = [1]; b }; f();", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLetHashDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let {name, age} = {"name": "m", "age": 3}; age;`, 3},
+		{`let {age} = {"name": "m", "age": 3}; age * 2;`, 6},
+		{`let {missing} = {"name": "m"}; missing;`, nil},
+		{`let {a} = [1];`, "cannot destructure ARRAY as HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(a, ...rest) { len(rest) }; f(1, 2, 3);", 2},
+		{"let f = fn(a, ...rest) { len(rest) }; f(1);", 0},
+		{"let f = fn(a, ...rest) { a }; f(1, 2, 3);", 1},
+		{"let f = fn(...rest) { rest[2] }; f(1, 2, 3);", 3},
+		{"let f = fn(...rest) { len(rest) }; f();", 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x, y = 10) { x + y }; f(1);", 11},
+		{"let f = fn(x, y = 10) { x + y }; f(1, 2);", 3},
+		{"let f = fn(x, y = x * 2) { x + y }; f(3);", 9},
+		{"let n = 5; let f = fn(x = n) { x }; f();", 5},
+		{"let f = fn(x = undefinedIdent) { x }; f();", "identifier not found: undefinedIdent"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestSpreadArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b, c) { a + b + c }; let args = [1, 2, 3]; add(...args);", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2, 3]);", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1], 2, ...[3]);", 6},
+		{"let f = fn(...rest) { len(rest) }; f(...[1, 2], ...[]);", 2},
+		{"len(...[[1, 2]])", 2},
+		{"let f = fn(a) { a }; f(...1);", "cannot spread INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b) { a - b }; f(b: 1, a: 5);", 4},
+		{"let f = fn(a, b) { a - b }; f(5, b: 1);", 4},
+		{"let f = fn(a, b = 2, c = 3) { a + b * c }; f(1, c: 10);", 21},
+		{"let f = fn(a, ...rest) { a + len(rest) }; f(a: 1);", 1},
+		{"let f = fn(a) { a }; f(b: 1);", "unknown argument name: b"},
+		{"let f = fn(a) { a }; f(1, a: 2);", "duplicate argument: a"},
+		{"let f = fn(a) { a }; f(a: 1, a: 2);", "duplicate argument: a"},
+		{"len(a: 1)", "named arguments not supported for builtin functions"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestArgumentCount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn(x, y) { x + y }(1)", "wrong number of arguments. got=1, want=2"},
+		{"let f = fn(x, y) { x + y }; f()", "wrong number of arguments. got=0, want=2"},
+		{"let f = fn(x, y = 2) { x + y }; f()", "wrong number of arguments. got=0, want=1"},
+		{"let f = fn(x, y, ...rest) { x }; f(1)", "wrong number of arguments. got=1, want=2"},
+		{"let f = fn(x, y) { x - y }; f(y: 1)", "wrong number of arguments. got=1, want=2"},
+		{"let f = fn(x, y) { x - y }; f(y: 1, x: 3)", 2},
+		// 可変長パラメータのない関数には余分な引数を渡せない
+		{"let f = fn(x) { x }; f(1, 2)", "wrong number of arguments. got=2, want=1"},
+		{"let f = fn(x, y = 2) { x }; f(1, 2, 3)", "wrong number of arguments. got=3, want=2"},
+		{"let f = fn(x, y) { x }; f(1, 2, y: 3)", "duplicate argument: y"},
+		{"let f = fn(x, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+		// 末尾位置の呼び出しやコールバックでも確認する
+		{"let f = fn(x, y) { x }; let g = fn() { f(1) }; g()", "wrong number of arguments. got=1, want=2"},
+		{"map([1], fn(x, y) { x })", "wrong number of arguments. got=1, want=2"},
+		{"reduce([1, 2], fn(acc) { acc })", "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+			if err, ok := evaluated.(*object.Error); ok && err.ErrorKind() != object.ArgumentError {
+				t.Errorf("wrong kind for %q. got=%s", tt.input, err.ErrorKind())
+			}
+		}
+	}
+}
+
+func TestMemberExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let p = {"name": "m", "age": 3}; p.age;`, 3},
+		{`let p = {"inner": {"v": 5}}; p.inner.v;`, 5},
+		{`let p = {"f": fn(x) { x * 2 }}; p.f(4);`, 8},
+		{`{"a": 1}.b`, nil},
+		{`let p = {"xs": [1, 2]}; p.xs[1];`, 2},
+		{`5.foo`, "property access not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello".len()`, 5},
+		{`"Hello".upper()`, "HELLO"},
+		{`"Hello".lower()`, "hello"},
+		{`"  hi ".trim()`, "hi"},
+		{`"a,b,c".split(",").len()`, 3},
+		{`[1, 2, 3].len()`, 3},
+		{`[1, 2].push(3).last()`, 3},
+		{`let arr = [1, 2, 3]; arr.rest().first()`, 2},
+		{`{"a": 1, "b": 2}.len()`, 2},
+		{`{"a": 1}.keys()[0]`, "a"},
+		{`{"a": 1}.values()[0]`, 1},
+		{`"hello".contains("ell")`, true},
+		{`"hello".contains("xyz")`, false},
+		{`"a-b-c".replace("-", "+")`, "a+b+c"},
+		{`"hello".startsWith("he")`, true},
+		{`"hello".startsWith("lo")`, false},
+		{`[1, 2, 3].map(fn(x) { x * 2 })[2]`, 6},
+		{`[1, 2, 3, 4].filter(fn(x) { x > 2 }).len()`, 2},
+		{`["a", "b", "c"].join(", ")`, "a, b, c"},
+		{`[1, "b", true].join("-")`, "1-b-true"},
+		{`[1, 2, 3].filter(fn(x) { x > 1 }).map(fn(x) { x * 10 }).join(",")`, "20,30"},
+		{`"abc".contains(1)`, errorMessage("argument to `contains` must be STRING, got INTEGER")},
+		{`[1].join()`, errorMessage("wrong number of arguments. got=0, want=1")},
+		{`let f = "abc".len; f()`, 3},
+		// ハッシュのキーはメソッドより優先される
+		{`{"len": fn() { 99 }}.len()`, 99},
+		{`"abc".foo()`, errorMessage("undefined method foo for STRING")},
+		{`1.len()`, errorMessage("property access not supported: INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+type errorMessage string
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"len(1..10)", 9},
+		{"len(5..1)", 0},
+		{"(1..10)[0]", 1},
+		{"let n = 3; (0..n * 2)[5]", 5},
+		{"(1..3)[2]", nil},
+		{`"a".."b"`, errorMessage("unknown operator: STRING .. STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	evaluated := testEval("1..4")
+	rng, ok := evaluated.(*object.Range)
+	if !ok {
+		t.Fatalf("object is not Range. got=%T (%+v)", evaluated, evaluated)
+	}
+	if rng.Start != 1 || rng.End != 4 {
+		t.Errorf("range has wrong bounds. got=%d..%d", rng.Start, rng.End)
+	}
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3, 4][1:3]", []int64{2, 3}},
+		{"[1, 2, 3, 4][2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:2]", []int64{1, 2}},
+		{"[1, 2, 3, 4][:]", []int64{1, 2, 3, 4}},
+		{"[1, 2, 3, 4][-2:]", []int64{3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int64{1, 2, 3}},
+		{"[1, 2, 3, 4][3:1]", []int64{}},
+		{"[1, 2, 3, 4][-10:10]", []int64{1, 2, 3, 4}},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[2:]`, "llo"},
+		{`"hello"[-3:-1]`, "ll"},
+		{`"héllo"[1:2]`, "é"},
+		{`5[1:2]`, errorMessage("slice operator not supported: INTEGER")},
+		{`[1][true:]`, errorMessage("slice bound must be INTEGER, got BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func testIntegerArray(t *testing.T, obj object.Object, expected []int64) bool {
+	array, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if len(array.Elements) != len(expected) {
+		t.Errorf("wrong num of elements. want=%d, got=%d",
+			len(expected), len(array.Elements))
+		return false
+	}
+	for i, expectedElem := range expected {
+		if !testIntegerObject(t, array.Elements[i], expectedElem) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[1]`, "e"},
+		{`"hello"[0]`, "h"},
+		{`"hello"[-1]`, "o"},
+		{`"héllo"[1]`, "é"},
+		{`let s = "abc"; s[len(s) - 1]`, "c"},
+		{`let s = "こんにちは"; s[len(s) - 1]`, "は"},
+		{`"hello"[5]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	class := `
+class Point(x, y = 0) {
+	let sum = x + y;
+	let double = self.sum * 2;
+	fn norm() { self.x * self.x + self.y * self.y }
+	fn add(other) { Point(self.x + other.x, self.y + other.y) }
+	fn scaled(k) { Point(self.x * k, self.y * k) }
+}
+class Empty {}
+`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let p = Point(3, 4); p.x", 3},
+		{"let p = Point(3); p.y", 0},
+		{"let p = Point(y: 2, x: 1); p.sum", 3},
+		{"let p = Point(3, 4); p.double", 14},
+		{"let p = Point(3, 4); p.norm()", 25},
+		{"let p = Point(1, 2).add(Point(10, 20)); p.y", 22},
+		{"Point(1, 2).scaled(3).sum", 9},
+		{"let m = Point(3, 4).norm; m()", 25},
+		{"Empty().foo", errorMessage("undefined property foo for Empty")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(class + tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	evaluated := testEval(class + "Point(1, 2)")
+	if evaluated.Inspect() != "Point{double: 6, sum: 3, x: 1, y: 2}" {
+		t.Errorf("instance.Inspect() wrong. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"abc" > "abd"`, false},
+		{`"b" > "abc"`, true},
+		{`"" < "a"`, true},
+		{`let s = "mon"; s + "key" == "monkey"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 in [1, 2, 3]", true},
+		{"4 in [1, 2, 3]", false},
+		{`"b" in ["a", "b"]`, true},
+		{`"key" in {"key": 1}`, true},
+		{`"other" in {"key": 1}`, false},
+		{`1 in {1: null}`, true},
+		{`"onk" in "monkey"`, true},
+		{`"ape" in "monkey"`, false},
+		{"3 in 1..5", true},
+		{"5 in 1..5", false},
+		{`[1] in {}`, errorMessage("unusable as hash key: ARRAY")},
+		{`1 in "monkey"`, errorMessage("type mismatch: INTEGER in STRING")},
+		{`1 in 2`, errorMessage("unknown operator: INTEGER in INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestTypeofOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"typeof 1", "INTEGER"},
+		{`typeof "a"`, "STRING"},
+		{"typeof true", "BOOLEAN"},
+		{"typeof null", "NULL"},
+		{"typeof [1]", "ARRAY"},
+		{"typeof {}", "HASH"},
+		{"typeof fn() {}", "FUNCTION"},
+		{"typeof len", "BUILTIN"},
+		{"typeof (1..2)", "RANGE"},
+		{"let x = 5; if (typeof x == \"INTEGER\") { \"int\" } else { \"other\" }", "int"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNamedFunctionLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; f(5);", 120},
+		{"let r = fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }(10); r", 55},
+		// 名前は関数の外からは見えない
+		{"let f = fn inner() { 1 }; inner", errorMessage("identifier not found: inner")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn add(a, b) { a + b } add(1, 2)", 3},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5);", 120},
+		// 相互再帰
+		{`fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+		  fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+		  isOdd(7)`, true},
+		{"const f = 1; fn f() { 2 }", errorMessage("cannot redeclare constant: f")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn count(n) { yield n; yield n + 1; yield n + 2 } collect(count(1))", []int64{1, 2, 3}},
+		{"let g = fn() { yield 1; return; yield 2 }; collect(g())", []int64{1}},
+		{"let g = fn() { yield 1 }(); g.next().value", 1},
+		{"let g = fn() { yield 1 }(); g.next().done", false},
+		{"let g = fn() { yield 1 }(); g.next(); g.next().done", true},
+		{"let g = fn() { yield 1 }(); g.next(); g.next(); g.next().value", nil},
+		// 値は必要になるまで生成されない
+		{"let g = fn() { yield 1; 1 + true }(); g.next().value", 1},
+		{"class Counter(n) { fn each() { yield self.n; yield self.n * 2 } } collect(Counter(3).each())", []int64{3, 6}},
+		{"let g = fn() { yield 1; 1 + true }(); collect(g)", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"collect(1)", errorMessage("argument to `collect` must be ITERABLE, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestGeneratorClose(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let g = fn() { yield 1; yield 2 }(); g.next(); g.close(); g.next().done", true},
+		{"let g = fn() { yield 1 }(); g.close(); collect(g)", []int64{}},
+		{"let g = fn() { yield 1 }(); collect(g); g.close()", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAbandonedGeneratorsStop(t *testing.T) {
+	// 本体を開始して yield で中断したままのジェネレーターを作る
+	const input = "let gs = map(0..50, fn(i) { let g = fn() { yield i; yield i }(); g.next(); g });"
+
+	waitGoroutines := func(want int) bool {
+		for i := 0; i < 200; i++ {
+			if runtime.NumGoroutine() <= want {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	before := runtime.NumGoroutine()
+	testEval(input + "map(gs, fn(g) { g.close() });")
+	if !waitGoroutines(before) {
+		t.Errorf("closed generators left goroutines running. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+
+	before = runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	program := parser.New(lexer.New(input)).ParseProgram()
+	resolver.Resolve(program)
+	EvalContext(ctx, program, object.NewEnvironment())
+	if runtime.NumGoroutine() < before+50 {
+		t.Fatalf("generators did not start. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+	cancel()
+	if !waitGoroutines(before) {
+		t.Errorf("canceling the context left goroutines running. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"recv(spawn fn() { 42 })", 42},
+		{"let add = fn(a, b) { a + b }; recv(spawn add(1, b: 2))", 3},
+		{`let c = channel();
+		  spawn fn() { send(c, 1); send(c, 2) };
+		  recv(c) + recv(c)`, 3},
+		{"let c = channel(2); send(c, 1); send(c, 2); close(c); [recv(c), recv(c), recv(c)]", []int64{1, 2}},
+		{`let c = channel(3);
+		  let worker = fn(n) { send(c, n * n) };
+		  spawn worker(1); spawn worker(2); spawn worker(3);
+		  recv(c) + recv(c) + recv(c)`, 14},
+		{"recv(spawn fn() { 1 + true })", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"let c = channel(1); close(c); send(c, 1)", errorMessage("send on closed channel")},
+		{"let c = channel(); close(c); close(c)", errorMessage("close of closed channel")},
+		{"channel(-1)", errorMessage("channel size must not be negative: -1")},
+		{"recv(1)", errorMessage("argument to `recv` must be CHANNEL, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			for i, want := range expected {
+				testIntegerObject(t, arr.Elements[i], want)
+			}
+			testNullObject(t, arr.Elements[len(expected)])
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestRepetitionExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`2 * "xy"`, "xyxy"},
+		{`"ab" * 0`, ""},
+		{"[0] * 5", []int64{0, 0, 0, 0, 0}},
+		{"[1, 2] * 2", []int64{1, 2, 1, 2}},
+		{"3 * [7]", []int64{7, 7, 7}},
+		{"[1] * 0", []int64{}},
+		{`"ab" * -1`, errorMessage("negative repetition count: -1")},
+		{`"ab" * "c"`, errorMessage("unknown operator: STRING * STRING")},
+		// 上限を設定していなくても、メモリを使い切るほど大きな値は作らない
+		{`"a" * 9223372036854775807`, errorMessage("value too large: exceeds 1073741824 bytes")},
+		{"[1] * 9223372036854775807", errorMessage("value too large: exceeds 1073741824 bytes")},
+		{`len("a" * 30000000000)`, errorMessage("value too large: exceeds 1073741824 bytes")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestArrayConcatenation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2] + [3]", []int64{1, 2, 3}},
+		{"[] + [1]", []int64{1}},
+		{"[] + []", []int64{}},
+		{"let a = [1]; let b = a + [2]; len(a)", 1},
+		{"[1] - [1]", errorMessage("unknown operator: ARRAY - ARRAY")},
+		{"[1] + 1", errorMessage("type mismatch: ARRAY + INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[[1, [2]], \"a\"] == [[1, [2]], \"a\"]", true},
+		{"[1] == [\"1\"]", false},
+		{"{\"a\": 1, \"b\": [2]} == {\"b\": [2], \"a\": 1}", true},
+		{"{\"a\": 1} == {\"a\": 2}", false},
+		{"{\"a\": 1} != {\"b\": 1}", true},
+		{"{} == {}", true},
+		{"[1, 2] in [[1, 2], [3]]", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestDeepEqualityWithCycles(t *testing.T) {
+	// 自分自身を要素に持つ配列
+	left := &object.Array{}
+	left.Elements = []object.Object{&object.Integer{Value: 1}, left}
+	right := &object.Array{}
+	right.Elements = []object.Object{&object.Integer{Value: 1}, right}
+
+	if !objectsEqual(left, right) {
+		t.Errorf("cyclic arrays with the same shape should be equal")
+	}
+
+	other := &object.Array{}
+	other.Elements = []object.Object{&object.Integer{Value: 2}, other}
+	if objectsEqual(left, other) {
+		t.Errorf("cyclic arrays with different elements should not be equal")
+	}
+}
+
+func TestIntegerOverflowPromotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(30)", "265252859812191058636308480000000"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"(9223372036854775807 + 1) - 1", int64(9223372036854775807)},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(9223372036854775807 * 4) / 2", "18446744073709551614"},
+		{"(9223372036854775807 + 1) > 9223372036854775807", true},
+		{"(9223372036854775807 + 1) == (9223372036854775807 + 1)", true},
+		{"typeof (9223372036854775807 + 1)", "BIG_INTEGER"},
+		{`let h = {(9223372036854775807 + 1): "big"}; h[9223372036854775807 + 1]`, "big"},
+		{"(9223372036854775807 + 1) / 0", errorMessage("division by zero")},
+		{"3 * 4", int64(12)},
+	}
+
+	config := object.Config{Overflow: object.OverflowPromote}
+	for _, tt := range tests {
+		evaluated := testEvalWithConfig(tt.input, config)
+		switch expected := tt.expected.(type) {
+		case string:
+			// 多倍長整数は10進表記で比較する
+			if str, ok := evaluated.(*object.String); ok {
+				testStringObject(t, str, expected)
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong value. expected=%s, got=%s (%T)", expected, evaluated.Inspect(), evaluated)
+			}
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestIntegerOverflowWrapsByDefault(t *testing.T) {
+	evaluated := testEval("9223372036854775807 + 1")
+	testIntegerObject(t, evaluated, -9223372036854775808)
+}
+
+func TestIntegerOverflowError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", errorMessage("integer overflow: 9223372036854775807 + 1")},
+		{"-9223372036854775807 - 2", errorMessage("integer overflow: -9223372036854775807 - 2")},
+		{"4611686018427387904 * 2", errorMessage("integer overflow: 4611686018427387904 * 2")},
+		{"let min = -9223372036854775807 - 1; min / -1", errorMessage("integer overflow: -9223372036854775808 / -1")},
+		{"let min = -9223372036854775807 - 1; -min", errorMessage("integer overflow: --9223372036854775808")},
+		{"pow(2, 63)", errorMessage("integer overflow: pow(2, 63)")},
+		{"9223372036854775806 + 1", int64(9223372036854775807)},
+		{"pow(2, 62)", int64(4611686018427387904)},
+		{"pow(-2, 63)", int64(-9223372036854775808)},
+		{"isError(9223372036854775807 + 1)", true},
+	}
+
+	config := object.Config{Overflow: object.OverflowRaise}
+	for _, tt := range tests {
+		evaluated := testEvalWithConfig(tt.input, config)
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+			if err, ok := evaluated.(*object.Error); ok && err.ErrorKind() != object.OverflowError {
+				t.Errorf("wrong kind for %q. got=%s", tt.input, err.ErrorKind())
+			}
+		}
+	}
+
+	// int64 に収まらない指数でも、底によっては結果が int64 に収まる
+	huge := &object.BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+	testIntegerObject(t, powBuiltin(config, &object.Integer{Value: -1}, huge), 1)
+	testErrorObject(t, powBuiltin(config, &object.Integer{Value: 2}, huge), "integer overflow: pow(2, 1180591620717411303424)")
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", []int64{2, 4, 6}},
+		{"map([], fn(x) { x })", []int64{}},
+		{"map(1..4, fn(x) { x * x })", []int64{1, 4, 9}},
+		{`map(["a", "bb"], len)`, []int64{1, 2}},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", []int64{3, 4}},
+		{"filter([1, null, 2], fn(x) { x })", []int64{1, 2}},
+		{"reduce([1, 2, 3, 4], fn(acc, x) { acc + x })", 10},
+		{"reduce([1, 2, 3], fn(acc, x) { acc * x }, 10)", 60},
+		{"reduce([], fn(acc, x) { acc + x }, 0)", 0},
+		{"reduce([], fn(acc, x) { acc + x })", errorMessage("reduce of empty array with no initial value")},
+		{"map([1], fn(x) { x + true })", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{"map(1, fn(x) { x })", errorMessage("argument to `map` must be ITERABLE, got INTEGER")},
+		{"filter([1], 2)", errorMessage("second argument to `filter` must be FUNCTION, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSortBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"sort([3, 1, 2])", []int64{1, 2, 3}},
+		{"sort([])", []int64{}},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", []int64{3, 2, 1}},
+		{"sort([3, 1, 2], fn(a, b) { b - a })", []int64{3, 2, 1}},
+		{"let a = [2, 1]; sort(a); a", []int64{2, 1}},
+		// 安定ソート: 比較上等しい要素は元の順序を保つ
+		{`let pairs = [[1, 1], [0, 2], [1, 3], [0, 4]];
+		  map(sort(pairs, fn(a, b) { a[0] < b[0] }), fn(p) { p[1] })`, []int64{2, 4, 1, 3}},
+		{`sort(["b", "c", "a"]) == ["a", "b", "c"]`, true},
+		{`sort([1, "a"])`, errorMessage("cannot sort mixed types: INTEGER and STRING")},
+		{"sort([[1], [2]])", errorMessage("cannot sort ARRAY without a comparator")},
+		{"sort([1, 2], fn(a, b) { a + true })", errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`sort([1, 2], fn(a, b) { "x" })`, errorMessage("comparator must return BOOLEAN or INTEGER, got STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestHashIterationBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`keys({"b": 1, "a": 2, "c": 3}) == ["b", "a", "c"]`, true},
+		{`values({"b": 1, "a": 2, "c": 3})`, []int64{1, 2, 3}},
+		{`entries({"b": 1, "a": 2}) == [["b", 1], ["a", 2]]`, true},
+		{`keys({3: 0, 1: 0, 2: 0})`, []int64{3, 1, 2}},
+		{`keys({1: 0, 2: 0, 1: 3})`, []int64{1, 2}},
+		{`keys(delete({1: 0, 2: 0, 3: 0}, 2))`, []int64{1, 3}},
+		{`keys(clone({3: 0, 1: 0}))`, []int64{3, 1}},
+		{`{"x": 1}.entries() == [["x", 1]]`, true},
+		{"keys({})", []int64{}},
+		{"keys([1])", errorMessage("argument to `keys` must be HASH, got ARRAY")},
+		{"entries({}, {})", errorMessage("wrong number of arguments. got=2, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestHashHasAndDelete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": null}, "a")`, true},
+		{`{"a": 1}.has("a")`, true},
+		{`delete({"a": 1, "b": 2}, "a") == {"b": 2}`, true},
+		{`delete({"a": 1}, "x") == {"a": 1}`, true},
+		{`let h = {"a": 1}; delete(h, "a"); has(h, "a")`, true},
+		{`{"a": 1}.delete("a") == {}`, true},
+		{`has({}, [1])`, errorMessage("unusable as hash key: ARRAY")},
+		{`has([1], 1)`, errorMessage("argument to `has` must be HASH, got ARRAY")},
+		{`delete({})`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type([])`, "ARRAY"},
+		{`type(null)`, "NULL"},
+		{`int("42")`, 42},
+		{`int(" -7 ")`, -7},
+		{`int(5)`, 5},
+		{`int(true)`, 1},
+		{`int(false)`, 0},
+		{`str(42)`, "42"},
+		{`str("a")`, "a"},
+		{`str([1, "b"])`, `[1, "b"]`},
+		{`str(true)`, "true"},
+		{`bool(0)`, true},
+		{`bool(null)`, false},
+		{`bool(false)`, false},
+		{`int("abc")`, errorMessage(`cannot convert "abc" to INTEGER`)},
+		{`int([1])`, errorMessage("cannot convert ARRAY to INTEGER")},
+		{`str()`, errorMessage("wrong number of arguments. got=0, want=1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestTimeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`formatTime(0, "2006-01-02 15:04:05")`, "1970-01-01 00:00:00"},
+		{`formatTime(1700000000123, "2006-01-02T15:04:05.000Z07:00")`, "2023-11-14T22:13:20.123Z"},
+		{`parseTime("2023-11-14 22:13:20", "2006-01-02 15:04:05")`, 1700000000000},
+		{`parseTime("2023-11-14T23:13:20+01:00", "2006-01-02T15:04:05Z07:00")`, 1700000000000},
+		{`let t = now(); sleep(1); now() > t`, true},
+		{`sleep(0)`, nil},
+		{`parseTime("nope", "2006-01-02")`, errorMessage(`cannot parse time "nope" with layout "2006-01-02"`)},
+		{`sleep(-1)`, errorMessage("sleep duration must not be negative: -1")},
+		{`formatTime("0", "2006")`, errorMessage("first argument to `formatTime` must be INTEGER, got STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEnvAndArgsBuiltins(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+
+	original := ScriptArgs
+	ScriptArgs = []string{"a", "b"}
+	defer func() { ScriptArgs = original }()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`env("MONKEY_TEST_VAR")`, "banana"},
+		{`env("MONKEY_TEST_UNSET_VAR")`, nil},
+		{`setEnv("MONKEY_TEST_VAR", "apple"); env("MONKEY_TEST_VAR")`, "apple"},
+		{`args() == ["a", "b"]`, true},
+		{`env(1)`, errorMessage("argument to `env` must be STRING, got INTEGER")},
+		{`args(1)`, errorMessage("wrong number of arguments. got=1, want=0")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestExecBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`exec("echo", ["hello"]).stdout`, "hello\n"},
+		{`exec("sh", ["-c", "echo oops >&2; exit 3"]).stderr`, "oops\n"},
+		{`exec("sh", ["-c", "exit 3"]).exitCode`, 3},
+		{`exec("true").exitCode`, 0},
+		{`exec("monkey-no-such-command")`, errorMessage(`cannot run command: exec: "monkey-no-such-command": executable file not found in $PATH`)},
+		{`exec("echo", [1])`, errorMessage("arguments to `exec` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithPolicy(tt.input, object.AllowAll())
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestExecBuiltinDisabled(t *testing.T) {
+	evaluated := testEvalWithPolicy(`exec("echo")`, &object.Policy{})
+	testErrorObject(t, evaluated, "process execution is disabled: exec")
+
+	// Policy をセットしなければ、外部コマンドの実行とネットワークへの接続は使えない
+	testErrorObject(t, testEval(`exec("echo")`), "process execution is disabled: exec")
+	testErrorObject(t, testEval(`tcpConnect("127.0.0.1", 1)`), "network access is disabled: tcpConnect")
+	testBooleanObject(t, testEval(`fileExists("/nonexistent/file")`), false)
+}
+
+func TestInputBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	originalStdout := Stdout
+	Stdout = &out
+	defer func() {
+		Stdout = originalStdout
+		SetInput(os.Stdin)
+	}()
+
+	SetInput(strings.NewReader("Alice\r\nsecond line\nlast"))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`input("name? ")`, "Alice"},
+		{`readLine()`, "second line"},
+		{`readLine()`, "last"},
+		{`readLine()`, nil},
+		{`input(1)`, errorMessage("argument to `input` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	if out.String() != "name? " {
+		t.Errorf("prompt wrong. got=%q", out.String())
+	}
+}
+
+func TestPutsOutput(t *testing.T) {
+	var out bytes.Buffer
+	originalStdout := Stdout
+	Stdout = &out
+	defer func() { Stdout = originalStdout }()
+
+	testEval(`puts("a\nb", ["c"], 1)`)
+
+	expected := "a\nb\n[\"c\"]\n1\n"
+	if out.String() != expected {
+		t.Errorf("puts output wrong. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestSequenceBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"range(4)", []int64{0, 1, 2, 3}},
+		{"range(0)", []int64{}},
+		{"range(2, 5)", []int64{2, 3, 4}},
+		{"range(0, 10, 3)", []int64{0, 3, 6, 9}},
+		{"range(5, 0, -2)", []int64{5, 3, 1}},
+		{"range(5, 0)", []int64{}},
+		{`enumerate(["a", "b"]) == [[0, "a"], [1, "b"]]`, true},
+		{`enumerate([]) == []`, true},
+		{`zip([1, 2, 3], ["a", "b"]) == [[1, "a"], [2, "b"]]`, true},
+		{`map(zip(1..4, range(3)), fn(p) { p[0] * p[1] })`, []int64{0, 2, 6}},
+		{"range(1, 2, 0)", errorMessage("range step must not be zero")},
+		{`range("a")`, errorMessage("arguments to `range` must be INTEGER, got STRING")},
+		{"zip([1], 2)", errorMessage("second argument to `zip` must be ITERABLE, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"len(set([1, 2, 2, 3]))", 3},
+		{"len(set())", 0},
+		{"2 in set([1, 2])", true},
+		{`"2" in set([1, 2])`, false},
+		{"set([3, 1, 2]) == set([1, 2, 3])", true},
+		{"set([1]) == set([1, 2])", false},
+		{"let s = set([1]); add(s, 2); len(s)", 1},
+		{"len(add(set([1]), 2))", 2},
+		{"remove(set([1, 2]), 1) == set([2])", true},
+		{"union(set([1, 2]), set([2, 3])) == set([1, 2, 3])", true},
+		{"intersect(set([1, 2]), set([2, 3])) == set([2])", true},
+		{"difference(set([1, 2]), set([2, 3])) == set([1])", true},
+		{"set([1]).add(2).union(set([3])).len()", 3},
+		{"set([[1]])", errorMessage("unusable as set element: ARRAY")},
+		{"union([1], set())", errorMessage("first argument to `union` must be SET, got ARRAY")},
+		{"set().union([1])", errorMessage("argument to `union` must be SET, got ARRAY")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestSetInspect(t *testing.T) {
+	evaluated := testEval(`set([3, 1, 2, 1])`)
+	if evaluated.Inspect() != "set([1, 2, 3])" {
+		t.Errorf("set.Inspect() wrong. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len(bytes("héllo"))`, 6},
+		{`bytes("abc")[0]`, 97},
+		{`bytes("abc")[-1]`, 99},
+		{`bytes("abc")[5]`, nil},
+		{`str(bytes("abc")[1:])`, "bc"},
+		{`hex(bytes([0, 15, 255]))`, "000fff"},
+		{`hex("hi")`, "6869"},
+		{`base64Encode(bytes("hello"))`, "aGVsbG8="},
+		{`str(base64Decode("aGVsbG8="))`, "hello"},
+		{`base64Decode(base64Encode(bytes([1, 2]))) == bytes([1, 2])`, true},
+		{`bytes("a") == bytes("b")`, false},
+		{`bytes([256])`, errorMessage("byte value out of range: 256")},
+		{`bytes(1)`, errorMessage("cannot convert INTEGER to BYTES")},
+		{`base64Decode("!!")`, errorMessage(`invalid base64 string: "!!"`)},
+		{`hex(1)`, errorMessage("argument to `hex` must be BYTES or STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBytesInspect(t *testing.T) {
+	evaluated := testEval(`bytes([104, 105, 0])`)
+	if evaluated.Inspect() != `b"hi\x00"` {
+		t.Errorf("bytes.Inspect() wrong. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestCryptoBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`sha256(bytes("abc"))`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`sha1("abc")`, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{`md5("")`, "d41d8cd98f00b204e9800998ecf8427e"},
+		{`hmacSha256("key", "The quick brown fox jumps over the lazy dog")`,
+			"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{`sha256(1)`, errorMessage("argument to `sha256` must be BYTES or STRING, got INTEGER")},
+		{`hmacSha256("key")`, errorMessage("wrong number of arguments. got=1, want=2")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestErrorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`error("boom")`, errorMessage("boom")},
+		{`let f = fn(x) { if (x < 0) { error("negative") } else { x } }; f(-1); 99`, errorMessage("negative")},
+		{`isError(error("boom"))`, true},
+		{`isError(1 + true)`, true},
+		{`isError(1)`, false},
+		{`let f = fn(x) { if (x < 0) { error("negative") } else { x } }; isError(f(-1))`, true},
+		{`error(1)`, errorMessage("argument to `error` must be STRING, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected object.ErrorKind
+	}{
+		{`1 + true`, object.TypeError},
+		{`foo`, object.NameError},
+		{`len(1, 2)`, object.ArgumentError},
+		{`int("x")`, object.ValueError},
+		{`assert(false)`, object.AssertionError},
+		{`import("missing")`, object.ImportError},
+		{`error("boom")`, object.RuntimeError},
+		{`error("boom", "ValidationError")`, "ValidationError"},
+	}
+
+	for _, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if err.ErrorKind() != tt.expected {
+			t.Errorf("wrong kind for %q. want=%s, got=%s", tt.input, tt.expected, err.ErrorKind())
+		}
+	}
+}
+
+func TestTryBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try(fn() { 1 }, fn(e) { 2 })`, "1"},
+		{`try(fn() { 1 + true }, fn(e) { e.kind })`, `"TypeError"`},
+		{`try(fn() { 1 + true }, fn(e) { e.message })`, `"type mismatch: INTEGER + BOOLEAN"`},
+		{`try(fn() { 1 + true }, fn(e) { [e.line, e.column, e.file] })`, "[1, 14, null]"},
+		{`let f = fn() { g() }; let g = fn() { error("no", "MyError") }; try(fn() { f(); 1 }, fn(e) { [e.kind, e.stack] })`,
+			`["MyError", ["g", "f"]]`},
+		// ハンドラーで投げ直したエラーは呼び出し元に伝わる
+		{`try(fn() { foo }, fn(e) { error(e.message, e.kind) })`, "ERROR: identifier not found: foo at 1:32 in try() called from main"},
+		{`try(1, fn(e) { e })`, "ERROR: first argument to `try` must be FUNCTION, got INTEGER at 1:4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 評価の上限によるエラーは捕捉しない
+	evaluated := testEvalWithConfig(`let loop = fn() { loop() }; try(loop, fn(e) { "caught" })`,
+		object.Config{MaxSteps: 100})
+	if err, ok := evaluated.(*object.Error); !ok || err.ErrorKind() != object.LimitError {
+		t.Errorf("expected limit error. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestCloneBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clone([1, [2, 3], {"a": [4]}]) == [1, [2, 3], {"a": [4]}]`, true},
+		{`clone(5)`, 5},
+		{`clone("s") == "s"`, true},
+		{`clone(set([1, 2])) == set([1, 2])`, true},
+		{`clone(bytes("ab")) == bytes("ab")`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestCloneIsDeep(t *testing.T) {
+	inner := &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}
+	original := &object.Array{Elements: []object.Object{inner, inner}}
+	// 自分自身を含む配列も複製できる
+	original.Elements = append(original.Elements, original)
+
+	copied, ok := cloneBuiltin(original).(*object.Array)
+	if !ok {
+		t.Fatalf("clone did not return Array")
+	}
+	if copied == original || copied.Elements[0] == inner {
+		t.Fatalf("clone returned shared arrays")
+	}
+	if copied.Elements[0] != copied.Elements[1] {
+		t.Errorf("shared elements should stay shared in the copy")
+	}
+	if copied.Elements[2] != copied {
+		t.Errorf("cyclic reference should point to the copy")
+	}
+}
+
+func TestAssertBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`assert(true)`, nil},
+		{`assert(1 < 2, "math works")`, nil},
+		{`assert(false)`, errorMessage("assertion failed")},
+		{`assert(1 > 2, "one is not greater")`, errorMessage("assertion failed: one is not greater")},
+		{`assertEq([1, 2], [1, 2])`, nil},
+		{`assertEq(1 + 1, 3)`, errorMessage("assertion failed: expected 3 (INTEGER), got 2 (INTEGER)")},
+		{`assertEq("1", 1)`, errorMessage("assertion failed: expected 1 (INTEGER), got \"1\" (STRING)")},
+		{`assert(false, "stop"); 1`, errorMessage("assertion failed: stop")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestCSVBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`csvParse("a,b\n1,\"x,y\"\n") == [["a", "b"], ["1", "x,y"]]`, true},
+		{`csvParse("name,age\nbob,3\n", {"header": true}) == [{"name": "bob", "age": "3"}]`, true},
+		{`csvParse("a,b\n1\n", {"header": true})[0]["b"]`, nil},
+		{`csvParse("")`, "[]"},
+		{`csvStringify([["a", "b,c"], [1, true]])`, "a,\"b,c\"\n1,true\n"},
+		{`csvParse("a,\"b\n")`, errorMessage("cannot parse csv: parse error on line 1, column 6: extraneous or missing \" in quoted-field")},
+		{`csvStringify([1])`, errorMessage("csv row must be ARRAY, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				testStringObject(t, str, expected)
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong value. expected=%q, got=%q", expected, evaluated.Inspect())
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRandomBuiltins(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	first := testEval(`uuid()`).(*object.String).Value
+	second := testEval(`uuid()`).(*object.String).Value
+	if !uuidPattern.MatchString(first) {
+		t.Errorf("uuid() has wrong format. got=%q", first)
+	}
+	if first == second {
+		t.Errorf("uuid() returned the same value twice: %q", first)
+	}
+
+	str := testEval(`randString(16)`).(*object.String).Value
+	if !regexp.MustCompile(`^[a-zA-Z0-9]{16}$`).MatchString(str) {
+		t.Errorf("randString(16) wrong. got=%q", str)
+	}
+
+	testStringObject(t, testEval(`randString(0)`), "")
+	testErrorObject(t, testEval(`randString(-1)`), "length must not be negative: -1")
+}
+
+func TestURLBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`urlParse("https://example.com:8080/a/b?x=1&y=2&y=3#top") == {
+			"scheme": "https", "host": "example.com", "port": "8080", "path": "/a/b",
+			"query": {"x": "1", "y": ["2", "3"]}, "fragment": "top"}`, true},
+		{`urlParse("http://example.com").query == {}`, true},
+		{`urlEncode("a b&c=d")`, "a+b%26c%3Dd"},
+		{`urlDecode("a+b%26c%3Dd")`, "a b&c=d"},
+		{`urlDecode("%zz")`, errorMessage(`cannot decode url: invalid URL escape "%zz"`)},
+		{`urlParse(":bad")`, errorMessage(`cannot parse url: parse ":bad": missing protocol scheme`)},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+func TestHashInspectOrder(t *testing.T) {
+	input := `{"b": 1, "a": [2], 3: {"z": 1, "y": 2}}`
+
+	evaluated := testEval(input)
+	expected := `{"b": 1, "a": [2], 3: {"z": 1, "y": 2}}`
+	if evaluated.Inspect() != expected {
+		t.Errorf("Inspect() wrong. want=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestIterableArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`collect("abc")`, []string{"a", "b", "c"}},
+		{`collect({"b": 1, "a": 2})`, []string{"b", "a"}},
+		{`collect(1..4)`, []int64{1, 2, 3}},
+		{`map(1..4, fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`filter("a1b", fn(c) { c != "1" })`, []string{"a", "b"}},
+		{`let g = fn() { yield 1; yield 2; yield 3 }; map(g(), fn(x) { x * 10 })`, []int64{10, 20, 30}},
+		{`let add = fn(a, b, c) { [a, b, c] }; add(...1..4)`, []int64{1, 2, 3}},
+		{`let add = fn(a, b) { [a, b] }; add(..."xy")`, []string{"x", "y"}},
+		{`let g = fn() { yield 1; yield 2 }; let f = fn(a, b) { [a, b] }; f(...g())`, []int64{1, 2}},
+		{`let g = fn() { yield 1; 1 + true }; map(g(), fn(x) { x })`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`let g = fn() { yield 1; 1 + true }; let f = fn(a) { a }; f(...g())`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`reduce(true, fn(a, b) { a })`, errorMessage("argument to `reduce` must be ITERABLE, got BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case []int64:
+			testIntegerArray(t, evaluated, expected)
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong number of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, s := range expected {
+				testStringObject(t, array.Elements[i], s)
+			}
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+}
+
+type boundAccount struct {
+	Owner   string
+	Balance int
+	Limit   int `monkey:"max"`
+	Parent  *boundAccount
+}
+
+func (a *boundAccount) Deposit(amount int) int {
+	a.Balance += amount
+	return a.Balance
+}
+
+func (a *boundAccount) Withdraw(amount int) (int, error) {
+	if amount > a.Balance {
+		return 0, errors.New("insufficient funds")
+	}
+	a.Balance -= amount
+	return a.Balance, nil
+}
+
+func (a boundAccount) Describe(prefix string, tags ...string) string {
+	return prefix + a.Owner + strings.Join(tags, "")
+}
+
+func TestGoObjectBinding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`account.owner`, "alice"},
+		{`account.max`, 50},
+		{`account.deposit(5); account.balance`, 15},
+		{`account.withdraw(3)`, 7},
+		{`account.withdraw(100)`, errorMessage("insufficient funds")},
+		{`account.describe("@", "!", "?")`, "@alice!?"},
+		{`account.parent.owner`, "bob"},
+		{`account.parent.parent`, nil},
+		{`account.deposit("x")`, errorMessage("argument 1: cannot convert STRING to int")},
+		{`account.deposit()`, errorMessage("wrong number of arguments. got=0, want=1")},
+		{`account.missing`, errorMessage("undefined property missing for *evaluator.boundAccount")},
+		{`type(account)`, "GO_OBJECT"},
+	}
+
+	for _, tt := range tests {
+		account := &boundAccount{Owner: "alice", Balance: 10, Limit: 50,
+			Parent: &boundAccount{Owner: "bob"}}
+		env := object.NewEnvironment()
+		env.Set("account", object.NewGoObject(account, nil))
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestEnvironmentSnapshot(t *testing.T) {
+	setup := `
+const limit = 100;
+fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }
+let makeAdder = fn(k) { fn(x) { x + k } };
+let add5 = makeAdder(5);
+let data = {"b": [1, 2], "a": set([3]), 2: bytes("hi")};
+let alias = data;
+class Point(x, y = 0) {
+	fn norm() { self.x * self.x + self.y * self.y }
+}
+let p = Point(3, 4);
+let r = 1..4;
+`
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(setup)).ParseProgram(), env)
+	env.Set("big", &object.BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)})
+
+	data, err := env.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot returned error: %s", err)
+	}
+	restored, err := object.RestoreEnvironment(data)
+	if err != nil {
+		t.Fatalf("RestoreEnvironment returned error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fib(10)", 55},
+		{"add5(1)", 6},
+		{"makeAdder(2)(3)", 5},
+		{`len(data["b"]) + len(data["a"]) + len(data[2])`, 5},
+		{`keys(data) == ["b", "a", 2]`, true},
+		{"p.norm()", 25},
+		{"Point(1, 1).norm()", 2},
+		{"len(r)", 3},
+		{"str(big)", "1267650600228229401496703205376"},
+		{"type(big)", "BIG_INTEGER"},
+		{"const limit = 1", errorMessage("cannot redeclare constant: limit")},
+	}
+
+	for _, tt := range tests {
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), restored)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testStringObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		}
+	}
+
+	// 同じオブジェクトへの参照は復元後も共有される
+	original, _ := restored.Get("data")
+	alias, _ := restored.Get("alias")
+	if original != alias {
+		t.Errorf("shared hash was not restored as the same object")
+	}
+
+	env.Set("print", builtins["puts"])
+	if _, err := env.Snapshot(); err == nil || err.Error() != "print: cannot snapshot BUILTIN" {
+		t.Errorf("Snapshot with builtin returned wrong error. got=%v", err)
+	}
+}
+
+func TestEvalUnmarshaledProgram(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let h = {"x": [1, 2], "y": true};
+let f = fn() { match (add(h["x"][1], 40)) { case 42 { "ok" } case _ { "ng" } } };
+f()`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+
+	data, err := ast.MarshalNode(program)
+	if err != nil {
+		t.Fatalf("MarshalNode returned error: %s", err)
+	}
+	node, err := ast.UnmarshalNode(data)
+	if err != nil {
+		t.Fatalf("UnmarshalNode returned error: %s", err)
+	}
+	testStringObject(t, Eval(node, object.NewEnvironment()), "ok")
+
+	// ハッシュのキー "x" を書き換えると h["x"][1] がエラーになる。その位置も復元されている
+	node, _ = ast.UnmarshalNode([]byte(strings.Replace(string(data), `"Value":"x"`, `"Value":"nope"`, 1)))
+	if node == nil {
+		t.Fatalf("UnmarshalNode failed")
+	}
+	evaluated := Eval(node, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.String() != "3:33" {
+		t.Errorf("error position wrong. got=%s", errObj.Pos)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// 末尾呼び出しがGoのスタックを消費しないことを、スタックの上限を下げて確かめる
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let loop = fn(n, acc) { if (n == 0) { return acc; } loop(n - 1, acc + 1) }; loop(100000, 0)", 100000},
+		{"let loop = fn(n) { if (n > 0) { return loop(n - 1); } n }; loop(100000)", 0},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100000)", true},
+		{`let m = fn(n) { match (n) { case 0 { "done" } case k { m(k - 1) } } }; m(100000)`, "done"},
+		{"let loop = fn(n, step = 1) { if (n < 1) { n } else { loop(n - step, step: 2) } }; loop(100001)", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("wrong result for %q. got=%s", tt.input, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(99)",
+			"99",
+		},
+		{
+			"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100)",
+			"ERROR: maximum call depth exceeded: 100 at 1:47 in f() x100 called from main",
+		},
+		// 組み込み関数のコールバックを介した再帰も数える
+		{
+			"let g = fn(x) { map([x], g) }; g(1)",
+			"ERROR: maximum call depth exceeded: 100 at 1:20 in map() x99 called from g() called from main",
+		},
+		{
+			"class A() { let a = A() }; A()",
+			"ERROR: maximum call depth exceeded: 100 at 1:22 in A() x100 called from main",
+		},
+		// 上限を超えた後も呼び出しの数は元に戻る
+		{
+			"let f = fn(n) { f(n + 1) + 1 }; let r = isError(f(0)); let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) + 1 } }; [r, g(99)]",
+			"[true, 99]",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithConfig(tt.input, object.Config{MaxCallDepth: 100})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// 既定では DefaultMaxCallDepth までに制限し、負の値なら制限しない
+	deep := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10000)"
+	testErrorObject(t, testEval(deep), "maximum call depth exceeded: 10000")
+	testIntegerObject(t, testEvalWithConfig(deep, object.Config{MaxCallDepth: -1}), 10000)
+}
+
+func TestEvalContext(t *testing.T) {
+	tests := []string{
+		// 末尾呼び出しの繰り返し
+		"let loop = fn() { loop() }; loop()",
+		// 末尾でない呼び出しと組み込み関数のコールバックを含む繰り返し
+		"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; let loop = fn(x) { let r = map([1, 2, 3], fn(y) { sum(y) }); loop(x + 1) }; loop(0)",
+	}
+
+	for _, input := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		result := EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+
+		err, ok := result.(*object.Error)
+		if !ok || !strings.HasPrefix(err.Message, "evaluation canceled: context deadline exceeded") {
+			t.Errorf("%q: expected cancellation error. got=%s", input, result.Inspect())
+		}
+	}
+
+	// 終了済みのコンテキストでは何も評価しない
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	env := object.NewEnvironment()
+	result := EvalContext(ctx, parser.New(lexer.New("let x = 1;")).ParseProgram(), env)
+	if !isError(result) {
+		t.Errorf("expected error. got=%v", result)
+	}
+	if _, ok := env.Get("x"); ok {
+		t.Errorf("program was evaluated after cancellation")
+	}
+	if env.Context() != nil {
+		t.Errorf("context was not restored")
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)", "0"},
+		{"let loop = fn() { loop() }; loop()", "ERROR: step limit exceeded: 1000 at 1:19 in loop() x2 called from main"},
+		// 上限を超えた後はエラーを受け取る組み込み関数でも評価を続けられない
+		{"let loop = fn() { loop() }; isError(loop()); 1", "ERROR: step limit exceeded: 1000 at 1:46"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithConfig(tt.input, object.Config{MaxSteps: 1000})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMaxStepsPerEvaluation(t *testing.T) {
+	env := object.NewEnvironment()
+	env.SetConfig(object.Config{MaxSteps: 1000})
+
+	// 同じ環境で評価を繰り返しても、手数は評価ごとに数える
+	program := parser.New(lexer.New("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(40)")).ParseProgram()
+	resolver.Resolve(program)
+	for i := 0; i < 2; i++ {
+		testIntegerObject(t, Eval(program, env), 0)
+	}
+	for i := 0; i < 2; i++ {
+		testIntegerObject(t, EvalContext(context.Background(), program, env), 0)
+	}
+
+	// 上限を超えた後も、次の評価は続けられる
+	testErrorObject(t, Eval(parser.New(lexer.New("let loop = fn() { loop() }; loop()")).ParseProgram(), env),
+		"step limit exceeded: 1000")
+	testIntegerObject(t, Eval(program, env), 0)
+}
+
+func TestMaxAllocation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "ab" * 100; len(s)`, "200"},
+		// ひとつで上限を超える値は作る前にエラーになる
+		{`"ab" * 1000000000000`, "ERROR: allocation limit exceeded: 65536 at 1:6"},
+		{`[1] * 100000`, "ERROR: allocation limit exceeded: 65536 at 1:5"},
+		{`map(0..1000000000000, fn(x) { x })`, "ERROR: allocation limit exceeded: 65536 at 1:4"},
+		// 作った量は累計で数える
+		{`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(arr + [n], n - 1) } }; len(grow([], 50))`, "50"},
+		{`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(arr + [n], n - 1) } }; len(grow([], 1000))`,
+			"ERROR: allocation limit exceeded: 65536 at 1:61 in grow() x2 called from main"},
+		{`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, n), n - 1) } }; len(grow([], 1000))`,
+			"ERROR: allocation limit exceeded: 65536 at 1:61 in grow() x2 called from main"},
+		// 引数をそのまま返す組み込み関数は数えない
+		{`let arr = [1] * 2000; let f = fn(n) { if (n == 0) { 0 } else { first([arr]); f(n - 1) } }; f(100)`, "0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithConfig(tt.input, object.Config{MaxAllocation: 1 << 16})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMaxAllocationPerEvaluation(t *testing.T) {
+	env := object.NewEnvironment()
+	env.SetConfig(object.Config{MaxAllocation: 1 << 16})
+
+	// 同じ環境で評価を繰り返しても、作った量は評価ごとに数える
+	program := parser.New(lexer.New(`len("ab" * 20000)`)).ParseProgram()
+	for i := 0; i < 3; i++ {
+		testIntegerObject(t, Eval(program, env), 40000)
+	}
+
+	// 上限を超えた後も、次の評価は続けられる
+	testErrorObject(t, Eval(parser.New(lexer.New(`"ab" * 40000`)).ParseProgram(), env),
+		"allocation limit exceeded: 65536")
+	testIntegerObject(t, Eval(program, env), 40000)
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		policy   *object.Policy
+		input    string
+		expected string
+	}{
+		{&object.Policy{}, `exec("true")`, "ERROR: process execution is disabled: exec at 1:5"},
+		{&object.Policy{}, `readFile("x")`, "ERROR: filesystem access is disabled: readFile at 1:9"},
+		{&object.Policy{}, `tcpConnect("localhost:1")`, "ERROR: network access is disabled: tcpConnect at 1:11"},
+		{&object.Policy{}, `env("HOME")`, "ERROR: environment access is disabled: env at 1:4"},
+		{&object.Policy{}, `import("x")`, "ERROR: module import is disabled: import at 1:7"},
+		// 関数の中や、値として渡した先で呼び出しても制限される
+		{&object.Policy{}, `let f = fn() { setEnv("X", "1") }; f()`, "ERROR: environment access is disabled: setEnv at 1:22 in f() called from main"},
+		{&object.Policy{}, `map(["x"], fileExists)`, "ERROR: filesystem access is disabled: fileExists at 1:4"},
+		{&object.Policy{AllowFileSystem: true}, `fileExists("/nonexistent/file")`, "false"},
+		// 制限されない組み込み関数は使える
+		{&object.Policy{}, `len([1, 2])`, "2"},
+		{nil, `fileExists("/nonexistent/file")`, "false"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		resolver.Resolve(program)
+		env := object.NewEnvironment()
+		env.SetPolicy(tt.policy)
+
+		evaluated := Eval(program, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+/*
+呼び出すとパニックする関数
+*/
+type panickingCallable struct{}
+
+func (panickingCallable) Type() object.ObjectType                 { return object.FUNCTION_OBJ }
+func (panickingCallable) Inspect() string                         { return "panickingCallable" }
+func (panickingCallable) Call(args []object.Object) object.Object { panic("callable bug") }
+
+func TestBuiltinPanic(t *testing.T) {
+	builtins["panicky"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		var arr []object.Object
+		return arr[len(args)]
+	}}
+	defer delete(builtins, "panicky")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`panicky()`, "ERROR: panic: runtime error: index out of range [0] with length 0 at 1:8"},
+		{`let f = fn() { panicky(1) }; f()`, "ERROR: panic: runtime error: index out of range [1] with length 0 at 1:23 in f() called from main"},
+		{`map([1], panicky)`, "ERROR: panic: runtime error: index out of range [1] with length 0 at 1:4"},
+		{`recv(spawn panicky())`, "ERROR: panic: runtime error: index out of range [0] with length 0 at 1:5"},
+		{`try(panicky, fn(e) { e.kind })`, `"InternalError"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSafeEval(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn() { callable() }; f()")).ParseProgram()
+	resolver.Resolve(program)
+	env := object.NewEnvironment()
+	env.Set("callable", panickingCallable{})
+
+	err, ok := SafeEval(program, env).(*object.Error)
+	if !ok || err.Message != "panic: callable bug" || err.ErrorKind() != object.InternalError {
+		t.Errorf("expected error from panic. got=%v", err)
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	for _, resolve := range []bool{false, true} {
+		b.Run(fmt.Sprintf("resolve=%t", resolve), func(b *testing.B) {
+			program := parser.New(lexer.New("let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(20)")).ParseProgram()
+			if resolve {
+				resolver.Resolve(program)
+			}
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
+
+func BenchmarkLocals(b *testing.B) {
+	input := `
+let sum = fn(n) {
+	let a = 1; let b = 2; let c = 3; let d = 4; let e = 5; let f = 6; let g = 7; let h = 8; let i = 9;
+	let loop = fn(k, acc) { if (k == 0) { return acc; } loop(k - 1, acc + a + b + c + d + e + f + g + h + i + n) };
+	loop(n, 0)
+};
+sum(2000)`
+	for _, resolve := range []bool{false, true} {
+		b.Run(fmt.Sprintf("resolve=%t", resolve), func(b *testing.B) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			if resolve {
+				resolver.Resolve(program)
+			}
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+func init() {
+	registerConfigured("collect", collect)
+}
+
+/*
+ジェネレーターを生成する。本体は最初の Next で goroutine として開始し、
+yield のたびにチャネルで値を受け渡して Next と交互に実行する。
+途中で使われなくなったジェネレーターは Close するか、最も外側の環境のコンテキストが終了すると本体の goroutine を終える
+*/
+func newGenerator(fn *object.Function, env *object.Environment) *object.Generator {
+	gen := &object.Generator{}
+
+	resume := make(chan struct{})
+	yields := make(chan object.Object)
+	done := make(chan object.Object, 1) // 閉じた後に本体が終わっても待たずに済むようにする
+	stop := make(chan struct{})
+	started := false
+	finished := false
+
+	// 閉じられるかコンテキストが終了したら、中断中の yield をエラーにして本体を抜けさせる
+	gen.Yield = func(val object.Object) object.Object {
+		ctx := env.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		select {
+		case yields <- val:
+		case <-stop:
+			return newErrorOf(object.LimitError, "generator closed")
+		case <-ctx.Done():
+			return canceledError(ctx)
+		}
+		select {
+		case <-resume:
+			return NULL
+		case <-stop:
+			return newErrorOf(object.LimitError, "generator closed")
+		case <-ctx.Done():
+			return canceledError(ctx)
+		}
+	}
+
+	finish := func(result object.Object) (object.Object, bool) {
+		finished = true
+		// エラーは呼び出し側に伝える。return の値は捨てる
+		if isError(result) {
+			return result, false
+		}
+		return NULL, false
+	}
+
+	gen.Next = func() (object.Object, bool) {
+		if finished {
+			return NULL, false
+		}
+
+		if started {
+			// コンテキストの終了で本体が先に終わっていれば再開しない
+			select {
+			case resume <- struct{}{}:
+			case result := <-done:
+				return finish(result)
+			}
+		} else {
+			started = true
+			go func() {
+				done <- SafeEval(fn.Body, env)
+			}()
+		}
+
+		select {
+		case val := <-yields:
+			return val, true
+		case result := <-done:
+			return finish(result)
+		}
+	}
+
+	gen.Close = func() {
+		if finished {
+			return
+		}
+		finished = true
+		close(stop)
+	}
+
+	env.SetGenerator(gen)
+
+	return gen
+}
+
+/*
+yield式を評価
+*/
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	gen, ok := env.Generator()
+	if !ok {
+		return newError("yield outside generator")
+	}
+
+	var val object.Object = NULL
+	if node.Value != nil {
+		val = Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+	}
+
+	return gen.Yield(val)
+}
+
+/*
+ジェネレーターの next メソッド。{"value": 値, "done": 終了したかどうか} を返す
+*/
+func generatorNext(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+
+	val, ok := args[0].(*object.Generator).Next()
+	if isError(val) {
+		return val
+	}
+
+	return newStringHash(
+		[]string{"value", "done"},
+		[]object.Object{val, nativeBoolToBooleanObject(!ok)},
+	)
+}
+
+/*
+ジェネレーターの close メソッド。以降の next は done を返し、中断中の本体は終わる
+*/
+func generatorClose(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+
+	args[0].(*object.Generator).Close()
+	return NULL
+}
+
+/*
+ジェネレーターなどイテラブルなオブジェクトの要素を最後まで取り出して配列にする
+*/
+func collect(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	elements, err := iterableArgument(config, "argument to `collect`", args[0])
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: elements}
+}
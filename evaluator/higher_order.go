@@ -0,0 +1,226 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"sort"
+)
+
+/*
+関数を引数に取る組み込み関数。applyFunction を使うため初期化の循環を避けて init で登録する。
+取り出す要素の数を Config の MaxAllocation で制限する
+*/
+func init() {
+	registerConfigured("map", mapBuiltin)
+	registerConfigured("filter", filterBuiltin)
+	registerConfigured("reduce", reduceBuiltin)
+	registerConfigured("sort", sortBuiltin)
+
+	// 配列のメソッドとしても呼び出せるようにする
+	methods[object.ARRAY_OBJ]["map"] = builtins["map"]
+	methods[object.ARRAY_OBJ]["filter"] = builtins["filter"]
+}
+
+/*
+イテラブルなオブジェクトの要素を最後まで取り出して並べる。並べた配列が config の MaxAllocation を超えればエラーを返す
+*/
+func iterableElements(iterable object.Iterable, config object.Config) ([]object.Object, object.Object) {
+	elements := []object.Object{}
+	it := iterable.Iterator()
+	for {
+		val, ok := it.Next()
+		if !ok {
+			if val != nil && isError(val) {
+				return nil, val
+			}
+			return elements, nil
+		}
+		if err := checkAllocation(config, int64(len(elements))+1, elementSize); err != nil {
+			return nil, err
+		}
+		elements = append(elements, val)
+	}
+}
+
+/*
+組み込み関数の引数からイテラブルなオブジェクトの要素を取り出す。
+イテラブルでない場合はdescriptionを使ったエラーを返す
+*/
+func iterableArgument(config object.Config, description string, obj object.Object) ([]object.Object, object.Object) {
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "%s must be ITERABLE, got %s", description, obj.Type())
+	}
+	return iterableElements(iterable, config)
+}
+
+/*
+関数として呼び出せるオブジェクトかどうか判定
+*/
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin, *object.Class:
+		return true
+	case object.Callable:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+map(arr, fn): 各要素に関数を適用した結果の配列を返す
+*/
+func mapBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	elements, err := iterableArgument(config, "argument to `map`", args[0])
+	if err != nil {
+		return err
+	}
+	if !isCallable(args[1]) {
+		return newErrorOf(object.TypeError, "second argument to `map` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	result := make([]object.Object, 0, len(elements))
+	for _, el := range elements {
+		mapped := applyFunction(args[1], []object.Object{el})
+		if isError(mapped) {
+			return mapped
+		}
+		result = append(result, mapped)
+	}
+
+	return &object.Array{Elements: result}
+}
+
+/*
+filter(arr, fn): 関数が真を返した要素だけの配列を返す
+*/
+func filterBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	elements, err := iterableArgument(config, "argument to `filter`", args[0])
+	if err != nil {
+		return err
+	}
+	if !isCallable(args[1]) {
+		return newErrorOf(object.TypeError, "second argument to `filter` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	result := []object.Object{}
+	for _, el := range elements {
+		keep := applyFunction(args[1], []object.Object{el})
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			result = append(result, el)
+		}
+	}
+
+	return &object.Array{Elements: result}
+}
+
+/*
+reduce(arr, fn, initial): 累積値と要素に関数を順に適用した結果を返す。
+initialを省略した場合は最初の要素を初期値にする
+*/
+func reduceBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+	elements, err := iterableArgument(config, "argument to `reduce`", args[0])
+	if err != nil {
+		return err
+	}
+	if !isCallable(args[1]) {
+		return newErrorOf(object.TypeError, "second argument to `reduce` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return newErrorOf(object.ValueError, "reduce of empty array with no initial value")
+		}
+		acc = elements[0]
+		elements = elements[1:]
+	}
+
+	for _, el := range elements {
+		acc = applyFunction(args[1], []object.Object{acc, el})
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+/*
+sort(arr, fn): 要素を並べ替えた新しい配列を返す。並べ替えは安定である。
+比較関数を省略した場合は整数または文字列の昇順に並べる。
+比較関数は a が b より前なら真(または負の整数)を返す
+*/
+func sortBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	elements, err := iterableArgument(config, "argument to `sort`", args[0])
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]object.Object, len(elements))
+	copy(sorted, elements)
+
+	var less func(a, b object.Object) bool
+
+	if len(args) == 2 {
+		if !isCallable(args[1]) {
+			return newErrorOf(object.TypeError, "second argument to `sort` must be FUNCTION, got %s", args[1].Type())
+		}
+		less = func(a, b object.Object) bool {
+			result := applyFunction(args[1], []object.Object{a, b})
+			switch result := result.(type) {
+			case *object.Boolean:
+				return result.Value
+			case *object.Integer:
+				return result.Value < 0
+			case *object.Error:
+				err = result
+			default:
+				err = newErrorOf(object.TypeError, "comparator must return BOOLEAN or INTEGER, got %s", result.Type())
+			}
+			return false
+		}
+	} else if len(sorted) > 0 {
+		for _, el := range sorted[1:] {
+			if el.Type() != sorted[0].Type() {
+				return newErrorOf(object.TypeError, "cannot sort mixed types: %s and %s", sorted[0].Type(), el.Type())
+			}
+		}
+		if sorted[0].Type() != object.INTEGER_OBJ && sorted[0].Type() != object.STRING_OBJ {
+			return newErrorOf(object.TypeError, "cannot sort %s without a comparator", sorted[0].Type())
+		}
+		less = func(a, b object.Object) bool {
+			return evalInfixExpression("<", a, b, config) == TRUE
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		// エラーが起きた後は比較関数を呼び出さない
+		if err != nil {
+			return false
+		}
+		return less(sorted[i], sorted[j])
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: sorted}
+}
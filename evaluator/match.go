@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+match式を評価。最初にパターンが一致した分岐の本体を、束縛を含む新しい環境で evalBody によって評価する
+*/
+func evalMatchExpression(
+	node *ast.MatchExpression,
+	env *object.Environment,
+	evalBody func(ast.Node, *object.Environment) object.Object,
+) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		matched, err := matchPattern(arm.Pattern, subject, armEnv, env)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return evalBody(arm.Body, armEnv)
+		}
+	}
+
+	return NULL
+}
+
+/*
+パターンと値を照合する。一致した場合は識別子パターンをarmEnvに束縛する。
+パターン中の式(リテラルやハッシュのキー)はenvで評価する
+*/
+func matchPattern(
+	pattern ast.Expression,
+	value object.Object,
+	armEnv, env *object.Environment,
+) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	// 識別子は任意の値に一致して束縛する。`_`は束縛しない
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			armEnv.Set(pattern.Value, value)
+		}
+		return true, nil
+
+	// 配列パターンは要素数が同じ配列の各要素と照合する
+	case *ast.ArrayLiteral:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) != len(pattern.Elements) {
+			return false, nil
+		}
+		for i, elementPattern := range pattern.Elements {
+			matched, err := matchPattern(elementPattern, array.Elements[i], armEnv, env)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	// ハッシュパターンは指定されたキーを全て持つハッシュの値と照合する
+	case *ast.HashLiteral:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for _, keyNode := range pattern.OrderedKeys() {
+			valuePattern := pattern.Pairs[keyNode]
+			key := Eval(keyNode, env)
+			if isError(key) {
+				return false, key.(*object.Error)
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return false, newErrorOf(object.TypeError, "unusable as hash key: %s", key.Type())
+			}
+			pair, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return false, nil
+			}
+			matched, err := matchPattern(valuePattern, pair.Value, armEnv, env)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	// それ以外のパターンは式として評価し、値が等しいかどうかで照合する
+	default:
+		expected := Eval(pattern, env)
+		if isError(expected) {
+			return false, expected.(*object.Error)
+		}
+		return objectsEqual(expected, value), nil
+	}
+}
@@ -0,0 +1,292 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"strings"
+)
+
+/*
+型ごとのメソッドテーブル。メソッドはレシーバを第一引数に受け取る組み込み関数として定義する
+*/
+var methods = map[object.ObjectType]map[string]*object.Builtin{
+	object.STRING_OBJ: {
+		"len":        builtins["len"],
+		"upper":      &object.Builtin{Fn: stringUpper},
+		"lower":      &object.Builtin{Fn: stringLower},
+		"trim":       &object.Builtin{Fn: stringTrim},
+		"split":      &object.Builtin{Fn: stringSplit},
+		"contains":   &object.Builtin{Fn: stringContains},
+		"replace":    &object.Builtin{Fn: stringReplace},
+		"startsWith": &object.Builtin{Fn: stringStartsWith},
+	},
+	object.ARRAY_OBJ: {
+		"len":   builtins["len"],
+		"first": builtins["first"],
+		"last":  builtins["last"],
+		"rest":  builtins["rest"],
+		"push":  builtins["push"],
+		"join":  &object.Builtin{Fn: arrayJoin},
+	},
+	object.HASH_OBJ: {
+		"len":     &object.Builtin{Fn: hashLen},
+		"keys":    &object.Builtin{Fn: hashKeys},
+		"values":  &object.Builtin{Fn: hashValues},
+		"entries": &object.Builtin{Fn: hashEntries},
+		"has":     &object.Builtin{Fn: hashHas},
+		"delete":  &object.Builtin{Fn: hashDelete},
+	},
+	object.SET_OBJ: {
+		"len":        builtins["len"],
+		"add":        &object.Builtin{Fn: setAdd},
+		"remove":     &object.Builtin{Fn: setRemove},
+		"union":      &object.Builtin{Fn: setUnion},
+		"intersect":  &object.Builtin{Fn: setIntersect},
+		"difference": &object.Builtin{Fn: setDifference},
+	},
+	object.GENERATOR_OBJ: {
+		"next":  &object.Builtin{Fn: generatorNext},
+		"close": &object.Builtin{Fn: generatorClose},
+	},
+}
+
+/*
+レシーバに束縛されたメソッドを取得
+*/
+func lookupMethod(receiver object.Object, name string) (*object.Builtin, bool) {
+	table, ok := methods[receiver.Type()]
+	if !ok {
+		return nil, false
+	}
+
+	method, ok := table[name]
+	if !ok {
+		return nil, false
+	}
+
+	bound := &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			return method.Fn(append([]object.Object{receiver}, args...)...)
+		},
+	}
+
+	return bound, true
+}
+
+func stringUpper(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+	return &object.String{Value: strings.ToUpper(args[0].(*object.String).Value)}
+}
+
+func stringLower(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+	return &object.String{Value: strings.ToLower(args[0].(*object.String).Value)}
+}
+
+func stringTrim(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+	return &object.String{Value: strings.TrimSpace(args[0].(*object.String).Value)}
+}
+
+func stringSplit(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	sep, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `split` must be STRING, got %s", args[1].Type())
+	}
+
+	parts := strings.Split(args[0].(*object.String).Value, sep.Value)
+	elements := make([]object.Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &object.String{Value: part}
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+/*
+部分文字列を含むかどうか判定
+*/
+func stringContains(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	substr, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `contains` must be STRING, got %s", args[1].Type())
+	}
+	return nativeBoolToBooleanObject(strings.Contains(args[0].(*object.String).Value, substr.Value))
+}
+
+/*
+部分文字列を全て置き換えた新しい文字列を返す
+*/
+func stringReplace(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args)-1)
+	}
+	old, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "first argument to `replace` must be STRING, got %s", args[1].Type())
+	}
+	replacement, ok := args[2].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "second argument to `replace` must be STRING, got %s", args[2].Type())
+	}
+	return &object.String{Value: strings.ReplaceAll(args[0].(*object.String).Value, old.Value, replacement.Value)}
+}
+
+/*
+接頭辞で始まるかどうか判定
+*/
+func stringStartsWith(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	prefix, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `startsWith` must be STRING, got %s", args[1].Type())
+	}
+	return nativeBoolToBooleanObject(strings.HasPrefix(args[0].(*object.String).Value, prefix.Value))
+}
+
+/*
+要素を区切り文字でつないだ文字列を返す。文字列以外の要素は puts と同じ表記でつなぐ
+*/
+func arrayJoin(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	sep, ok := args[1].(*object.String)
+	if !ok {
+		return newErrorOf(object.TypeError, "argument to `join` must be STRING, got %s", args[1].Type())
+	}
+
+	elements := args[0].(*object.Array).Elements
+	parts := make([]string, len(elements))
+	for i, el := range elements {
+		if str, ok := el.(*object.String); ok {
+			parts[i] = str.Value
+		} else {
+			parts[i] = el.Inspect()
+		}
+	}
+
+	return &object.String{Value: strings.Join(parts, sep.Value)}
+}
+
+func hashLen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+	return &object.Integer{Value: int64(len(args[0].(*object.Hash).Pairs))}
+}
+
+func hashKeys(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+
+	hash := args[0].(*object.Hash)
+	keys := make([]object.Object, 0, len(hash.Pairs))
+	for _, pair := range hash.OrderedPairs() {
+		keys = append(keys, pair.Key)
+	}
+
+	return &object.Array{Elements: keys}
+}
+
+func hashValues(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+
+	hash := args[0].(*object.Hash)
+	values := make([]object.Object, 0, len(hash.Pairs))
+	for _, pair := range hash.OrderedPairs() {
+		values = append(values, pair.Value)
+	}
+
+	return &object.Array{Elements: values}
+}
+
+func hashEntries(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0", len(args)-1)
+	}
+
+	hash := args[0].(*object.Hash)
+	entries := make([]object.Object, 0, len(hash.Pairs))
+	for _, pair := range hash.OrderedPairs() {
+		entries = append(entries, &object.Array{Elements: []object.Object{pair.Key, pair.Value}})
+	}
+
+	return &object.Array{Elements: entries}
+}
+
+/*
+キーが存在するかどうか判定する。値がnullのキーも存在するものとみなす
+*/
+func hashHas(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newErrorOf(object.TypeError, "unusable as hash key: %s", args[1].Type())
+	}
+
+	_, ok = args[0].(*object.Hash).Pairs[key.HashKey()]
+	return nativeBoolToBooleanObject(ok)
+}
+
+/*
+キーを取り除いた新しいハッシュを返す。元のハッシュは変更しない
+*/
+func hashDelete(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newErrorOf(object.TypeError, "unusable as hash key: %s", args[1].Type())
+	}
+
+	hash := args[0].(*object.Hash)
+	removed := key.HashKey()
+	result := &object.Hash{}
+	for _, pair := range hash.OrderedPairs() {
+		hashed := pair.Key.(object.Hashable).HashKey()
+		if hashed != removed {
+			result.Set(hashed, pair)
+		}
+	}
+
+	return result
+}
+
+/*
+ハッシュのメソッドを同名の組み込み関数として呼び出せるようにする
+*/
+func hashBuiltin(name string, method object.BuiltinFunction, arity int) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != arity {
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=%d", len(args), arity)
+			}
+			if args[0].Type() != object.HASH_OBJ {
+				return newErrorOf(object.TypeError, "argument to `%s` must be HASH, got %s", name, args[0].Type())
+			}
+			return method(args...)
+		},
+	}
+}
@@ -0,0 +1,319 @@
+package evaluator
+
+import (
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/*
+モジュールファイルの拡張子
+*/
+const ModuleExtension = ".mk"
+
+/*
+モジュールローダー。読み込んだモジュールをキャッシュし、循環インポートを検出する。
+モジュールはインポートしたインタプリタのコンテキストや上限までの量で評価するので、
+import で読み込んだモジュールはインタプリタの最も外側の環境にキャッシュする。
+spawn した関数から並行にインポートできるよう、読み込み中のモジュールはインポート元の環境ごとにたどり、
+同じモジュールを並行に読み込んだ場合は最初の読み込みの評価が終わるのを待って、モジュールを一度だけ評価する
+*/
+type ModuleLoader struct {
+	SearchPaths []string // 相対パス以外のモジュール名を探すディレクトリ
+
+	cache *moduleCache // Load で読み込んだモジュールのキャッシュ
+}
+
+/*
+モジュールのキャッシュ。評価中のモジュールも登録し、同じモジュールの読み込みは評価が終わるまで待たせる
+*/
+type moduleCache struct {
+	mu      sync.Mutex
+	entries map[moduleKey]*moduleEntry
+	waiting map[string]string // 評価中のモジュールの絶対パスと、そのモジュールの評価が終わるのを待っているモジュールの絶対パス
+}
+
+/*
+キャッシュに登録したモジュール。done を閉じた後に module を読む
+*/
+type moduleEntry struct {
+	done   chan struct{}
+	module object.Object // 公開された束縛のハッシュか、評価のエラー
+}
+
+func newModuleCache() *moduleCache {
+	return &moduleCache{
+		entries: make(map[moduleKey]*moduleEntry),
+		waiting: make(map[string]string),
+	}
+}
+
+/*
+モジュールのキャッシュのキー。モジュールの関数は読み込んだときの Policy で組み込み関数を使うので、
+Policy が異なれば別に評価する
+*/
+type moduleKey struct {
+	path       string
+	policy     object.Policy
+	restricted bool // Policy がセットされているかどうか
+}
+
+/*
+新規モジュールローダーを生成
+*/
+func NewModuleLoader(searchPaths ...string) *ModuleLoader {
+	return &ModuleLoader{
+		SearchPaths: searchPaths,
+		cache:       newModuleCache(),
+	}
+}
+
+/*
+import組み込み関数が使用するモジュールローダー
+*/
+var DefaultModuleLoader = NewModuleLoader(".")
+
+func init() {
+	builtins["import"] = importBuiltin(nil)
+}
+
+/*
+importer の環境から呼び出す import 組み込み関数を生成。入れ子のインポートは importer で評価中のモジュールから
+相対パスを解決し、importer のコンテキストや Policy、Config を読み込むモジュールの評価にも適用する。
+importer が nil ならトップレベルから読み込む
+*/
+func importBuiltin(importer *object.Environment) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newErrorOf(object.TypeError, "argument to `import` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			return DefaultModuleLoader.load(args[0].(*object.String).Value, importer)
+		},
+	}
+}
+
+/*
+モジュールを読み込み、公開された束縛のハッシュを返す。
+一度評価したモジュールはキャッシュから返す
+*/
+func (ml *ModuleLoader) Load(name string) object.Object {
+	return ml.load(name, nil)
+}
+
+/*
+importer の環境からモジュールを読み込む。モジュールの評価の手数や作った値の大きさは importer の評価に含める
+*/
+func (ml *ModuleLoader) load(name string, importer *object.Environment) object.Object {
+	var imports []string
+	var policy *object.Policy
+	if importer != nil {
+		imports = importer.Imports()
+		policy = importer.Policy()
+	}
+
+	path, ok := ml.resolve(name, imports)
+	if !ok {
+		return newErrorOf(object.ImportError, "module not found: %s", name)
+	}
+
+	key := moduleKey{path: path}
+	if policy != nil {
+		key.policy = *policy
+		key.restricted = true
+	}
+	cache := ml.cacheFor(importer)
+	entry, loaded, err := cache.acquire(key, imports)
+	if err != nil {
+		return err
+	}
+	if !loaded {
+		entry.module = ml.evaluate(name, path, importer, imports)
+		cache.release(key, entry)
+	}
+
+	// エラーは呼び出し側で位置や呼び出し履歴を書き込むので、ほかの読み込みと共有しない
+	if err, ok := entry.module.(*object.Error); ok {
+		copied := *err
+		copied.Stack = append([]string(nil), err.Stack...)
+		return &copied
+	}
+	return entry.module
+}
+
+/*
+モジュールのファイルを読み込んで評価し、公開された束縛のハッシュを返す
+*/
+func (ml *ModuleLoader) evaluate(name, path string, importer *object.Environment, imports []string) object.Object {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return newErrorOf(object.ImportError, "could not read module %s: %s", name, err)
+	}
+
+	l := lexer.New(string(source))
+	l.SetFile(path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newErrorOf(object.ImportError, "parse errors in module %s: %s",
+			name, strings.Join(p.Errors(), "; "))
+	}
+	resolver.Resolve(program)
+
+	env := object.NewModuleEnvironment(importer, append(imports[:len(imports):len(imports)], path))
+	result := Eval(program, env)
+	if isError(result) {
+		return result
+	}
+
+	return exportBindings(env)
+}
+
+/*
+importer のインタプリタのモジュールのキャッシュを取得。importer がなければローダーのキャッシュを使う
+*/
+func (ml *ModuleLoader) cacheFor(importer *object.Environment) *moduleCache {
+	if importer == nil {
+		return ml.cache
+	}
+	return importer.ModuleCache(func() interface{} { return newModuleCache() }).(*moduleCache)
+}
+
+/*
+key のモジュールを評価済みのものから探す。評価中なら終わるのを待ち、loaded を真にして返す。
+まだ読み込まれていなければ評価中として登録し、呼び出し側で評価して release を呼ぶ。
+imports の評価中のモジュールを待つことになる場合は、評価が終わらないので循環インポートのエラーを返す
+*/
+func (c *moduleCache) acquire(key moduleKey, imports []string) (entry *moduleEntry, loaded bool, err *object.Error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &moduleEntry{done: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+		return entry, false, nil
+	}
+
+	select {
+	case <-entry.done:
+		c.mu.Unlock()
+		return entry, true, nil
+	default:
+	}
+
+	// 待つ先のモジュールが、ほかの読み込みを介して imports の評価中のモジュールを待っていないか確かめる
+	waited := []string{key.path}
+	for path := key.path; ; {
+		for i, loading := range imports {
+			if loading == path {
+				c.mu.Unlock()
+				cycle := append(append([]string{}, imports[i:]...), waited...)
+				return nil, false, newErrorOf(object.ImportError, "import cycle detected: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		next, ok := c.waiting[path]
+		if !ok || len(waited) > len(c.waiting) {
+			break
+		}
+		waited = append(waited, next)
+		path = next
+	}
+
+	for _, loading := range imports {
+		c.waiting[loading] = key.path
+	}
+	c.mu.Unlock()
+
+	<-entry.done
+
+	c.mu.Lock()
+	for _, loading := range imports {
+		if c.waiting[loading] == key.path {
+			delete(c.waiting, loading)
+		}
+	}
+	c.mu.Unlock()
+	return entry, true, nil
+}
+
+/*
+acquire で登録したモジュールの評価が終わったことを知らせる。エラーになったモジュールは次の読み込みで評価し直す
+*/
+func (c *moduleCache) release(key moduleKey, entry *moduleEntry) {
+	c.mu.Lock()
+	if isError(entry.module) {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+}
+
+/*
+モジュール名をファイルの絶対パスに解決する。
+./ や ../ で始まる名前は imports の最後のモジュール(トップレベルではカレントディレクトリ)からの相対パス、
+それ以外は検索パスから探す。拡張子が省略された場合は補う
+*/
+func (ml *ModuleLoader) resolve(name string, imports []string) (string, bool) {
+	if filepath.Ext(name) == "" {
+		name += ModuleExtension
+	}
+
+	candidates := []string{}
+	switch {
+	case filepath.IsAbs(name):
+		candidates = append(candidates, name)
+	case strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../"):
+		base := "."
+		if len(imports) > 0 {
+			base = filepath.Dir(imports[len(imports)-1])
+		}
+		candidates = append(candidates, filepath.Join(base, name))
+	default:
+		for _, dir := range ml.SearchPaths {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		abs, err := filepath.Abs(candidate)
+		if err != nil {
+			continue
+		}
+		return abs, true
+	}
+
+	return "", false
+}
+
+/*
+モジュールのトップレベルの束縛をハッシュにまとめる。_ で始まる名前は公開しない
+*/
+func exportBindings(env *object.Environment) *object.Hash {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+
+	for _, name := range env.Names() {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		val, _ := env.Get(name)
+		key := &object.String{Value: name}
+		hash.Set(key.HashKey(), object.HashPair{Key: key, Value: val})
+	}
+
+	return hash
+}
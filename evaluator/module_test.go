@@ -0,0 +1,232 @@
+package evaluator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/resolver"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func useModuleLoader(t *testing.T, loader *ModuleLoader) {
+	t.Helper()
+
+	original := DefaultModuleLoader
+	DefaultModuleLoader = loader
+	t.Cleanup(func() { DefaultModuleLoader = original })
+}
+
+func TestImport(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"math.mk":        `let square = fn(x) { x * x }; let _hidden = 1;`,
+		"lib/helper.mk":  `let two = fn() { 2 };`,
+		"broken.mk":      `let x = ;`,
+		"failing.mk":     `let x = 1 + true;`,
+		"cycle/a.mk":     `let b = import("./b");`,
+		"cycle/b.mk":     `let a = import("./a");`,
+		"uses_helper.mk": `let helper = import("./lib/helper"); let four = helper.two() * 2;`,
+	})
+	useModuleLoader(t, NewModuleLoader(dir))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import("uses_helper"); m.four`, 4},
+		{`let m = import("uses_helper.mk"); m.helper.two()`, 2},
+		{`let {four} = import("uses_helper"); four`, 4},
+		{`import("uses_helper") == import("uses_helper")`, true},
+		{`import("math")._hidden`, nil},
+		{`import("missing")`, errorMessage("module not found: missing")},
+		{`import(1)`, errorMessage("argument to `import` must be STRING, got INTEGER")},
+		{`import("failing")`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case errorMessage:
+			testErrorObject(t, evaluated, string(expected))
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	broken := testEval(`import("broken")`)
+	errObj, ok := broken.(*object.Error)
+	if !ok || !strings.HasPrefix(errObj.Message, "parse errors in module broken:") {
+		t.Errorf("expected parse error for broken module. got=%+v", broken)
+	}
+
+	cycle := testEval(`import("cycle/a")`)
+	errObj, ok = cycle.(*object.Error)
+	if !ok || !strings.HasPrefix(errObj.Message, "import cycle detected:") {
+		t.Errorf("expected import cycle error. got=%+v", cycle)
+	}
+}
+
+func TestImportWithPolicy(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"files.mk": `let exists = fn(path) { fileExists(path) };`,
+	})
+	useModuleLoader(t, NewModuleLoader(dir))
+
+	eval := func(policy *object.Policy, input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		resolver.Resolve(program)
+		env := object.NewEnvironment()
+		env.SetPolicy(policy)
+		return Eval(program, env)
+	}
+
+	// 制限のない環境で読み込んだモジュールを、制限された環境でキャッシュから使うことはできない
+	testBooleanObject(t, eval(nil, `import("files").exists("/nonexistent")`), false)
+	testErrorObject(t, eval(&object.Policy{AllowImport: true}, `import("files").exists("/nonexistent")`),
+		"filesystem access is disabled: fileExists")
+	testBooleanObject(t, eval(&object.Policy{AllowImport: true, AllowFileSystem: true}, `import("files").exists("/nonexistent")`), false)
+}
+
+func TestConcurrentImport(t *testing.T) {
+	files := map[string]string{
+		"lib/shared.mk": `let base = 10;`,
+	}
+	for i := 1; i <= 9; i++ {
+		n := strconv.Itoa(i)
+		files["m"+n+".mk"] = `let shared = import("./lib/shared"); let value = shared.base + import("./lib/v` + n + `").value;`
+		files["lib/v"+n+".mk"] = `let value = ` + n + `;`
+	}
+	useModuleLoader(t, NewModuleLoader(writeModules(t, files)))
+
+	// 並行に読み込んでも、入れ子のインポートはそれぞれのモジュールから相対パスを解決する
+	evaluated := testEval(`let cs = map(1..10, fn(i) { spawn import("m" + str(i)) }); map(cs, fn(c) { recv(c).value })`)
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(array.Elements) != 9 {
+		t.Fatalf("wrong number of modules. got=%d", len(array.Elements))
+	}
+	for i, el := range array.Elements {
+		testIntegerObject(t, el, int64(11+i))
+	}
+}
+
+func TestImportUsesImporterState(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"spin.mk":    `let loop = fn() { loop() }; loop();`,
+		"counter.mk": `let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };`,
+		"big.mk":     `let text = "ab" * 1000;`,
+	})
+	useModuleLoader(t, NewModuleLoader(dir))
+
+	eval := func(env *object.Environment, input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		resolver.Resolve(program)
+		return Eval(program, env)
+	}
+
+	// モジュールの評価もインポートした評価のコンテキストで打ち切る
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result := EvalContext(ctx, parser.New(lexer.New(`import("spin")`)).ParseProgram(), object.NewEnvironment())
+	err, ok := result.(*object.Error)
+	if !ok || !strings.HasPrefix(err.Message, "evaluation canceled: context deadline exceeded") {
+		t.Errorf("expected cancellation error. got=%s", result.Inspect())
+	}
+
+	// モジュールの評価とモジュールの関数の呼び出しも、インポートした環境の上限までの量に含める
+	limited := object.NewEnvironment()
+	limited.SetConfig(object.Config{MaxSteps: 1000, MaxAllocation: 1000})
+	testErrorObject(t, eval(limited, `import("spin")`), "step limit exceeded: 1000")
+	testErrorObject(t, eval(limited, `import("big")`), "allocation limit exceeded: 1000")
+	testIntegerObject(t, eval(limited, `import("counter").count(10)`), 0)
+	testErrorObject(t, eval(limited, `import("counter").count(1000)`), "step limit exceeded: 1000")
+
+	// 読み込んだモジュールはインタプリタごとにキャッシュするので、ほかの環境の上限は適用されない
+	testIntegerObject(t, eval(object.NewEnvironment(), `import("counter").count(1000)`), 0)
+}
+
+func TestConcurrentImportEvaluatesOnce(t *testing.T) {
+	var loads int64
+	builtins["countLoad"] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		atomic.AddInt64(&loads, 1)
+		return NULL
+	}}
+	defer delete(builtins, "countLoad")
+
+	useModuleLoader(t, NewModuleLoader(writeModules(t, map[string]string{
+		"slow.mk": `countLoad(); let total = reduce(0..20000, fn(acc, x) { acc + x }, 0);`,
+	})))
+
+	// 並行に読み込んでも、評価は一度だけで、すべての読み込みが同じモジュールを受け取る
+	evaluated := testEval(`let cs = map(0..8, fn(i) { spawn import("slow") }); let ms = map(cs, recv); filter(ms, fn(m) { m == ms[0] })`)
+	array, ok := evaluated.(*object.Array)
+	if !ok || len(array.Elements) != 8 {
+		t.Fatalf("expected the same module 8 times. got=%s", evaluated.Inspect())
+	}
+	if loads != 1 {
+		t.Errorf("module was evaluated %d times", loads)
+	}
+}
+
+func TestConcurrentImportCycle(t *testing.T) {
+	useModuleLoader(t, NewModuleLoader(writeModules(t, map[string]string{
+		"a.mk": `let pause = reduce(0..2000, fn(acc, x) { acc + x }, 0); let b = import("b");`,
+		"b.mk": `let pause = reduce(0..2000, fn(acc, x) { acc + x }, 0); let a = import("a");`,
+	})))
+
+	// 別々に読み込み始めた循環インポートも、互いに待ち続けずにエラーにする
+	done := make(chan object.Object, 1)
+	go func() {
+		done <- testEval(`
+let ca = spawn import("a");
+let cb = spawn import("b");
+let message = fn(c) { try(fn() { recv(c) }, fn(e) { e["message"] }) };
+[message(ca), message(cb)]`)
+	}()
+
+	select {
+	case evaluated := <-done:
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+		}
+		for _, el := range array.Elements {
+			message, ok := el.(*object.String)
+			if !ok || !strings.HasPrefix(message.Value, "import cycle detected:") {
+				t.Errorf("expected import cycle error. got=%s", el.Inspect())
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("concurrent cyclic imports deadlocked")
+	}
+}
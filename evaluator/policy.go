@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+/*
+組み込み関数を使うのに必要な操作
+*/
+type capability int
+
+const (
+	capFileSystem capability = iota
+	capNetwork
+	capExec
+	capEnv
+	capImport
+)
+
+func (c capability) String() string {
+	switch c {
+	case capFileSystem:
+		return "filesystem access"
+	case capNetwork:
+		return "network access"
+	case capExec:
+		return "process execution"
+	case capEnv:
+		return "environment access"
+	default:
+		return "module import"
+	}
+}
+
+/*
+操作が許可されているかどうか判定
+*/
+func (c capability) allowedBy(policy *object.Policy) bool {
+	switch c {
+	case capFileSystem:
+		return policy.AllowFileSystem
+	case capNetwork:
+		return policy.AllowNetwork
+	case capExec:
+		return policy.AllowExec
+	case capEnv:
+		return policy.AllowEnv
+	default:
+		return policy.AllowImport
+	}
+}
+
+/*
+環境ごとの Policy で制限する組み込み関数と、使うのに必要な操作
+*/
+var capabilities = map[string]capability{
+	"readFile":   capFileSystem,
+	"writeFile":  capFileSystem,
+	"appendFile": capFileSystem,
+	"listDir":    capFileSystem,
+	"fileExists": capFileSystem,
+	"tcpConnect": capNetwork,
+	"tcpSend":    capNetwork,
+	"tcpRecv":    capNetwork,
+	"tcpClose":   capNetwork,
+	"exec":       capExec,
+	"env":        capEnv,
+	"setEnv":     capEnv,
+	"import":     capImport,
+}
+
+/*
+名前で探した組み込み関数を env の Policy で制限する。許可されていなければ呼び出すとエラーを返す組み込み関数に置き換え、
+import は env から読み込むものに置き換える。Policy が nil なら object.DefaultPolicy で制限する
+*/
+func restrictBuiltin(name string, builtin *object.Builtin, env *object.Environment) *object.Builtin {
+	c, ok := capabilities[name]
+	if !ok {
+		return builtin
+	}
+
+	policy := env.Policy()
+	if policy == nil {
+		policy = object.DefaultPolicy()
+	}
+	if !c.allowedBy(policy) {
+		return &object.Builtin{
+			Fn: func(args ...object.Object) object.Object {
+				return newErrorOf(object.PermissionError, "%s is disabled: %s", c, name)
+			},
+		}
+	}
+	if c == capImport {
+		return importBuiltin(env)
+	}
+	return builtin
+}
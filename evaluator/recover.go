@@ -0,0 +1,33 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+遅延呼び出しで使い、Goのパニックを InternalError のエラーオブジェクトに変換して result にセットする。
+組み込み関数の不具合で、インタプリタを埋め込んだプログラム全体が停止しないようにする
+*/
+func recoverPanic(result *object.Object) {
+	if r := recover(); r != nil {
+		*result = newErrorOf(object.InternalError, "panic: %v", r)
+	}
+}
+
+/*
+組み込み関数を呼び出す。パニックした場合はエラーオブジェクトを返す
+*/
+func callBuiltin(fn *object.Builtin, args []object.Object) (result object.Object) {
+	defer recoverPanic(&result)
+	return fn.Fn(args...)
+}
+
+/*
+Eval と同じく評価し、評価中にパニックした場合はエラーオブジェクトを返す。
+インタプリタを埋め込んだプログラムから信頼できないスクリプトを評価する場合に使う
+*/
+func SafeEval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer recoverPanic(&result)
+	return Eval(node, env)
+}
@@ -0,0 +1,158 @@
+package evaluator
+
+import "monkey/object"
+
+/*
+集合の組み込み関数。集合を変更する操作はすべて新しい集合を返す
+*/
+func init() {
+	registerConfigured("set", setBuiltin)
+	builtins["add"] = setFunction("add", setAdd)
+	builtins["remove"] = setFunction("remove", setRemove)
+	builtins["union"] = setFunction("union", setUnion)
+	builtins["intersect"] = setFunction("intersect", setIntersect)
+	builtins["difference"] = setFunction("difference", setDifference)
+}
+
+/*
+set(arr): 配列の要素からなる集合を返す。引数を省略すると空集合を返す
+*/
+func setBuiltin(config object.Config, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	set := &object.Set{Elements: map[object.HashKey]object.Object{}}
+	if len(args) == 0 {
+		return set
+	}
+
+	elements, err := iterableArgument(config, "argument to `set`", args[0])
+	if err != nil {
+		return err
+	}
+	for _, el := range elements {
+		if err := addToSet(set, el); err != nil {
+			return err
+		}
+	}
+
+	return set
+}
+
+/*
+集合のメソッドを同名の組み込み関数として呼び出せるようにする。第一引数は集合でなければならない
+*/
+func setFunction(name string, method object.BuiltinFunction) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != object.SET_OBJ {
+				return newErrorOf(object.TypeError, "first argument to `%s` must be SET, got %s", name, args[0].Type())
+			}
+			return method(args...)
+		},
+	}
+}
+
+func addToSet(set *object.Set, el object.Object) *object.Error {
+	key, ok := el.(object.Hashable)
+	if !ok {
+		return newErrorOf(object.TypeError, "unusable as set element: %s", el.Type())
+	}
+	set.Elements[key.HashKey()] = el
+	return nil
+}
+
+func copySet(set *object.Set) *object.Set {
+	elements := make(map[object.HashKey]object.Object, len(set.Elements))
+	for key, el := range set.Elements {
+		elements[key] = el
+	}
+	return &object.Set{Elements: elements}
+}
+
+/*
+2つ目の引数が集合であることを確認する
+*/
+func otherSet(name string, args []object.Object) (*object.Set, *object.Error) {
+	if len(args) != 2 {
+		return nil, newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	other, ok := args[1].(*object.Set)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "argument to `%s` must be SET, got %s", name, args[1].Type())
+	}
+	return other, nil
+}
+
+func setAdd(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+
+	set := copySet(args[0].(*object.Set))
+	if err := addToSet(set, args[1]); err != nil {
+		return err
+	}
+	return set
+}
+
+func setRemove(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newErrorOf(object.ArgumentError, "wrong number of arguments. got=%d, want=1", len(args)-1)
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return newErrorOf(object.TypeError, "unusable as set element: %s", args[1].Type())
+	}
+
+	set := copySet(args[0].(*object.Set))
+	delete(set.Elements, key.HashKey())
+	return set
+}
+
+func setUnion(args ...object.Object) object.Object {
+	other, err := otherSet("union", args)
+	if err != nil {
+		return err
+	}
+
+	set := copySet(args[0].(*object.Set))
+	for key, el := range other.Elements {
+		set.Elements[key] = el
+	}
+	return set
+}
+
+func setIntersect(args ...object.Object) object.Object {
+	other, err := otherSet("intersect", args)
+	if err != nil {
+		return err
+	}
+
+	set := &object.Set{Elements: map[object.HashKey]object.Object{}}
+	for key, el := range args[0].(*object.Set).Elements {
+		if _, ok := other.Elements[key]; ok {
+			set.Elements[key] = el
+		}
+	}
+	return set
+}
+
+func setDifference(args ...object.Object) object.Object {
+	other, err := otherSet("difference", args)
+	if err != nil {
+		return err
+	}
+
+	set := &object.Set{Elements: map[object.HashKey]object.Object{}}
+	for key, el := range args[0].(*object.Set).Elements {
+		if _, ok := other.Elements[key]; !ok {
+			set.Elements[key] = el
+		}
+	}
+	return set
+}
@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+スライス式を評価
+*/
+func evalSliceExpression(
+	node *ast.SliceExpression,
+	env *object.Environment,
+) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	start, err := evalSliceBound(node.Start, env)
+	if err != nil {
+		return err
+	}
+	end, err := evalSliceBound(node.End, env)
+	if err != nil {
+		return err
+	}
+
+	switch left := left.(type) {
+	// 配列の場合
+	case *object.Array:
+		from, to := sliceBounds(start, end, len(left.Elements))
+		elements := make([]object.Object, to-from)
+		copy(elements, left.Elements[from:to])
+		return &object.Array{Elements: elements}
+
+	// 文字列の場合は文字単位で切り出す
+	case *object.String:
+		runes := []rune(left.Value)
+		from, to := sliceBounds(start, end, len(runes))
+		return &object.String{Value: string(runes[from:to])}
+
+	// バイト列の場合
+	case *object.Bytes:
+		from, to := sliceBounds(start, end, len(left.Value))
+		value := make([]byte, to-from)
+		copy(value, left.Value[from:to])
+		return &object.Bytes{Value: value}
+
+	default:
+		return newErrorOf(object.TypeError, "slice operator not supported: %s", left.Type())
+	}
+}
+
+/*
+スライスの境界を評価。省略された場合はnilを返す
+*/
+func evalSliceBound(node ast.Expression, env *object.Environment) (*int64, object.Object) {
+	if node == nil {
+		return nil, nil
+	}
+
+	bound := Eval(node, env)
+	if isError(bound) {
+		return nil, bound
+	}
+
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return nil, newErrorOf(object.TypeError, "slice bound must be INTEGER, got %s", bound.Type())
+	}
+
+	return &integer.Value, nil
+}
+
+/*
+スライスの境界を長さlengthの列に対する添字範囲に変換する。
+負の値は末尾からの位置として扱い、範囲外の値は列の範囲に切り詰める
+*/
+func sliceBounds(start, end *int64, length int) (int, int) {
+	from, to := 0, length
+
+	if start != nil {
+		from = clampSliceIndex(*start, length)
+	}
+	if end != nil {
+		to = clampSliceIndex(*end, length)
+	}
+	if to < from {
+		to = from
+	}
+
+	return from, to
+}
+
+func clampSliceIndex(idx int64, length int) int {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 {
+		return 0
+	}
+	if idx > int64(length) {
+		return length
+	}
+	return int(idx)
+}
@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+末尾位置の呼び出し。関数の本体の評価から呼び出しを取り出し、runTailCalls で同じGoのスタックフレームのまま実行する
+*/
+type tailCall struct {
+	fn    *object.Function
+	args  []object.Object
+	named []namedArgument
+	call  *ast.CallExpression
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call " + tc.call.String() }
+
+/*
+関数の本体を評価する。tail が真なら node の値がそのまま関数の戻り値になる。
+末尾位置の呼び出しとreturn文の呼び出しは実行せずに tailCall として返す
+*/
+func evalTail(node ast.Node, env *object.Environment, tail bool) object.Object {
+	result := evalTailNode(node, env, tail)
+
+	// Eval と同じく、最も内側で評価したノードの位置をエラーに記録する
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func evalTailNode(node ast.Node, env *object.Environment, tail bool) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		var result object.Object
+		for i, statement := range node.Statements {
+			result = evalTail(statement, env, tail && i == len(node.Statements)-1)
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+					return result
+				}
+				if _, ok := result.(*tailCall); ok {
+					return result
+				}
+			}
+		}
+		return result
+
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env, tail)
+
+	case *ast.ReturnStatement:
+		val := evalTail(node.ReturnValue, env, true)
+		if _, ok := val.(*tailCall); ok {
+			return val
+		}
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.IfExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalTail(node.Consequence, env, tail)
+		} else if node.Alternative != nil {
+			return evalTail(node.Alternative, env, tail)
+		}
+		return NULL
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env, func(body ast.Node, armEnv *object.Environment) object.Object {
+			return evalTail(body, armEnv, tail)
+		})
+
+	case *ast.CallExpression:
+		return evalCallExpression(node, env, tail)
+	}
+
+	return Eval(node, env)
+}
+
+/*
+末尾位置の呼び出しを、呼び出された関数の本体が末尾位置の呼び出しを返さなくなるまで繰り返し実行する
+*/
+func runTailCalls(result object.Object) object.Object {
+	for {
+		tc, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+		if err := checkContext(tc.fn.Env); err != nil {
+			err.Pos = tc.call.Pos()
+			return err
+		}
+
+		env, err := extendFunctionEnv(tc.fn, tc.args, tc.named)
+		if err != nil {
+			if !err.Pos.IsValid() {
+				err.Pos = tc.call.Pos()
+			}
+			return err
+		}
+		result = unwrapReturnValue(evalTail(tc.fn.Body, env, true))
+		if _, ok := result.(*tailCall); !ok {
+			// 末尾呼び出しで置き換えたフレームのうち、最後の呼び出しだけをスタックトレースに残す
+			result = withCallFrame(result, tc.call)
+		}
+	}
+}
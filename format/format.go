@@ -0,0 +1,507 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+/*
+ソースコードを解析して標準の形式に整形する。インデントはタブで、文末には ; を付ける。
+文の間の空行は一行にまとめて残し、コメントは直後の文の前に移す
+*/
+func Source(src string) (string, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{lines: strings.Split(src, "\n"), comments: collectComments(src)}
+	return pr.program(program), nil
+}
+
+/*
+構文木を標準の形式のソースコードに整形する
+*/
+func Node(node ast.Node) string {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return p.program(node)
+	case ast.Statement:
+		return p.statement(node)
+	case ast.Expression:
+		return p.expression(node, parser.LOWEST)
+	}
+	return node.String()
+}
+
+/*
+ソースコードのコメントを出現順に集める
+*/
+func collectComments(src string) []token.Token {
+	comments := []token.Token{}
+
+	l := lexer.NewWithComments(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.COMMENT {
+			comments = append(comments, tok)
+		}
+	}
+	return comments
+}
+
+type printer struct {
+	indent   int
+	lines    []string      // 空行を残すための元のソースコード。ない場合は空行を入れない
+	comments []token.Token // まだ書き出していないコメント
+}
+
+func (p *printer) program(program *ast.Program) string {
+	var out bytes.Buffer
+
+	first := true
+	for i, stmt := range program.Statements {
+		p.writeStatement(&out, stmt, next(program.Statements, i), &first)
+	}
+	// 最後の文より後ろのコメント
+	for _, comment := range p.comments {
+		p.writeComment(&out, comment, &first)
+	}
+	p.comments = nil
+
+	return out.String()
+}
+
+func next(stmts []ast.Statement, i int) ast.Statement {
+	if i+1 < len(stmts) {
+		return stmts[i+1]
+	}
+	return nil
+}
+
+/*
+インデントと文末を付けて文を一行書き出す。前にあるコメントと、同じ行の後ろのコメントも書き出す
+*/
+func (p *printer) writeStatement(out *bytes.Buffer, stmt ast.Statement, next ast.Statement, first *bool) {
+	p.writeCommentsBefore(out, stmt.Pos(), first)
+	p.writeSeparator(out, stmt.Pos(), first)
+
+	text := p.statement(stmt)
+	if needsSemicolon(stmt, next) {
+		text += ";"
+	}
+	out.WriteString(p.indentation() + text)
+
+	// 一行に収まった文の後ろに同じ行のコメントが続く場合は行末に残す
+	if len(p.comments) > 0 && !strings.Contains(text, "\n") && p.comments[0].Pos.Line == stmt.Pos().Line {
+		out.WriteString(" " + p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+	out.WriteString("\n")
+}
+
+/*
+pos より前にあるコメントを書き出す
+*/
+func (p *printer) writeCommentsBefore(out *bytes.Buffer, pos token.Position, first *bool) {
+	for len(p.comments) > 0 && pos.IsValid() && before(p.comments[0].Pos, pos) {
+		p.writeComment(out, p.comments[0], first)
+		p.comments = p.comments[1:]
+	}
+}
+
+func (p *printer) writeComment(out *bytes.Buffer, comment token.Token, first *bool) {
+	p.writeSeparator(out, comment.Pos, first)
+	out.WriteString(p.indentation() + comment.Literal + "\n")
+}
+
+/*
+元のソースコードで pos の前の行が空行の場合は空行を一つ入れる。ブロックの先頭では入れない
+*/
+func (p *printer) writeSeparator(out *bytes.Buffer, pos token.Position, first *bool) {
+	if !*first && pos.IsValid() && pos.Line >= 2 && pos.Line-2 < len(p.lines) &&
+		strings.TrimSpace(p.lines[pos.Line-2]) == "" {
+		out.WriteString("\n")
+	}
+	*first = false
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+func (p *printer) indentation() string {
+	return strings.Repeat("\t", p.indent)
+}
+
+/*
+文末に ; が必要かどうか判定する。ブロックで終わる if 式と match 式は、
+次の文が続きの式として読まれない場合に限り ; を省く
+*/
+func needsSemicolon(stmt ast.Statement, next ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.FunctionStatement, *ast.ClassStatement, *ast.BlockStatement:
+		return false
+	case *ast.ExpressionStatement:
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression:
+		default:
+			return true
+		}
+		es, ok := next.(*ast.ExpressionStatement)
+		if !ok {
+			return false
+		}
+		switch es.Token.Type {
+		case token.LPAREN, token.LBRACKET, token.MINUS:
+			return true
+		}
+		return es.Token.Type == ""
+	}
+	return true
+}
+
+/*
+文を文末の ; を付けずに整形する
+*/
+func (p *printer) statement(stmt ast.Statement) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		var target string
+		if stmt.Pattern != nil {
+			target = p.expression(stmt.Pattern, parser.LOWEST)
+		} else {
+			target = stmt.Name.Value
+		}
+		return "let " + target + " = " + p.expression(stmt.Value, parser.LOWEST)
+
+	case *ast.ConstStatement:
+		return "const " + stmt.Name.Value + " = " + p.expression(stmt.Value, parser.LOWEST)
+
+	case *ast.FunctionStatement:
+		return p.function(stmt.Function)
+
+	case *ast.ReturnStatement:
+		return "return " + p.expression(stmt.ReturnValue, parser.LOWEST)
+
+	case *ast.ExpressionStatement:
+		text := p.expression(stmt.Expression, parser.LOWEST)
+		// 名前付き関数リテラルで始まると関数宣言文として読まれるのでカッコで囲む
+		if startsWithNamedFunction(stmt.Expression) {
+			text = "(" + text + ")"
+		}
+		return text
+
+	case *ast.BlockStatement:
+		return p.block(stmt)
+
+	case *ast.ClassStatement:
+		return p.class(stmt)
+	}
+
+	return stmt.String()
+}
+
+func startsWithNamedFunction(expr ast.Expression) bool {
+	for {
+		switch e := expr.(type) {
+		case *ast.FunctionLiteral:
+			return e.Name != nil
+		case *ast.InfixExpression:
+			expr = e.Left
+		case *ast.CallExpression:
+			expr = e.Function
+		case *ast.IndexExpression:
+			expr = e.Left
+		case *ast.SliceExpression:
+			expr = e.Left
+		case *ast.MemberExpression:
+			expr = e.Object
+		default:
+			return false
+		}
+	}
+}
+
+/*
+ブロックを整形する。中の文は一段深くインデントする
+*/
+func (p *printer) block(block *ast.BlockStatement) string {
+	if len(block.Statements) == 0 {
+		return "{}"
+	}
+
+	var out bytes.Buffer
+	out.WriteString("{\n")
+
+	p.indent++
+	first := true
+	for i, stmt := range block.Statements {
+		p.writeStatement(&out, stmt, next(block.Statements, i), &first)
+	}
+	p.indent--
+
+	out.WriteString(p.indentation() + "}")
+	return out.String()
+}
+
+func (p *printer) function(fn *ast.FunctionLiteral) string {
+	var out bytes.Buffer
+
+	out.WriteString("fn")
+	if fn.Name != nil {
+		out.WriteString(" " + fn.Name.Value)
+	}
+	out.WriteString(p.parameters(fn))
+	out.WriteString(" " + p.block(fn.Body))
+
+	return out.String()
+}
+
+func (p *printer) parameters(fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for i, param := range fn.Parameters {
+		if fn.Variadic && i == len(fn.Parameters)-1 {
+			params = append(params, "..."+param.Value)
+		} else if def, ok := fn.Defaults[param.Value]; ok {
+			params = append(params, param.Value+" = "+p.expression(def, parser.LOWEST))
+		} else {
+			params = append(params, param.Value)
+		}
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+/*
+class文を整形する。フィールドの後にメソッドを並べる
+*/
+func (p *printer) class(class *ast.ClassStatement) string {
+	var out bytes.Buffer
+
+	out.WriteString("class " + class.Name.Value)
+	if len(class.Constructor.Parameters) > 0 {
+		out.WriteString(p.parameters(class.Constructor))
+	}
+
+	fields := class.Constructor.Body.Statements
+	if len(fields) == 0 && len(class.Methods) == 0 {
+		out.WriteString(" {}")
+		return out.String()
+	}
+	out.WriteString(" {\n")
+
+	p.indent++
+	first := true
+	for _, field := range fields {
+		p.writeStatement(&out, field, nil, &first)
+	}
+	for _, method := range class.Methods {
+		p.writeCommentsBefore(&out, method.Pos(), &first)
+		p.writeSeparator(&out, method.Pos(), &first)
+		out.WriteString(p.indentation() + "fn " + method.Name.Value +
+			p.parameters(method.Function) + " " + p.block(method.Function.Body) + "\n")
+	}
+	p.indent--
+
+	out.WriteString(p.indentation() + "}")
+	return out.String()
+}
+
+/*
+式を整形する。式の優先順位が prec より低い場合はカッコで囲む
+*/
+func (p *printer) expression(expr ast.Expression, prec int) string {
+	text := p.bareExpression(expr)
+	if precedence(expr) < prec {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+/*
+式の優先順位。リテラルや呼び出し式などはどこに置いてもカッコが要らない
+*/
+func precedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence(expr)
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.YieldExpression:
+		return parser.LOWEST
+	}
+	return parser.CALL
+}
+
+func operatorPrecedence(expr *ast.InfixExpression) int {
+	t := expr.Token.Type
+	// トークンを持たない構文木の場合は演算子から求める
+	if t == "" {
+		t = token.LookupIdent(expr.Operator)
+		if t == token.IDENT {
+			t = token.TokenType(expr.Operator)
+		}
+	}
+	return parser.Precedence(t)
+}
+
+func (p *printer) bareExpression(expr ast.Expression) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Value
+
+	case *ast.IntegerLiteral:
+		// 桁区切りの _ などは書かれた通りに残す
+		if expr.Token.Type == token.INT {
+			return expr.Token.Literal
+		}
+		return strconv.FormatInt(expr.Value, 10)
+
+	case *ast.StringLiteral:
+		return quote(expr.Value)
+
+	case *ast.Boolean:
+		return strconv.FormatBool(expr.Value)
+
+	case *ast.NullLiteral:
+		return "null"
+
+	case *ast.FunctionLiteral:
+		return p.function(expr)
+
+	case *ast.ArrayLiteral:
+		return "[" + p.expressionList(expr.Elements) + "]"
+
+	case *ast.HashLiteral:
+		pairs := []string{}
+		for _, key := range expr.OrderedKeys() {
+			pairs = append(pairs, p.expression(key, parser.LOWEST)+": "+p.expression(expr.Pairs[key], parser.LOWEST))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	case *ast.PrefixExpression:
+		operator := expr.Operator
+		// typeof のようなキーワード演算子は被演算子と空白で区切る
+		if token.LookupIdent(operator) != token.IDENT {
+			operator += " "
+		}
+		return operator + p.expression(expr.Right, parser.PREFIX)
+
+	case *ast.InfixExpression:
+		prec := operatorPrecedence(expr)
+		operator := " " + expr.Operator + " "
+		if expr.Operator == ".." {
+			operator = ".."
+		}
+		// 中置演算子は左結合なので、右側は同じ優先順位でもカッコで囲む
+		return p.expression(expr.Left, prec) + operator + p.expression(expr.Right, prec+1)
+
+	case *ast.IfExpression:
+		text := "if (" + p.expression(expr.Condition, parser.LOWEST) + ") " + p.block(expr.Consequence)
+		if expr.Alternative != nil {
+			text += " else " + p.block(expr.Alternative)
+		}
+		return text
+
+	case *ast.CallExpression:
+		args := []string{}
+		for _, arg := range expr.Arguments {
+			args = append(args, p.expression(arg, parser.LOWEST))
+		}
+		for _, arg := range expr.NamedArguments {
+			args = append(args, arg.Name.Value+": "+p.expression(arg.Value, parser.LOWEST))
+		}
+		return p.expression(expr.Function, parser.CALL) + "(" + strings.Join(args, ", ") + ")"
+
+	case *ast.IndexExpression:
+		return p.expression(expr.Left, parser.CALL) + "[" + p.expression(expr.Index, parser.LOWEST) + "]"
+
+	case *ast.SliceExpression:
+		text := p.expression(expr.Left, parser.CALL) + "["
+		if expr.Start != nil {
+			text += p.expression(expr.Start, parser.LOWEST)
+		}
+		text += ":"
+		if expr.End != nil {
+			text += p.expression(expr.End, parser.LOWEST)
+		}
+		return text + "]"
+
+	case *ast.MemberExpression:
+		return p.expression(expr.Object, parser.CALL) + "." + expr.Property.Value
+
+	case *ast.MatchExpression:
+		var out bytes.Buffer
+		out.WriteString("match (" + p.expression(expr.Subject, parser.LOWEST) + ") {\n")
+		p.indent++
+		for _, arm := range expr.Arms {
+			out.WriteString(p.indentation() + "case " + p.expression(arm.Pattern, parser.LOWEST) +
+				" " + p.block(arm.Body) + "\n")
+		}
+		p.indent--
+		out.WriteString(p.indentation() + "}")
+		return out.String()
+
+	case *ast.SpreadExpression:
+		return "..." + p.expression(expr.Value, parser.LOWEST)
+
+	case *ast.YieldExpression:
+		if expr.Value == nil {
+			return "yield"
+		}
+		return "yield " + p.expression(expr.Value, parser.LOWEST)
+
+	case *ast.SpawnExpression:
+		return "spawn " + p.expression(expr.Call, parser.PREFIX)
+
+	case *ast.ArrayPattern, *ast.HashPattern:
+		return expr.String()
+	}
+
+	return expr.String()
+}
+
+func (p *printer) expressionList(exprs []ast.Expression) string {
+	list := make([]string, len(exprs))
+	for i, expr := range exprs {
+		list[i] = p.expression(expr, parser.LOWEST)
+	}
+	return strings.Join(list, ", ")
+}
+
+/*
+文字列を字句解析器が解釈できるエスケープシーケンスだけを使って二重引用符で囲む
+*/
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, ch := range s {
+		switch ch {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
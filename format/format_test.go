@@ -0,0 +1,110 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	input := `// 足し算
+let add=fn(a,b){a+b};
+let  x = add(1, 2) * (3 - 4); # 計算
+
+
+if (x > 1) { puts("big") } else { puts("small\n") };
+[1, 2][0]
+let f = fn(n, step = 1, ...rest) { if (n < 1) { return 0; }; yield n; };
+class Point(x, y = 0) { let z = x + y; fn norm() { x * x + y * y } }
+let h = {"a": -(1 + 2), "b": !true, "c": 1..10}
+match (x) { case 1 { "one" } case _ { "other" } }
+`
+	expected := `// 足し算
+let add = fn(a, b) {
+	a + b;
+};
+let x = add(1, 2) * (3 - 4); # 計算
+
+if (x > 1) {
+	puts("big");
+} else {
+	puts("small\n");
+};
+[1, 2][0];
+let f = fn(n, step = 1, ...rest) {
+	if (n < 1) {
+		return 0;
+	}
+	yield n;
+};
+class Point(x, y = 0) {
+	let z = x + y;
+	fn norm() {
+		x * x + y * y;
+	}
+}
+let h = {"a": -(1 + 2), "b": !true, "c": 1..10};
+match (x) {
+	case 1 {
+		"one";
+	}
+	case _ {
+		"other";
+	}
+}
+`
+
+	formatted, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+	if formatted != expected {
+		t.Errorf("formatted source wrong.\nwant=\n%s\ngot=\n%s", expected, formatted)
+	}
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	inputs := []string{
+		"let a = (1 + 2) * 3 - (4 - 5) - 6; a",
+		"let s = \"quote \\\" backslash \\\\ tab \\t\"; s",
+		"let r = `raw\nstring`;",
+		"let g = fn() { yield; yield 1 + 2 }; spawn g(); (fn(x) { x })(1)",
+		"let [a, b, ...c] = [1, 2, 3, 4]; let {x, y} = {\"x\": 1, \"y\": 2};",
+		"f(1, ...xs, sep: \", \"); a.b.c(d)[1:2][:3]; typeof -x; a ?? b ?? c; 1 in [1] == true",
+		"fn named(n) { if (n == 0) { 0 } else { named(n - 1) } }\n\n\n// end",
+		"if (true) { 1 }\n(2)\nlet x = 1_000_000;",
+		"const limit = 10; class Empty {}",
+	}
+
+	for _, input := range inputs {
+		once, err := Source(input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", input, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", once, err)
+		}
+		if once != twice {
+			t.Errorf("formatting is not idempotent.\nfirst=\n%s\nsecond=\n%s", once, twice)
+		}
+		if parse(t, once) != parse(t, input) {
+			t.Errorf("formatting changed program.\nwant=%q\ngot= %q", parse(t, input), parse(t, once))
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, err := Source("let x 5;"); err == nil {
+		t.Errorf("Source with syntax error did not return error")
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	return program.String()
+}
@@ -1,22 +1,180 @@
 package lexer
 
-import "monkey/token"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
-	input        string
+	input        []byte
 	position     int  // 入力における現在の位置（現在の文字を指し示す）
 	readPosition int  // これから読み込む位置（現在の文字の次）
 	ch           byte // 現在検査中の文字
+	keepComments bool // コメントをトークンとして返すかどうか
+	newlineSeen  bool // 現在のトークンの前に改行があったかどうか
+
+	file    string // トークンの位置に記録するファイル名
+	start   int    // 現在のトークンの開始位置
+	line    int    // scanned の位置の行番号
+	column  int    // scanned の位置の行頭からの文字数
+	scanned int    // 行番号を数え終えた位置
+
+	reader io.Reader // 入力を少しずつ読み込む読み込み元。文字列全体を受け取った場合はnil
+	buf    []byte    // 読み込み元から読み込む場合の input の下敷きにするバッファ
+	err    error     // 読み込み元で起きたEOF以外のエラー
 }
 
+/*
+読み込み元から一度に読み込むバイト数
+*/
+const readChunkSize = 4096
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: []byte(input), line: 1}
 	l.readChar()
 	return l
 }
 
+/*
+r から必要な分だけ読み込みながら字句解析する字句解析器を生成する。
+読み終えたトークンの分は捨てるので、入力全体をメモリに載せずに済む
+*/
+func NewReader(r io.Reader) *Lexer {
+	l := &Lexer{reader: r, line: 1}
+	l.readChar()
+	return l
+}
+
+/*
+読み込み元で起きたエラーを取得。エラーが起きると、そこを入力の終わりとして扱う
+*/
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+/*
+入力の長さが n バイト以上になるまで読み込み元から読み込む。読み込めたかどうかを返す
+*/
+func (l *Lexer) fill(n int) bool {
+	for len(l.input) < n && l.reader != nil {
+		if cap(l.input)-len(l.input) < readChunkSize {
+			l.compact()
+		}
+		end := len(l.input)
+		size, err := l.reader.Read(l.input[end : end+readChunkSize])
+		l.input = l.input[:end+size]
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			l.reader = nil
+		}
+	}
+	return len(l.input) >= n
+}
+
+/*
+まだ読んでいない入力をバッファの先頭に詰め、後ろに readChunkSize 以上の空きを作る。
+空きが足りなければバッファを広げる
+*/
+func (l *Lexer) compact() {
+	buf := l.buf
+	if len(l.input)+readChunkSize > cap(buf) {
+		buf = make([]byte, 0, 2*len(l.input)+readChunkSize)
+	}
+	l.buf = buf
+	l.input = buf[:copy(buf[:len(l.input)], l.input)]
+}
+
+/*
+start 以降に改行が現れるか、入力が終わるまで読み込む
+*/
+func (l *Lexer) fillLine(start int) {
+	for l.reader != nil && bytes.IndexByte(l.input[start:], '\n') < 0 {
+		l.fill(len(l.input) + 1)
+	}
+}
+
+/*
+読み終えた入力を捨てる。トークンの境目で呼び出す。捨てた分のバッファは次に読み込むときに使い回す
+*/
+func (l *Lexer) discard() {
+	// 捨てる前に行番号を数えておく
+	l.positionAt(l.position)
+
+	n := l.position
+	l.input = l.input[n:]
+	l.position -= n
+	l.readPosition -= n
+	l.scanned -= n
+}
+
+/*
+入力全体をトークンに分割する。コメントもトークンとして含め、最後は EOF トークンになる。
+不正なトークンがあっても最後まで分割し、最初の不正なトークンをエラーとして返す
+*/
+func Tokenize(input string) ([]token.Token, error) {
+	var tokens []token.Token
+	var err error
+
+	l := NewWithComments(input)
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.ILLEGAL && err == nil {
+			err = fmt.Errorf("%s: illegal token: %s", tok.Pos, tok.Literal)
+		}
+		if tok.Type == token.EOF {
+			return tokens, err
+		}
+	}
+}
+
+/*
+トークンの位置に記録するファイル名を設定
+*/
+func (l *Lexer) SetFile(name string) {
+	l.file = name
+}
+
+/*
+入力のoffsetバイト目の位置を求める。トークンは前から順に読むので、行番号は前回の続きから数える
+*/
+func (l *Lexer) positionAt(offset int) token.Position {
+	if offset > len(l.input) {
+		offset = len(l.input)
+	}
+	for ; l.scanned < offset; l.scanned++ {
+		switch ch := l.input[l.scanned]; {
+		case ch == '\n':
+			l.line++
+			l.column = 0
+		case !utf8.RuneStart(ch):
+			// UTF-8の2バイト目以降は数えない
+		default:
+			l.column++
+		}
+	}
+
+	return token.Position{File: l.file, Line: l.line, Column: l.column + 1}
+}
+
+/*
+コメントをCOMMENTトークンとして返す字句解析器を生成
+*/
+func NewWithComments(input string) *Lexer {
+	l := New(input)
+	l.keepComments = true
+	return l
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
+	if !l.fill(l.readPosition + 1) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
@@ -25,10 +183,47 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
+/*
+次のトークンを読み込む。トークンの前に改行があった場合はNewlineBeforeをセットする
+*/
 func (l *Lexer) NextToken() token.Token {
+	l.newlineSeen = false
+	if l.reader != nil {
+		l.discard()
+	}
+	tok := l.readToken()
+	tok.NewlineBefore = l.newlineSeen
+	tok.Pos = l.positionAt(l.start)
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	l.start = l.position
+
+	// コメントは読み飛ばす（保持モードの場合はトークンとして返す）
+	for l.isLineCommentStart() || l.isBlockCommentStart() {
+		var literal string
+		if l.isLineCommentStart() {
+			literal = l.readLineComment()
+		} else {
+			var ok bool
+			literal, ok = l.readBlockComment()
+			if !ok {
+				return token.Token{Type: token.ILLEGAL, Literal: "unterminated block comment"}
+			}
+			if strings.Contains(literal, "\n") {
+				l.newlineSeen = true
+			}
+		}
+		if l.keepComments {
+			return token.Token{Type: token.COMMENT, Literal: literal}
+		}
+		l.skipWhitespace()
+		l.start = l.position
+	}
 
 	switch l.ch {
 	case '=':
@@ -58,9 +253,32 @@ func (l *Lexer) NextToken() token.Token {
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '<':
+		if l.peekChar() == '<' {
+			return l.readHeredoc()
+		}
 		tok = newToken(token.LT, l.ch)
 	case '>':
 		tok = newToken(token.GT, l.ch)
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.COALESCE, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.RANGE, Literal: ".."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -80,13 +298,24 @@ func (l *Lexer) NextToken() token.Token {
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, errMsg := l.readString()
+		if errMsg != "" {
+			tok = token.Token{Type: token.ILLEGAL, Literal: errMsg}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		}
+	case '`':
+		str, ok := l.readRawString()
+		if ok {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: "unterminated raw string"}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if r, size := l.currentRune(); isLetter(r) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			return tok
@@ -94,6 +323,10 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
 			return tok
+		} else if size > 1 {
+			// 複数バイトの文字は1文字まとめて不正なトークンにする
+			tok = token.Token{Type: token.ILLEGAL, Literal: string(r)}
+			l.skip(size - 1)
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -109,36 +342,116 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	// 2文字目以降は数字も使える
+	for {
+		r, size := l.currentRune()
+		if !isLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		l.skip(size)
+	}
+	return string(l.input[position:l.position])
+}
+
+/*
+現在位置からUTF-8の1文字を読み取り、その文字とバイト数を返す。入力の終わりではバイト数は0になる
+*/
+func (l *Lexer) currentRune() (rune, int) {
+	l.fill(l.position + utf8.UTFMax)
+	if l.position >= len(l.input) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(l.input[l.position:])
+}
+
+/*
+n バイト読み進める
+*/
+func (l *Lexer) skip(n int) {
+	for i := 0; i < n; i++ {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+/*
+識別子に使える文字かどうか判定。Unicodeの文字とアンダースコアを受け付ける
+*/
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
 }
 
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+		if l.ch == '\n' {
+			l.newlineSeen = true
+		}
 		l.readChar()
 	}
 }
 
+/*
+数値を読み込む。桁区切りのアンダースコアもリテラルに含める（検証は構文解析器で行う）
+*/
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for isDigit(l.ch) {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return string(l.input[position:l.position])
 }
 
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+/*
+行コメントの開始位置かどうか判定
+*/
+func (l *Lexer) isLineCommentStart() bool {
+	return l.ch == '#' || l.ch == '/' && l.peekChar() == '/'
+}
+
+/*
+行コメントを行末まで読み込む
+*/
+func (l *Lexer) readLineComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return string(l.input[position:l.position])
+}
+
+/*
+ブロックコメントの開始位置かどうか判定
+*/
+func (l *Lexer) isBlockCommentStart() bool {
+	return l.ch == '/' && l.peekChar() == '*'
+}
+
+/*
+ブロックコメントを閉じ記号まで読み込む。閉じられずにEOFに達した場合はfalseを返す
+*/
+func (l *Lexer) readBlockComment() (string, bool) {
+	position := l.position
+	// 開き記号 "/*" を読み飛ばす
+	l.readChar()
+	l.readChar()
+	for {
+		if l.ch == 0 {
+			return string(l.input[position:l.position]), false
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			l.readChar()
+			return string(l.input[position:l.position]), true
+		}
+		l.readChar()
+	}
+}
+
 func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+	if !l.fill(l.readPosition + 1) {
 		return 0
 	} else {
 		return l.input[l.readPosition]
@@ -146,18 +459,177 @@ func (l *Lexer) peekChar() byte {
 }
 
 /*
-文字列を読み込む
+現在位置からoffset文字先の文字を覗き見る
 */
-func (l *Lexer) readString() string {
-	// 一文字目の位置を保存
-	position := l.position + 1
+func (l *Lexer) peekCharAt(offset int) byte {
+	position := l.position + offset
+	if !l.fill(position + 1) {
+		return 0
+	}
+	return l.input[position]
+}
+
+/*
+文字列を読み込む。エスケープシーケンスを解釈し、不正なエスケープがあった場合はエラーメッセージを返す
+*/
+func (l *Lexer) readString() (string, string) {
+	var out strings.Builder
+	errMsg := ""
+
 	// 閉じ二重引用符 or EOFになるまで文字を読み進める
 	for {
 		l.readChar()
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+
+		if l.ch != '\\' {
+			out.WriteByte(l.ch)
+			continue
+		}
+
+		// エスケープシーケンスを解釈
+		l.readChar()
+		switch l.ch {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"':
+			out.WriteByte('"')
+		case '\\':
+			out.WriteByte('\\')
+		case 0:
+			// EOF直前のバックスラッシュ
+			return out.String(), "unterminated escape sequence"
+		default:
+			// 最初の不正なエスケープを記録し、閉じ引用符まで読み進める
+			if errMsg == "" {
+				errMsg = fmt.Sprintf("invalid escape sequence: \\%c", l.ch)
+			}
+		}
+	}
+
+	return out.String(), errMsg
+}
+
+/*
+バッククォートで囲まれた生文字列を読み込む。改行やバックスラッシュはそのまま保持する
+*/
+func (l *Lexer) readRawString() (string, bool) {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '`' {
+			return string(l.input[position:l.position]), true
+		}
+		if l.ch == 0 {
+			return string(l.input[position:l.position]), false
+		}
+	}
+}
+
+/*
+ヒアドキュメントを読み込む。<<TAG の次の行から、TAGだけの行の直前までを文字列とする。
+<<~TAG の場合は終端行のインデントを許し、本文から共通のインデントを取り除く
+*/
+func (l *Lexer) readHeredoc() token.Token {
+	// "<<" を読み飛ばす
+	l.readChar()
+	l.readChar()
+
+	squiggly := l.ch == '~'
+	if squiggly {
+		l.readChar()
+	}
+
+	if r, _ := l.currentRune(); !isLetter(r) {
+		return token.Token{Type: token.ILLEGAL, Literal: "missing heredoc tag"}
+	}
+	tag := l.readIdentifier()
+
+	// タグの後ろは行末まで空白のみ許す
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+		l.readChar()
+	}
+	if l.ch != '\n' {
+		return token.Token{Type: token.ILLEGAL, Literal: "heredoc tag must be followed by a newline"}
+	}
+
+	lines := []string{}
+	start := l.position + 1
+	for start <= len(l.input) {
+		l.fillLine(start)
+		end := bytes.IndexByte(l.input[start:], '\n')
+		if end < 0 {
+			end = len(l.input)
+		} else {
+			end += start
+		}
+		line := strings.TrimSuffix(string(l.input[start:end]), "\r")
+
+		candidate := line
+		if squiggly {
+			candidate = strings.TrimLeft(line, " \t")
+		}
+		if isHeredocTerminator(candidate, tag) {
+			// 終端タグの直後から字句解析を再開する
+			l.readPosition = start + len(line) - len(candidate) + len(tag)
+			l.readChar()
+
+			if squiggly {
+				lines = stripCommonIndent(lines)
+			}
+			return token.Token{Type: token.STRING, Literal: strings.Join(lines, "\n")}
+		}
+
+		lines = append(lines, line)
+		start = end + 1
+	}
+
+	l.readPosition = len(l.input)
+	l.readChar()
+	return token.Token{Type: token.ILLEGAL, Literal: "unterminated heredoc"}
+}
+
+/*
+行がヒアドキュメントの終端タグかどうか判定
+*/
+func isHeredocTerminator(line, tag string) bool {
+	if !strings.HasPrefix(line, tag) {
+		return false
+	}
+	if len(line) == len(tag) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(line[len(tag):])
+	return !isLetter(r) && !unicode.IsDigit(r)
+}
+
+/*
+空行以外の全ての行に共通する先頭の空白を取り除く
+*/
+func stripCommonIndent(lines []string) []string {
+	indent := -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	stripped := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			stripped[i] = line[indent:]
+		} else {
+			stripped[i] = strings.TrimLeft(line, " \t")
+		}
 	}
-	// 文字列を返す
-	return l.input[position:l.position]
+	return stripped
 }
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"monkey/token"
 )
@@ -15,7 +19,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -141,3 +145,366 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+type expectedToken struct {
+	expectedType    token.TokenType
+	expectedLiteral string
+}
+
+func checkTokens(t *testing.T, l *Lexer, tests []expectedToken) {
+	t.Helper()
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLineComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+# hash comment
+x / 2;
+//`
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestLineCommentsKept(t *testing.T) {
+	input := `let x = 5; // trailing
+# hash`
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "# hash"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, NewWithComments(input), tests)
+}
+
+func TestBlockComments(t *testing.T) {
+	input := `/* leading
+comment */ let x = /* inline */ 5;
+/**/ x * 2;
+/* unterminated`
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.ASTERISK, "*"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "unterminated block comment"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestBlockCommentsKept(t *testing.T) {
+	input := `/* a
+b */ 1`
+
+	tests := []expectedToken{
+		{token.COMMENT, "/* a\nb */"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, NewWithComments(input), tests)
+}
+
+func TestStringEscapes(t *testing.T) {
+	input := `"a\nb" "tab\there" "say \"hi\"" "back\\slash" "bad\q" "ok"`
+
+	tests := []expectedToken{
+		{token.STRING, "a\nb"},
+		{token.STRING, "tab\there"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.ILLEGAL, `invalid escape sequence: \q`},
+		{token.STRING, "ok"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestRawStrings(t *testing.T) {
+	input := "`C:\\path\\n` `line1\nline2` `\"quoted\"` `open"
+
+	tests := []expectedToken{
+		{token.STRING, `C:\path\n`},
+		{token.STRING, "line1\nline2"},
+		{token.STRING, `"quoted"`},
+		{token.ILLEGAL, "unterminated raw string"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestDigitSeparators(t *testing.T) {
+	input := "1_000_000 12_"
+
+	tests := []expectedToken{
+		{token.INT, "1_000_000"},
+		{token.INT, "12_"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestIdentifiersWithDigits(t *testing.T) {
+	input := "base64Encode x1 2x"
+
+	tests := []expectedToken{
+		{token.IDENT, "base64Encode"},
+		{token.IDENT, "x1"},
+		{token.INT, "2"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestEllipsis(t *testing.T) {
+	input := "[a, ...rest] .. a.b"
+
+	tests := []expectedToken{
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.RANGE, ".."},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestHeredocs(t *testing.T) {
+	input := "let a = <<EOF\nline 1\n  \"line\" \\2\nEOF;\n" +
+		"let b = <<~TEXT\n    indented\n      more\n    TEXT\n" +
+		"<<END\nEND\n" +
+		"<<EOF\nEOFX\nEOF"
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.STRING, "line 1\n  \"line\" \\2"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "b"},
+		{token.ASSIGN, "="},
+		{token.STRING, "indented\n  more"},
+		{token.STRING, ""},
+		{token.STRING, "EOFX"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestHeredocErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"<<EOF\nno end", "unterminated heredoc"},
+		{"<<EOF trailing\nEOF", "heredoc tag must be followed by a newline"},
+		{"<< EOF\nEOF", "missing heredoc tag"},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != token.ILLEGAL || tok.Literal != tt.expected {
+			t.Errorf("wrong token for %q. got=%+v", tt.input, tok)
+		}
+	}
+}
+
+func TestNewlineBefore(t *testing.T) {
+	input := "a b\nc /* x\ny */ d // e\nf"
+
+	expected := []bool{false, false, true, true, true}
+	l := New(input)
+	for i, newline := range expected {
+		tok := l.NextToken()
+		if tok.NewlineBefore != newline {
+			t.Errorf("tests[%d] - NewlineBefore wrong for %q. expected=%t, got=%t",
+				i, tok.Literal, newline, tok.NewlineBefore)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  \"é\" + y /* a\nb */ z\n<<EOF\nbody\nEOF\nw"
+
+	tests := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"é", 2, 3},
+		{"+", 2, 7},
+		{"y", 2, 9},
+		{"z", 3, 6},
+		{"body", 4, 1},
+		{"w", 7, 1},
+		{"", 7, 2},
+	}
+
+	l := New(input)
+	l.SetFile("main.mk")
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+		if tok.Pos.Line != tt.line || tok.Pos.Column != tt.column || tok.Pos.File != "main.mk" {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%d:%d, got=%s",
+				i, tt.literal, tt.line, tt.column, tok.Pos)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let 変数 = café2 + _x１; Ωmega ★`
+
+	tests := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "変数"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "café2"},
+		{token.PLUS, "+"},
+		{token.IDENT, "_x１"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "Ωmega"},
+		{token.ILLEGAL, "★"},
+		{token.EOF, ""},
+	}
+
+	checkTokens(t, New(input), tests)
+}
+
+func TestNewReader(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 500; i++ {
+		input.WriteString("let 変数 = \"str\" + 10; // comment\n/* block\n */ x <<~EOS\n  doc\n  EOS\n")
+	}
+
+	want := New(input.String())
+	got := NewReader(iotest.OneByteReader(strings.NewReader(input.String())))
+	for i := 0; ; i++ {
+		expected := want.NextToken()
+		tok := got.NextToken()
+		if tok != expected {
+			t.Fatalf("token[%d] wrong. expected=%+v, got=%+v", i, expected, tok)
+		}
+		// 読み終えた入力は捨てられ、バッファは使い回されている
+		if len(got.input) > 2*readChunkSize || cap(got.buf) > 4*readChunkSize {
+			t.Fatalf("buffered input too large: %d bytes (capacity %d)", len(got.input), cap(got.buf))
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if got.Err() != nil {
+		t.Errorf("Err() returned %s", got.Err())
+	}
+
+	failing := NewReader(io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("boom"))))
+	checkTokens(t, failing, []expectedToken{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	})
+	if failing.Err() == nil || failing.Err().Error() != "boom" {
+		t.Errorf("Err() wrong. got=%v", failing.Err())
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize(`let s = "hi" ?? null; // note`)
+	if err != nil {
+		t.Fatalf("Tokenize returned error: %s", err)
+	}
+
+	expected := []struct {
+		literal string
+		class   token.Class
+	}{
+		{"let", token.ClassKeyword},
+		{"s", token.ClassIdentifier},
+		{"=", token.ClassOperator},
+		{"hi", token.ClassLiteral},
+		{"??", token.ClassOperator},
+		{"null", token.ClassLiteral},
+		{";", token.ClassDelimiter},
+		{"// note", token.ClassComment},
+		{"", token.ClassEOF},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("wrong number of tokens. want=%d, got=%d", len(expected), len(tokens))
+	}
+	for i, tt := range expected {
+		if tokens[i].Literal != tt.literal || tokens[i].Type.Class() != tt.class {
+			t.Errorf("tokens[%d] wrong. want=%q (%s), got=%q (%s)",
+				i, tt.literal, tt.class, tokens[i].Literal, tokens[i].Type.Class())
+		}
+	}
+
+	tokens, err = Tokenize("let x = 1 @ 2;")
+	if err == nil || err.Error() != "1:11: illegal token: @" {
+		t.Errorf("Tokenize error wrong. got=%v", err)
+	}
+	if tokens[len(tokens)-1].Type != token.EOF {
+		t.Errorf("Tokenize did not read to the end. got=%+v", tokens)
+	}
+}
@@ -2,12 +2,65 @@ package main
 
 import (
 	"fmt"
+	"monkey/analysis"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/diagnostic"
+	"monkey/evaluator"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimizer"
+	"monkey/parser"
 	"monkey/repl"
+	"monkey/resolver"
+	"monkey/vm"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
 func main() {
+	evaluator.ScriptArgs = os.Args[1:]
+
+	// monkey ast <file> で構文木をJSONとして出力する
+	if len(os.Args) == 3 && os.Args[1] == "ast" {
+		os.Exit(dumpAST(os.Args[2]))
+	}
+	// monkey fmt <file> で整形したソースコードを出力する
+	if len(os.Args) == 3 && os.Args[1] == "fmt" {
+		os.Exit(formatFile(os.Args[2]))
+	}
+	// 引数にファイルが指定された場合はスクリプトとして実行する。ファイルの前に以下のオプションを指定できる
+	//   -O           構文木を最適化してから実行する
+	//   -engine=vm   バイトコードにコンパイルして仮想マシンで実行する (既定は -engine=eval)。
+	//                実験的な実装で、クラス、match式、ジェネレーター、spawn、分割代入、名前付き引数、
+	//                デフォルト値、スライス、スプレッドを含むスクリプトはコンパイルエラーになる
+	if len(os.Args) > 1 {
+		args := os.Args[1:]
+		optimize := false
+		engine := "eval"
+		for len(args) > 1 && strings.HasPrefix(args[0], "-") {
+			switch {
+			case args[0] == "-O":
+				optimize = true
+			case strings.HasPrefix(args[0], "-engine="):
+				engine = strings.TrimPrefix(args[0], "-engine=")
+			default:
+				fmt.Fprintf(os.Stderr, "unknown option: %s\n", args[0])
+				os.Exit(2)
+			}
+			args = args[1:]
+		}
+		if engine != "eval" && engine != "vm" {
+			fmt.Fprintf(os.Stderr, "unknown engine: %s\n", engine)
+			os.Exit(2)
+		}
+		evaluator.ScriptArgs = args
+		os.Exit(runScript(args[0], optimize, engine))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +68,138 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
 		user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, object.AllowAll())
+}
+
+/*
+スクリプトファイルを検査してから実行し、終了コードを返す。エラーは該当箇所の抜粋と共に標準エラー出力に書く。
+拡張子が .json のファイルは monkey ast で出力した構文木として読み込む。optimize が真なら構文木を最適化してから実行する。
+engine が "vm" ならバイトコードにコンパイルして実験的な仮想マシンで実行する。
+コマンドラインから実行するスクリプトは利用者が選んだものなので、外部コマンドの実行やネットワークへの接続も許可する
+*/
+func runScript(path string, optimize bool, engine string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var program ast.Node
+	if filepath.Ext(path) == ".json" {
+		program, err = ast.UnmarshalNode(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return 1
+		}
+	} else {
+		var ok bool
+		program, ok = parseScript(path, string(source))
+		if !ok {
+			return 1
+		}
+	}
+
+	// 実行の途中で失敗しないよう、未定義の識別子などを評価の前に検査する
+	diagnostics := analysis.Check(program, evaluator.BuiltinNames()...)
+	for _, d := range diagnostics {
+		if d.Pos.File == path {
+			diagnostic.Render(os.Stderr, string(source), d.Pos, d.String())
+		} else {
+			fmt.Fprintln(os.Stderr, d.String())
+		}
+	}
+	if analysis.HasErrors(diagnostics) {
+		return 1
+	}
+
+	if optimize {
+		program = optimizer.Optimize(program)
+	}
+
+	var result object.Object
+	if engine == "vm" {
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		machine := vm.New(c.Bytecode())
+		machine.SetPolicy(object.AllowAll())
+		result = machine.Run()
+	} else {
+		resolver.Resolve(program)
+		env := object.NewEnvironment()
+		env.SetPolicy(object.AllowAll())
+		result = evaluator.Eval(program, env)
+	}
+	if err, ok := result.(*object.Error); ok {
+		if err.Pos.File == path {
+			diagnostic.Render(os.Stderr, string(source), err.Pos, err.Inspect())
+		} else {
+			fmt.Fprintln(os.Stderr, err.Inspect())
+		}
+		return 1
+	}
+	return 0
+}
+
+/*
+スクリプトファイルを解析して構文木をJSONで標準出力に書き、終了コードを返す
+*/
+func dumpAST(path string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	program, ok := parseScript(path, string(source))
+	if !ok {
+		return 1
+	}
+
+	data, err := ast.MarshalNode(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	os.Stdout.WriteString("\n")
+	return 0
+}
+
+/*
+スクリプトファイルを整形して標準出力に書き、終了コードを返す
+*/
+func formatFile(path string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	formatted, err := format.Source(string(source))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.WriteString(formatted)
+	return 0
+}
+
+/*
+スクリプトを解析する。構文エラーは該当箇所の抜粋と共に標準エラー出力に書き、falseを返す
+*/
+func parseScript(path string, source string) (*ast.Program, bool) {
+	l := lexer.New(source)
+	l.SetFile(path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.ParseErrors() {
+			diagnostic.Render(os.Stderr, source, err.Position, err.Error())
+		}
+		return nil, false
+	}
+	return program, true
 }
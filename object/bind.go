@@ -0,0 +1,170 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+	"unicode"
+)
+
+/*
+Goの名前を Monkey から参照する名前に変換する規則
+*/
+type NamePolicy func(goName string) string
+
+/*
+先頭の大文字の並びを小文字にする。Name は name、URLPath は urlPath、ID は id になる
+*/
+func LowerCamelCase(goName string) string {
+	runes := []rune(goName)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// 小文字が続く大文字は次の単語の先頭なのでそのまま残す
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+/*
+Goの名前をそのまま使う
+*/
+func ExactName(goName string) string {
+	return goName
+}
+
+/*
+Goの値を束縛したオブジェクト。メンバー式で公開されたフィールドの読み出しとメソッドの呼び出しができる
+*/
+type GoObject struct {
+	Value reflect.Value
+	Names NamePolicy
+}
+
+/*
+Goの値を束縛する。namesが nil の場合は LowerCamelCase を使う
+*/
+func NewGoObject(v interface{}, names NamePolicy) *GoObject {
+	if names == nil {
+		names = LowerCamelCase
+	}
+	return &GoObject{Value: reflect.ValueOf(v), Names: names}
+}
+
+func (g *GoObject) Type() ObjectType { return GO_OBJECT_OBJ }
+func (g *GoObject) Inspect() string  { return fmt.Sprintf("go(%s)", g.Value.Type()) }
+
+/*
+名前に対応するメソッドまたはフィールドを取得する。メソッドはレシーバに束縛した組み込み関数になる
+*/
+func (g *GoObject) Member(name string) (Object, bool) {
+	t := g.Value.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		if g.Names(t.Method(i).Name) == name {
+			return g.method(g.Value.Method(i)), true
+		}
+	}
+
+	v := g.Value
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		fieldName, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		// タグで名前を指定していない場合だけ規則で変換する
+		if field.Tag.Get("monkey") == "" {
+			fieldName = g.Names(field.Name)
+		}
+		if fieldName == name {
+			return g.wrap(v.Field(i)), true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+メソッドを組み込み関数にする。引数は ToGo と同じ規則でGoの値に変換する。
+戻り値の最後が error の場合、nil でなければエラーオブジェクトを返す
+*/
+func (g *GoObject) method(m reflect.Value) *Builtin {
+	t := m.Type()
+
+	return &Builtin{Fn: func(args ...Object) Object {
+		if !t.IsVariadic() && len(args) != t.NumIn() || t.IsVariadic() && len(args) < t.NumIn()-1 {
+			return &Error{Kind: ArgumentError, Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d", len(args), t.NumIn())}
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				paramType = t.In(t.NumIn() - 1).Elem()
+			} else {
+				paramType = t.In(i)
+			}
+			in[i] = reflect.New(paramType).Elem()
+			if err := toGoValue(arg, in[i]); err != nil {
+				return &Error{Kind: TypeError, Message: fmt.Sprintf("argument %d: %s", i+1, err)}
+			}
+		}
+
+		out := m.Call(in)
+
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return &Error{Message: err.Interface().(error).Error()}
+			}
+			out = out[:len(out)-1]
+		}
+
+		switch len(out) {
+		case 0:
+			return NULL
+		case 1:
+			return g.wrap(out[0])
+		}
+		elements := make([]Object, len(out))
+		for i, v := range out {
+			elements[i] = g.wrap(v)
+		}
+		return &Array{Elements: elements}
+	}}
+}
+
+/*
+フィールドやメソッドの戻り値をオブジェクトにする。構造体とそのポインタは同じ名前の規則で束縛し、
+それ以外は FromGo で変換する
+*/
+func (g *GoObject) wrap(v reflect.Value) Object {
+	switch {
+	case v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct:
+		return &GoObject{Value: v, Names: g.Names}
+	case v.Kind() == reflect.Struct && v.CanAddr():
+		return &GoObject{Value: v.Addr(), Names: g.Names}
+	case v.Kind() == reflect.Struct:
+		return &GoObject{Value: v, Names: g.Names}
+	}
+
+	obj, err := fromGoValue(v)
+	if err != nil {
+		return &Error{Message: err.Error()}
+	}
+	return obj
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
@@ -0,0 +1,19 @@
+package object
+
+import "testing"
+
+func TestLowerCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":    "name",
+		"URLPath": "urlPath",
+		"ID":      "id",
+		"HTTP2":   "http2",
+		"x":       "x",
+	}
+
+	for input, expected := range tests {
+		if got := LowerCamelCase(input); got != expected {
+			t.Errorf("LowerCamelCase(%q) wrong. want=%q, got=%q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package object
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/token"
+)
+
+const COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+/*
+コンパイル済みの関数。クロージャの本体として仮想マシンで実行する
+*/
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int  // パラメータを含むローカル変数の数
+	NumParameters int  // 可変長パラメータを含むパラメータの数
+	Variadic      bool // 最後のパラメータが残りの引数を配列で受け取るかどうか
+	Name          string
+	Source        string // 評価器の関数と同じ形式の文字列表現
+
+	Positions map[int]token.Position // 命令のオフセットごとの、命令を生成したノードの位置
+	CallNames map[int]string         // OpCall のオフセットごとの、呼び出す関数の名前
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+/*
+仮想マシンの外から呼び出せる関数。組み込み関数にコールバックとして渡されたクロージャなどを評価器から呼び出す
+*/
+type Callable interface {
+	Object
+	Call(args []Object) Object
+}
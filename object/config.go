@@ -0,0 +1,37 @@
+package object
+
+/*
+評価の設定。環境ごとに設定し、その環境を最も外側とする評価ごとに適用する。
+ゼロ値は関数呼び出しの入れ子を DefaultMaxCallDepth までに制限し、ほかは制限しない
+*/
+type Config struct {
+	MaxSteps int64 // 評価するノードの数の上限。0 なら制限しない
+
+	// ユーザー定義関数とクラスの呼び出しの入れ子の上限。超えるとGoのスタックを使い切る前にエラーを返す。
+	// 0 なら DefaultMaxCallDepth、負なら制限しない
+	MaxCallDepth int64
+
+	// 評価で作る文字列・配列・ハッシュのおおよその大きさ (バイト) の上限。0 なら制限しない。
+	// 同時に存在する値の大きさではなく、評価ごとに作った量の累計を数えるので、
+	// 捨てた値の分も減らない。ひとつで上限を超える値は作る前にエラーにする
+	MaxAllocation int64
+
+	Overflow OverflowMode // 整数演算がオーバーフローした場合の扱い
+}
+
+/*
+Config の MaxCallDepth が 0 の場合の、関数呼び出しの入れ子の上限
+*/
+const DefaultMaxCallDepth = 10000
+
+/*
+整数演算がオーバーフローした場合の扱い。OverflowPromote にすると factorial(30) のような計算も正しく行え、
+OverflowRaise にすると折り返した値で計算を続けずにエラーにする
+*/
+type OverflowMode int
+
+const (
+	OverflowWrap    OverflowMode = iota // int64 の範囲で折り返す(既定)
+	OverflowPromote                     // 多倍長整数に昇格する
+	OverflowRaise                       // OverflowError のエラーを返す
+)
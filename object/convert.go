@@ -0,0 +1,427 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+/*
+Goの値をオブジェクトに変換する。スライスと配列は配列に、マップと構造体はハッシュになる。
+構造体は公開されたフィールドだけを変換し、キーには `monkey:"name"` タグの名前かフィールド名を使う。
+タグが "-" のフィールドは無視する
+*/
+func FromGo(v interface{}) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return fromGoValue(reflect.ValueOf(v))
+}
+
+func fromGoValue(v reflect.Value) (Object, error) {
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return newInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return newInteger(new(big.Int).SetUint64(v.Uint())), nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		return fromGoValue(v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NULL, nil
+		}
+		// []byte はバイト列にする
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			value := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(value), v)
+			return &Bytes{Value: value}, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := fromGoValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return NULL, nil
+		}
+		pairs := make([]HashPair, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := fromGoValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(Hashable); !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := fromGoValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, HashPair{Key: key, Value: value})
+		}
+		// マップの順番は決まっていないので、キーの順に並べて追加する
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+		hash := &Hash{Pairs: make(map[HashKey]HashPair, len(pairs))}
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(Hashable).HashKey(), pair)
+		}
+		return hash, nil
+
+	case reflect.Struct:
+		hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			value, err := fromGoValue(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			key := &String{Value: name}
+			hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+		}
+		return hash, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert Go value of type %s", v.Type())
+}
+
+/*
+big.Int を整数オブジェクトにする。int64 に収まる場合は通常の整数にする
+*/
+func newInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+/*
+構造体のフィールドに対応するハッシュキーの名前。変換しないフィールドの場合はfalseを返す
+*/
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	switch tag := field.Tag.Get("monkey"); tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+/*
+オブジェクトをGoの値に変換して target が指す先に代入する。target はポインタでなければならない。
+target が *interface{} の場合は、整数を int64、多倍長整数を *big.Int、配列を []interface{}、
+キーが全て文字列のハッシュを map[string]interface{}、それ以外のハッシュを
+map[interface{}]interface{} にする
+*/
+func ToGo(obj Object, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+	return toGoValue(obj, v.Elem())
+}
+
+func toGoValue(obj Object, dst reflect.Value) error {
+	t := dst.Type()
+
+	if t.Implements(objectType) && reflect.TypeOf(obj).AssignableTo(t) {
+		dst.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	// 束縛したGoの値はそのまま代入する
+	if g, ok := obj.(*GoObject); ok {
+		if g.Value.Type().AssignableTo(t) {
+			dst.Set(g.Value)
+			return nil
+		}
+		if g.Value.Kind() == reflect.Ptr && g.Value.Type().Elem().AssignableTo(t) && !g.Value.IsNil() {
+			dst.Set(g.Value.Elem())
+			return nil
+		}
+	}
+	if obj == NULL {
+		switch dst.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+	}
+	if t == bigIntType && isIntegerObject(obj) {
+		dst.Set(reflect.ValueOf(new(big.Int).Set(toBigInt(obj))))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		value, err := toGoInterface(obj)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			dst.Set(reflect.Zero(t))
+		} else {
+			dst.Set(reflect.ValueOf(value))
+		}
+		return nil
+
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := toGoValue(obj, elem.Elem()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+
+	case reflect.Bool:
+		if b, ok := obj.(*Boolean); ok {
+			dst.SetBool(b.Value)
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isIntegerObject(obj) {
+			n := toBigInt(obj)
+			if !n.IsInt64() || dst.OverflowInt(n.Int64()) {
+				return fmt.Errorf("integer %s overflows %s", n, t)
+			}
+			dst.SetInt(n.Int64())
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if isIntegerObject(obj) {
+			n := toBigInt(obj)
+			if !n.IsUint64() || dst.OverflowUint(n.Uint64()) {
+				return fmt.Errorf("integer %s overflows %s", n, t)
+			}
+			dst.SetUint(n.Uint64())
+			return nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*String); ok {
+			dst.SetString(s.Value)
+			return nil
+		}
+
+	case reflect.Slice:
+		if b, ok := obj.(*Bytes); ok && t.Elem().Kind() == reflect.Uint8 {
+			value := reflect.MakeSlice(t, len(b.Value), len(b.Value))
+			reflect.Copy(value, reflect.ValueOf(b.Value))
+			dst.Set(value)
+			return nil
+		}
+		if elements, ok := goElements(obj); ok {
+			value := reflect.MakeSlice(t, len(elements), len(elements))
+			for i, el := range elements {
+				if err := toGoValue(el, value.Index(i)); err != nil {
+					return err
+				}
+			}
+			dst.Set(value)
+			return nil
+		}
+
+	case reflect.Array:
+		if elements, ok := goElements(obj); ok {
+			if len(elements) != dst.Len() {
+				return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(elements), t)
+			}
+			for i, el := range elements {
+				if err := toGoValue(el, dst.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+	case reflect.Map:
+		if hash, ok := obj.(*Hash); ok {
+			value := reflect.MakeMapWithSize(t, len(hash.Pairs))
+			for _, pair := range hash.OrderedPairs() {
+				k := reflect.New(t.Key()).Elem()
+				if err := toGoValue(pair.Key, k); err != nil {
+					return err
+				}
+				v := reflect.New(t.Elem()).Elem()
+				if err := toGoValue(pair.Value, v); err != nil {
+					return err
+				}
+				value.SetMapIndex(k, v)
+			}
+			dst.Set(value)
+			return nil
+		}
+
+	case reflect.Struct:
+		if hash, ok := obj.(*Hash); ok {
+			for i := 0; i < dst.NumField(); i++ {
+				name, ok := fieldName(t.Field(i))
+				if !ok {
+					continue
+				}
+				key := &String{Value: name}
+				pair, ok := hash.Pairs[key.HashKey()]
+				if !ok {
+					continue
+				}
+				if err := toGoValue(pair.Value, dst.Field(i)); err != nil {
+					return fmt.Errorf("field %s: %s", t.Field(i).Name, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+/*
+オブジェクトを型の決まっていないGoの値に変換する
+*/
+func toGoInterface(obj Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *String:
+		return obj.Value, nil
+	case *Bytes:
+		return append([]byte(nil), obj.Value...), nil
+	case *Array, *Set:
+		elements, _ := goElements(obj)
+		values := make([]interface{}, len(elements))
+		for i, el := range elements {
+			value, err := toGoInterface(el)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *Hash:
+		pairs := obj.OrderedPairs()
+		stringKeys := true
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*String); !ok {
+				stringKeys = false
+			}
+		}
+		if stringKeys {
+			values := make(map[string]interface{}, len(pairs))
+			for _, pair := range pairs {
+				value, err := toGoInterface(pair.Value)
+				if err != nil {
+					return nil, err
+				}
+				values[pair.Key.(*String).Value] = value
+			}
+			return values, nil
+		}
+		values := make(map[interface{}]interface{}, len(pairs))
+		for _, pair := range pairs {
+			key, err := toGoInterface(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			// *big.Int はマップのキーとして比較できないので文字列にする
+			if n, ok := key.(*big.Int); ok {
+				key = n.String()
+			}
+			value, err := toGoInterface(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
+
+/*
+配列または集合の要素を取り出す
+*/
+func goElements(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements, true
+	case *Set:
+		return obj.OrderedElements(), true
+	}
+	return nil, false
+}
+
+func isIntegerObject(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger:
+		return true
+	}
+	return false
+}
+
+func toBigInt(obj Object) *big.Int {
+	if bi, ok := obj.(*BigInteger); ok {
+		return bi.Value
+	}
+	return big.NewInt(obj.(*Integer).Value)
+}
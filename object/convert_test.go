@@ -0,0 +1,104 @@
+package object
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type convertPoint struct {
+	X      int
+	Y      int    `monkey:"y"`
+	Label  string `monkey:"-"`
+	hidden bool
+}
+
+func TestFromGo(t *testing.T) {
+	big1, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint64(1) << 63, "9223372036854775808"},
+		{big1, "123456789012345678901234567890"},
+		{"a", `"a"`},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"x", "y"}, `["x", "y"]`},
+		{[]byte("hi"), `b"hi"`},
+		{map[string]int{"b": 2, "a": 1}, `{"a": 1, "b": 2}`},
+		{convertPoint{X: 1, Y: 2, Label: "p"}, `{"X": 1, "y": 2}`},
+		{&convertPoint{X: 3}, `{"X": 3, "y": 0}`},
+		{(*convertPoint)(nil), "null"},
+		{[]interface{}{1, "a", nil}, `[1, "a", null]`},
+		{&Integer{Value: 5}, "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%s, got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, err := FromGo(1.5); err == nil {
+		t.Errorf("FromGo(1.5) did not return error")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash := &Hash{}
+	for i, name := range []string{"X", "y", "Label"} {
+		key := &String{Value: name}
+		var value Object = &Integer{Value: int64(i + 1)}
+		if name == "Label" {
+			value = &String{Value: "ignored"}
+		}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+	}
+
+	var point convertPoint
+	if err := ToGo(hash, &point); err != nil {
+		t.Fatalf("ToGo returned error: %s", err)
+	}
+	if point != (convertPoint{X: 1, Y: 2}) {
+		t.Errorf("ToGo into struct wrong. got=%+v", point)
+	}
+
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, TRUE, NULL, &String{Value: "s"}, hash}}
+	var generic interface{}
+	if err := ToGo(arr, &generic); err != nil {
+		t.Fatalf("ToGo returned error: %s", err)
+	}
+	expected := []interface{}{int64(1), true, nil, "s",
+		map[string]interface{}{"X": int64(1), "y": int64(2), "Label": "ignored"}}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("ToGo into interface{} wrong. got=%#v", generic)
+	}
+
+	var ints []int
+	if err := ToGo(&Array{Elements: []Object{&Integer{Value: 4}}}, &ints); err != nil || len(ints) != 1 || ints[0] != 4 {
+		t.Errorf("ToGo into []int wrong. got=%v, err=%v", ints, err)
+	}
+
+	var small int8
+	if err := ToGo(&Integer{Value: 300}, &small); err == nil || err.Error() != "integer 300 overflows int8" {
+		t.Errorf("ToGo overflow returned wrong error. got=%v", err)
+	}
+
+	var s string
+	if err := ToGo(&Integer{Value: 1}, &s); err == nil || err.Error() != "cannot convert INTEGER to string" {
+		t.Errorf("ToGo type mismatch returned wrong error. got=%v", err)
+	}
+
+	if err := ToGo(NULL, s); err == nil {
+		t.Errorf("ToGo with non-pointer target did not return error")
+	}
+}
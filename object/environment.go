@@ -1,42 +1,434 @@
 package object
 
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+束縛の数がこれを超えるまではスライスで持ち、超えたらマップに切り替える
+*/
+const smallEnvironmentSize = 8
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{outer: outer}
+}
+
+/*
+関数呼び出しの環境を生成。layout の名前は解決パスで決めたスロットに束縛する
+*/
+func NewFunctionEnvironment(outer *Environment, layout []string) *Environment {
+	return &Environment{outer: outer, layout: layout, slots: make([]binding, len(layout))}
 }
 
 /*
 新規環境を生成
 */
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{}
 }
 
 /*
-環境型
+モジュールを評価する環境を生成。imports は評価するモジュールと、それをインポートしたモジュールの絶対パス。
+owner はインポートした環境で、モジュールの評価とモジュールの関数の呼び出しには owner のコンテキストや Policy、
+Config、上限までの量を使う。owner が nil ならモジュールの環境そのものを使う
+*/
+func NewModuleEnvironment(owner *Environment, imports []string) *Environment {
+	env := &Environment{imports: imports}
+	if owner != nil {
+		env.owner = owner.interpreter()
+	}
+	return env
+}
+
+/*
+環境型。spawn した関数と環境を共有するため、束縛の読み書きは排他制御する。
+関数呼び出しのたびに生成されるので、束縛が少ないうちはマップを作らずスライスで持つ
 */
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	mu        sync.RWMutex
+	layout    []string           // スロットに割り当てた名前
+	slots     []binding          // layout の名前の束縛。値が nil なら未束縛
+	small     []namedBinding     // 束縛が少ない間の格納先
+	store     map[string]binding // 束縛が smallEnvironmentSize を超えた後の格納先
+	outer     *Environment
+	generator *Generator // この環境で本体を実行しているジェネレーター
+	calls     int64      // この環境を最も外側とする関数の、実行中の呼び出しの数
+	steps     int64      // この環境を最も外側とする評価の手数
+	allocated int64      // この環境を最も外側とする評価で作った値のおおよその大きさの累計
+	policy    *Policy    // この環境を最も外側とする評価で組み込み関数に許可する操作
+	running   int64      // この環境を最も外側とする、実行中の評価の数
+	imports   []string   // この環境で評価しているモジュールまでのインポートの入れ子
+
+	ctx     atomic.Pointer[context.Context] // この環境を最も外側とする評価を打ち切るためのコンテキスト
+	config  atomic.Pointer[Config]          // この環境を最も外側とする評価の設定
+	owner   *Environment                    // モジュールの環境なら、インポートしたインタプリタの最も外側の環境
+	modules interface{}                     // このインタプリタで読み込んだモジュールのキャッシュ
+}
+
+/*
+環境に登録された束縛
+*/
+type binding struct {
+	value    Object
+	constant bool // 再宣言できない束縛かどうか
+}
+
+type namedBinding struct {
+	name string
+	binding
+}
+
+/*
+現在のスコープから束縛を探す。呼び出し側で読み込みのロックを取っておく
+*/
+func (e *Environment) lookup(name string) (binding, bool) {
+	if i := e.slotIndex(name); i >= 0 {
+		return e.slots[i], e.slots[i].value != nil
+	}
+	if e.store != nil {
+		b, ok := e.store[name]
+		return b, ok
+	}
+	for i := range e.small {
+		if e.small[i].name == name {
+			return e.small[i].binding, true
+		}
+	}
+	return binding{}, false
+}
+
+/*
+現在のスコープに束縛を登録する。呼び出し側で書き込みのロックを取っておく
+*/
+func (e *Environment) bind(name string, b binding) {
+	if i := e.slotIndex(name); i >= 0 {
+		e.slots[i] = b
+		return
+	}
+	if e.store != nil {
+		e.store[name] = b
+		return
+	}
+	for i := range e.small {
+		if e.small[i].name == name {
+			e.small[i].binding = b
+			return
+		}
+	}
+	if len(e.small) < smallEnvironmentSize {
+		e.small = append(e.small, namedBinding{name: name, binding: b})
+		return
+	}
+
+	e.store = make(map[string]binding, len(e.small)+1)
+	for _, nb := range e.small {
+		e.store[nb.name] = nb.binding
+	}
+	e.store[name] = b
+	e.small = nil
+}
+
+/*
+名前に割り当てたスロットの番号を取得。スロットがなければ -1
+*/
+func (e *Environment) slotIndex(name string) int {
+	for i, n := range e.layout {
+		if n == name {
+			return i
+		}
+	}
+	return -1
 }
 
 /*
 指定された名前のオブジェクトを環境から取得
 */
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	e.mu.RLock()
+	b, ok := e.lookup(name)
+	e.mu.RUnlock()
 	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+		return e.outer.Get(name)
 	}
-	return obj, ok
+	return b.value, ok
 }
 
 /*
 環境にオブジェクトをセット
 */
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bind(name, binding{value: val})
 	return val
 }
+
+/*
+depth 個外側の環境から外側に向かって、指定された名前のオブジェクトを取得
+*/
+func (e *Environment) GetFrom(depth int, name string) (Object, bool) {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.outer
+	}
+	if e == nil {
+		return nil, false
+	}
+	return e.Get(name)
+}
+
+/*
+depth 個外側の環境のスロットからオブジェクトを取得。スロットが未束縛なら ok は偽
+*/
+func (e *Environment) GetAt(depth, slot int) (Object, bool) {
+	for ; depth > 0 && e != nil; depth-- {
+		e = e.outer
+	}
+	if e == nil || slot >= len(e.slots) {
+		return nil, false
+	}
+	e.mu.RLock()
+	val := e.slots[slot].value
+	e.mu.RUnlock()
+	return val, val != nil
+}
+
+/*
+スロットにオブジェクトをセット
+*/
+func (e *Environment) SetAt(slot int, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.slots[slot] = binding{value: val}
+	return val
+}
+
+/*
+スロットに定数としてオブジェクトをセット
+*/
+func (e *Environment) SetConstantAt(slot int, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.slots[slot] = binding{value: val, constant: true}
+	return val
+}
+
+/*
+スロットが定数として束縛されているかどうか判定
+*/
+func (e *Environment) IsConstantAt(slot int) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.slots[slot].constant
+}
+
+/*
+環境に定数としてオブジェクトをセット
+*/
+func (e *Environment) SetConstant(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bind(name, binding{value: val, constant: true})
+	return val
+}
+
+/*
+指定された名前が現在のスコープで定数として束縛されているかどうか判定
+*/
+func (e *Environment) IsConstant(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	b, ok := e.lookup(name)
+	return ok && b.constant
+}
+
+/*
+現在のスコープに束縛されている名前を昇順で取得
+*/
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.layout)+len(e.store)+len(e.small))
+	for i, name := range e.layout {
+		if e.slots[i].value != nil {
+			names = append(names, name)
+		}
+	}
+	for name := range e.store {
+		names = append(names, name)
+	}
+	for _, nb := range e.small {
+		names = append(names, nb.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+最も外側の環境で数える実行中の関数呼び出しを一つ増やし、増やした後の数を返す。
+spawn で並行に実行している呼び出しも合わせて数える
+*/
+func (e *Environment) EnterCall() int64 {
+	return atomic.AddInt64(&e.interpreter().calls, 1)
+}
+
+/*
+EnterCall で増やした実行中の関数呼び出しを一つ減らす
+*/
+func (e *Environment) LeaveCall() {
+	atomic.AddInt64(&e.interpreter().calls, -1)
+}
+
+/*
+最も外側の環境で評価を始める。ほかに実行中の評価がなければ手数と作った値の大きさの累計を数え直す。
+評価が終わったら返された関数を呼ぶ
+*/
+func (e *Environment) BeginEvaluation() (end func()) {
+	root := e.interpreter()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.running == 0 {
+		atomic.StoreInt64(&root.steps, 0)
+		atomic.StoreInt64(&root.allocated, 0)
+	}
+	root.running++
+	return func() {
+		root.mu.Lock()
+		defer root.mu.Unlock()
+		root.running--
+	}
+}
+
+/*
+最も外側の環境で数える評価の手数を一つ増やし、増やした後の数を返す
+*/
+func (e *Environment) Step() int64 {
+	return atomic.AddInt64(&e.interpreter().steps, 1)
+}
+
+/*
+最も外側の環境で数える、作った値の大きさの累計に size を加え、加えた後の累計を返す
+*/
+func (e *Environment) Allocate(size int64) int64 {
+	return atomic.AddInt64(&e.interpreter().allocated, size)
+}
+
+/*
+最も外側の環境にコンテキストをセットし、セットする前のコンテキストを返す
+*/
+func (e *Environment) SetContext(ctx context.Context) context.Context {
+	if prev := e.interpreter().ctx.Swap(&ctx); prev != nil {
+		return *prev
+	}
+	return nil
+}
+
+/*
+最も外側の環境にセットされたコンテキストを取得。セットされていなければ nil。
+関数を呼び出すたびに確かめるのでロックを取らずに読む
+*/
+func (e *Environment) Context() context.Context {
+	if ctx := e.interpreter().ctx.Load(); ctx != nil {
+		return *ctx
+	}
+	return nil
+}
+
+/*
+最も外側の環境に組み込み関数に許可する操作をセットする。nil なら DefaultPolicy を適用する
+*/
+func (e *Environment) SetPolicy(policy *Policy) {
+	root := e.interpreter()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.policy = policy
+}
+
+/*
+最も外側の環境にセットされた、組み込み関数に許可する操作を取得。セットされていなければ nil
+*/
+func (e *Environment) Policy() *Policy {
+	root := e.interpreter()
+	root.mu.RLock()
+	defer root.mu.RUnlock()
+	return root.policy
+}
+
+/*
+最も外側の環境に評価の設定をセットする
+*/
+func (e *Environment) SetConfig(config Config) {
+	e.interpreter().config.Store(&config)
+}
+
+/*
+最も外側の環境にセットされた評価の設定を取得。ノードを評価するたびに読むのでロックを取らない
+*/
+func (e *Environment) Config() Config {
+	if config := e.interpreter().config.Load(); config != nil {
+		return *config
+	}
+	return Config{}
+}
+
+/*
+最も外側の環境で評価しているモジュールと、それをインポートしたモジュールの絶対パスをインポートの入れ子順に取得。
+モジュールでなければ空
+*/
+func (e *Environment) Imports() []string {
+	return e.Root().imports
+}
+
+/*
+このインタプリタで読み込んだモジュールのキャッシュを取得。まだなければ create で生成してセットする。
+キャッシュの中身はモジュールローダーが管理する
+*/
+func (e *Environment) ModuleCache(create func() interface{}) interface{} {
+	root := e.interpreter()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.modules == nil {
+		root.modules = create()
+	}
+	return root.modules
+}
+
+/*
+評価の状態を持つインタプリタの最も外側の環境を取得。モジュールの環境ではインポートした環境の最も外側の環境
+*/
+func (e *Environment) interpreter() *Environment {
+	root := e.Root()
+	if root.owner != nil {
+		return root.owner
+	}
+	return root
+}
+
+/*
+最も外側の環境を取得
+*/
+func (e *Environment) Root() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+/*
+この環境で本体を実行するジェネレーターをセット
+*/
+func (e *Environment) SetGenerator(g *Generator) {
+	e.generator = g
+}
+
+/*
+外側の環境までたどって、実行中のジェネレーターを取得
+*/
+func (e *Environment) Generator() (*Generator, bool) {
+	if e.generator == nil && e.outer != nil {
+		return e.outer.Generator()
+	}
+	return e.generator, e.generator != nil
+}
@@ -0,0 +1,80 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEnvironmentGrowsPastSmallSize(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("outer", &Integer{Value: -1})
+	env := NewEnclosedEnvironment(outer)
+
+	n := smallEnvironmentSize * 2
+	for i := 0; i < n; i++ {
+		env.Set(fmt.Sprintf("v%02d", i), &Integer{Value: int64(i)})
+		// 途中で上書きしても束縛の数は増えない
+		env.Set("v00", &Integer{Value: 100})
+	}
+	env.SetConstant("c", TRUE)
+
+	for i := 1; i < n; i++ {
+		val, ok := env.Get(fmt.Sprintf("v%02d", i))
+		if !ok || val.(*Integer).Value != int64(i) {
+			t.Errorf("v%02d wrong. got=%v", i, val)
+		}
+	}
+	if val, _ := env.Get("v00"); val.(*Integer).Value != 100 {
+		t.Errorf("v00 was not overwritten. got=%s", val.Inspect())
+	}
+	if val, ok := env.Get("outer"); !ok || val.(*Integer).Value != -1 {
+		t.Errorf("outer binding not found. got=%v", val)
+	}
+	if !env.IsConstant("c") || env.IsConstant("v01") {
+		t.Errorf("IsConstant wrong")
+	}
+	if len(env.Names()) != n+1 {
+		t.Errorf("Names has wrong length. got=%d", len(env.Names()))
+	}
+}
+
+func BenchmarkEnclosedEnvironment(b *testing.B) {
+	outer := NewEnvironment()
+	outer.Set("f", NULL)
+	for i := 0; i < b.N; i++ {
+		env := NewEnclosedEnvironment(outer)
+		env.Set("n", &Integer{Value: int64(i)})
+		env.Get("n")
+		env.Get("f")
+	}
+}
+
+func TestFunctionEnvironmentSlots(t *testing.T) {
+	outer := NewFunctionEnvironment(nil, []string{"a", "b"})
+	outer.SetAt(1, &Integer{Value: 2})
+	env := NewFunctionEnvironment(outer, []string{"c"})
+	env.SetConstantAt(0, &Integer{Value: 3})
+	env.Set("d", &Integer{Value: 4})
+
+	if val, ok := env.GetAt(1, 1); !ok || val.(*Integer).Value != 2 {
+		t.Errorf("GetAt(1, 1) wrong. got=%v", val)
+	}
+	// 未束縛のスロットは見つからない
+	if _, ok := env.GetAt(1, 0); ok {
+		t.Errorf("unbound slot was found")
+	}
+	// スロットに割り当てた名前は名前でも読み書きできる
+	if val, ok := env.Get("b"); !ok || val.(*Integer).Value != 2 {
+		t.Errorf(`Get("b") wrong. got=%v`, val)
+	}
+	outer.Set("a", &Integer{Value: 1})
+	if val, ok := env.GetAt(1, 0); !ok || val.(*Integer).Value != 1 {
+		t.Errorf("GetAt(1, 0) wrong. got=%v", val)
+	}
+	if !env.IsConstantAt(0) || !env.IsConstant("c") {
+		t.Errorf("IsConstantAt wrong")
+	}
+	if names := env.Names(); len(names) != 2 || names[0] != "c" || names[1] != "d" {
+		t.Errorf("Names wrong. got=%v", names)
+	}
+}
@@ -0,0 +1,92 @@
+package object
+
+/*
+要素を一つずつ取り出すイテレーター。要素が尽きるとfalseを返す。
+途中でエラーが起きた場合はエラーオブジェクトをfalseとともに返す
+*/
+type Iterator interface {
+	Next() (Object, bool)
+}
+
+/*
+イテレーターを生成できるオブジェクト
+*/
+type Iterable interface {
+	Iterator() Iterator
+}
+
+/*
+関数をイテレーターとして使うためのアダプター
+*/
+type IteratorFunc func() (Object, bool)
+
+func (f IteratorFunc) Next() (Object, bool) { return f() }
+
+/*
+スライスの要素を順に返すイテレーター
+*/
+func sliceIterator(elements []Object) Iterator {
+	i := 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(elements) {
+			return nil, false
+		}
+		i++
+		return elements[i-1], true
+	})
+}
+
+/*
+配列の要素を順に返す
+*/
+func (ao *Array) Iterator() Iterator {
+	return sliceIterator(ao.Elements)
+}
+
+/*
+ハッシュのキーを挿入された順に返す
+*/
+func (h *Hash) Iterator() Iterator {
+	pairs := h.OrderedPairs()
+	keys := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return sliceIterator(keys)
+}
+
+/*
+文字列の文字を一文字ずつの文字列として返す
+*/
+func (s *String) Iterator() Iterator {
+	runes := []rune(s.Value)
+	i := 0
+	return IteratorFunc(func() (Object, bool) {
+		if i >= len(runes) {
+			return nil, false
+		}
+		i++
+		return &String{Value: string(runes[i-1])}, true
+	})
+}
+
+/*
+範囲の整数を順に返す
+*/
+func (r *Range) Iterator() Iterator {
+	i := int64(0)
+	return IteratorFunc(func() (Object, bool) {
+		if i >= r.Len() {
+			return nil, false
+		}
+		i++
+		return r.At(i - 1), true
+	})
+}
+
+/*
+ジェネレーターが生成する値を順に返す
+*/
+func (g *Generator) Iterator() Iterator {
+	return IteratorFunc(g.Next)
+}
@@ -0,0 +1,164 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+/*
+オブジェクトをJSONに変換する。集合は配列になり、文字列以外のハッシュキーは Inspect の表記を使う。
+JSONで表せない値の場合はエラーを返す
+*/
+func ToJSON(obj Object) ([]byte, error) {
+	var out bytes.Buffer
+	if err := writeJSON(&out, obj); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeJSON(out *bytes.Buffer, obj Object) error {
+	switch obj := obj.(type) {
+	case *Integer, *BigInteger, *Boolean:
+		out.WriteString(obj.Inspect())
+	case *Null:
+		out.WriteString("null")
+	case *String:
+		return writeJSONString(out, obj.Value)
+	case *Array:
+		return writeJSONArray(out, obj.Elements)
+	case *Set:
+		return writeJSONArray(out, obj.OrderedElements())
+	case *Hash:
+		out.WriteString("{")
+		for i, pair := range obj.OrderedPairs() {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			key := pair.Key.Inspect()
+			if str, ok := pair.Key.(*String); ok {
+				key = str.Value
+			}
+			if err := writeJSONString(out, key); err != nil {
+				return err
+			}
+			out.WriteString(":")
+			if err := writeJSON(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+	default:
+		return fmt.Errorf("cannot convert %s to JSON", obj.Type())
+	}
+
+	return nil
+}
+
+func writeJSONString(out *bytes.Buffer, s string) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	out.Write(encoded)
+	return nil
+}
+
+func writeJSONArray(out *bytes.Buffer, elements []Object) error {
+	out.WriteString("[")
+	for i, el := range elements {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		if err := writeJSON(out, el); err != nil {
+			return err
+		}
+	}
+	out.WriteString("]")
+	return nil
+}
+
+/*
+JSONをオブジェクトに変換する。オブジェクトのキーの順番は保たれる。
+Monkey には浮動小数点数がないため、整数でない数値はエラーになる
+*/
+func FromJSON(data []byte) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	obj, err := readJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after top-level value")
+	}
+
+	return obj, nil
+}
+
+func readJSON(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected end of input")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %s", err)
+	}
+
+	switch tok := tok.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		if tok {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case string:
+		return &String{Value: tok}, nil
+	case json.Number:
+		value, ok := new(big.Int).SetString(tok.String(), 10)
+		if !ok {
+			return nil, fmt.Errorf("unsupported JSON number: %s", tok)
+		}
+		if value.IsInt64() {
+			return &Integer{Value: value.Int64()}, nil
+		}
+		return &BigInteger{Value: value}, nil
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				el, err := readJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, el)
+			}
+			dec.Token() // ']'
+			return &Array{Elements: elements}, nil
+		}
+
+		// '{' の場合。キーは必ず文字列になる
+		hash := &Hash{Pairs: make(map[HashKey]HashPair)}
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON: %s", err)
+			}
+			key := &String{Value: keyToken.(string)}
+			value, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(key.HashKey(), HashPair{Key: key, Value: value})
+		}
+		dec.Token() // '}'
+		return hash, nil
+	}
+
+	return nil, fmt.Errorf("invalid JSON: unexpected token %v", tok)
+}
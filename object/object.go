@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
+	"monkey/token"
+	"net"
+	"sort"
 	"strings"
 )
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
@@ -19,6 +24,15 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+	CLASS_OBJ        = "CLASS"
+	INSTANCE_OBJ     = "INSTANCE"
+	GENERATOR_OBJ    = "GENERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	SET_OBJ          = "SET"
+	BYTES_OBJ        = "BYTES"
+	CONNECTION_OBJ   = "CONNECTION"
+	GO_OBJECT_OBJ    = "GO_OBJECT"
 )
 
 type ObjectType string
@@ -38,6 +52,16 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+/*
+多倍長整数型。int64 に収まらない整数を表す
+*/
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+
 /*
 文字列型
 */
@@ -46,7 +70,22 @@ type String struct {
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
-func (s *String) Inspect() string  { return s.Value }
+func (s *String) Inspect() string  { return `"` + escapeString(s.Value) + `"` }
+
+var stringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\n", `\n`,
+	"\t", `\t`,
+	"\r", `\r`,
+	`"`, `\"`,
+)
+
+/*
+文字列をエスケープシーケンス表記に変換
+*/
+func escapeString(s string) string {
+	return stringEscaper.Replace(s)
+}
 
 /*
 真偽値型
@@ -66,6 +105,15 @@ type Null struct{}
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
 
+/*
+null と真偽値の唯一のインスタンス。評価器はポインタの比較でこれらを判定する
+*/
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
 /*
 戻り値
 */
@@ -76,23 +124,115 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+/*
+エラーの種類
+*/
+type ErrorKind string
+
+const (
+	RuntimeError      ErrorKind = "RuntimeError"      // ほかの種類に当てはまらないエラー
+	TypeError         ErrorKind = "TypeError"         // 値の型が演算や引数に合わない
+	NameError         ErrorKind = "NameError"         // 名前が見つからないか、束縛できない
+	ArgumentError     ErrorKind = "ArgumentError"     // 引数の数や名前が合わない
+	ValueError        ErrorKind = "ValueError"        // 型は合っているが値が範囲外か不正
+	ZeroDivisionError ErrorKind = "ZeroDivisionError" // 0 で割った
+	OverflowError     ErrorKind = "OverflowError"     // 整数演算の結果が int64 の範囲を超えた
+	IOError           ErrorKind = "IOError"           // ファイルやネットワーク、外部コマンドなどの操作の失敗
+	ImportError       ErrorKind = "ImportError"       // モジュールを読み込めない
+	PermissionError   ErrorKind = "PermissionError"   // 許可されていない操作
+	AssertionError    ErrorKind = "AssertionError"    // assert が失敗した
+	LimitError        ErrorKind = "LimitError"        // 評価の上限を超えたか、評価が打ち切られた。スクリプトからは捕捉できない
+	InternalError     ErrorKind = "InternalError"     // 組み込み関数などインタプリタ内部でGoのパニックが起きた
+)
+
 /*
 エラー型
 */
 type Error struct {
-	Message string // エラーメッセージ
+	Kind    ErrorKind      // エラーの種類。空なら RuntimeError
+	Message string         // エラーメッセージ
+	Pos     token.Position // エラーが発生したノードの位置
+	Stack   []string       // エラーが通過した関数呼び出しの名前。内側の呼び出しが先頭
+}
+
+/*
+エラーの種類を取得。種類が設定されていなければ RuntimeError
+*/
+func (e *Error) ErrorKind() ErrorKind {
+	if e.Kind == "" {
+		return RuntimeError
+	}
+	return e.Kind
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("ERROR: " + e.Message)
+	if e.Pos.IsValid() {
+		out.WriteString(" at " + e.Pos.String())
+	}
+	// 再帰で同じ関数が続く呼び出しは一つにまとめて回数を書く
+	for i := 0; i < len(e.Stack); {
+		name := e.Stack[i]
+		n := 1
+		for i+n < len(e.Stack) && e.Stack[i+n] == name {
+			n++
+		}
+		if i == 0 {
+			out.WriteString(" in " + name + "()")
+		} else {
+			out.WriteString(" called from " + name + "()")
+		}
+		if n > 1 {
+			fmt.Fprintf(&out, " x%d", n)
+		}
+		i += n
+	}
+	if len(e.Stack) > 0 {
+		out.WriteString(" called from main")
+	}
+
+	return out.String()
+}
+
+/*
+エラーオブジェクトをGoの error として扱うためのラッパー
+*/
+type EvalError struct {
+	Err *Error
+}
+
+func (e *EvalError) Error() string {
+	msg := string(e.Err.ErrorKind()) + ": " + e.Err.Message
+	if e.Err.Pos.IsValid() {
+		msg += " at " + e.Err.Pos.String()
+	}
+	return msg
+}
+
+/*
+評価結果がエラーオブジェクトなら *EvalError を、そうでなければ nil を返す
+*/
+func AsError(obj Object) error {
+	if err, ok := obj.(*Error); ok {
+		return &EvalError{Err: err}
+	}
+	return nil
+}
 
 /*
 関数型
 */
 type Function struct {
 	Parameters []*ast.Identifier
+	Variadic   bool                      // 最後のパラメータが残りの引数を配列で受け取るかどうか
+	Defaults   map[string]ast.Expression // パラメータ名ごとのデフォルト値
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Generator  bool     // 呼び出すとジェネレーターを返すかどうか
+	Slots      []string // 呼び出し時の環境のスロットに割り当てる名前
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -100,8 +240,14 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if f.Variadic && i == len(f.Parameters)-1 {
+			params = append(params, "..."+p.String())
+		} else if def, ok := f.Defaults[p.Value]; ok {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString("fn")
@@ -114,6 +260,50 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+/*
+クラス型
+*/
+type Class struct {
+	Name        string
+	Constructor *Function // パラメータとフィールド定義(let文)を本体に持つ
+	Methods     map[string]*ast.FunctionLiteral
+	Env         *Environment
+}
+
+func (c *Class) Type() ObjectType { return CLASS_OBJ }
+func (c *Class) Inspect() string  { return "class " + c.Name }
+
+/*
+クラスのインスタンス
+*/
+type Instance struct {
+	Class  *Class
+	Fields map[string]Object
+}
+
+func (i *Instance) Type() ObjectType { return INSTANCE_OBJ }
+func (i *Instance) Inspect() string {
+	var out bytes.Buffer
+
+	names := make([]string, 0, len(i.Fields))
+	for name := range i.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := []string{}
+	for _, name := range names {
+		fields = append(fields, name+": "+i.Fields[name].Inspect())
+	}
+
+	out.WriteString(i.Class.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 /*
 組み込み関数
 */
@@ -123,7 +313,8 @@ type BuiltinFunction func(args ...Object) Object
 組み込み型
 */
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn          BuiltinFunction
+	CatchErrors bool // 引数の評価で発生したエラーで中断せず、エラーを引数として受け取るかどうか
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -153,11 +344,52 @@ func (ao *Array) Inspect() string {
 }
 
 /*
-ハッシュキー
+範囲。Startから始まりEndを含まない整数の列を遅延的に表す
+*/
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+
+/*
+範囲に含まれる要素数
+*/
+func (r *Range) Len() int64 {
+	if r.End <= r.Start {
+		return 0
+	}
+	return r.End - r.Start
+}
+
+/*
+範囲のi番目の要素
+*/
+func (r *Range) At(i int64) *Integer {
+	return &Integer{Value: r.Start + i}
+}
+
+/*
+範囲の要素を順に関数に渡す。関数がfalseを返すと打ち切る
+*/
+func (r *Range) Each(fn func(*Integer) bool) {
+	for i := int64(0); i < r.Len(); i++ {
+		if !fn(r.At(i)) {
+			return
+		}
+	}
+}
+
+/*
+ハッシュキー。文字列のようにハッシュ値が衝突しうる型は元の値も持ち、
+ハッシュ値が同じでも値が違えば別のキーになるようにする
 */
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
+	Text  string // 元の値の文字列表現
 }
 
 func (b *Boolean) HashKey() HashKey {
@@ -176,11 +408,19 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	text := bi.Value.String()
+	h.Write([]byte(text))
+
+	return HashKey{Type: bi.Type(), Value: h.Sum64(), Text: text}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Value: h.Sum64(), Text: s.Value}
 }
 
 /*
@@ -192,10 +432,11 @@ type HashPair struct {
 }
 
 /*
-ハッシュ
+ハッシュ。ペアは挿入された順に並ぶ
 */
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	Keys  []HashKey // 挿入された順のキー
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -203,7 +444,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairs = append(pairs,
 			fmt.Sprintf("%s: %s",
 				pair.Key.Inspect(), pair.Value.Inspect()))
@@ -216,6 +457,164 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+/*
+ペアを追加する。既にあるキーの場合は値だけを置き換え、順番は変えない
+*/
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+/*
+ペアを削除する
+*/
+func (h *Hash) Delete(key HashKey) {
+	if _, ok := h.Pairs[key]; !ok {
+		return
+	}
+	delete(h.Pairs, key)
+	for i, k := range h.Keys {
+		if k == key {
+			h.Keys = append(h.Keys[:i:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+/*
+挿入された順に並べたペアを取得。
+Set を使わずに Pairs に直接追加されたペアはキーの順に並べて最後に置く
+*/
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	seen := make(map[HashKey]bool, len(h.Keys))
+	for _, key := range h.Keys {
+		if pair, ok := h.Pairs[key]; ok && !seen[key] {
+			seen[key] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	if len(pairs) == len(h.Pairs) {
+		return pairs
+	}
+
+	rest := []HashPair{}
+	for key, pair := range h.Pairs {
+		if !seen[key] {
+			rest = append(rest, pair)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return keyLess(rest[i].Key, rest[j].Key)
+	})
+
+	return append(pairs, rest...)
+}
+
+/*
+ハッシュキーの大小を比較
+*/
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *BigInteger:
+		return a.Value.Cmp(b.(*BigInteger).Value) < 0
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
+
+/*
+バイト列
+*/
+type Bytes struct {
+	Value []byte
+}
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+func (b *Bytes) Inspect() string  { return fmt.Sprintf("b%q", b.Value) }
+
+/*
+ネットワーク接続
+*/
+type Connection struct {
+	Conn net.Conn
+}
+
+func (c *Connection) Type() ObjectType { return CONNECTION_OBJ }
+func (c *Connection) Inspect() string {
+	return fmt.Sprintf("connection(%s)", c.Conn.RemoteAddr())
+}
+
+/*
+集合。要素はハッシュキーで重複を判定する
+*/
+type Set struct {
+	Elements map[HashKey]Object
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	elements := []string{}
+	for _, el := range s.OrderedElements() {
+		elements = append(elements, el.Inspect())
+	}
+
+	return "set([" + strings.Join(elements, ", ") + "])"
+}
+
+/*
+ハッシュのキーと同じ順に並べた要素を取得
+*/
+func (s *Set) OrderedElements() []Object {
+	elements := make([]Object, 0, len(s.Elements))
+	for _, el := range s.Elements {
+		elements = append(elements, el)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return keyLess(elements[i], elements[j])
+	})
+
+	return elements
+}
+
+/*
+ジェネレーター。実行の中断と再開は評価器が Next と Yield に実装する
+*/
+type Generator struct {
+	Next  func() (Object, bool) // 次の値を生成する。値が尽きた場合はfalseを返す
+	Yield func(Object) Object   // 本体の実行中に値を一つ渡して、次の Next まで中断する
+	Close func()                // 値の生成をやめ、中断中の本体を終わらせる
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+/*
+チャネル。goroutine 間で値を受け渡す
+*/
+type Channel struct {
+	Value chan Object
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
@@ -1,6 +1,12 @@
 package object
 
-import "testing"
+import (
+	"errors"
+	"math/big"
+	"monkey/token"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +26,216 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestHashKeyCollision(t *testing.T) {
+	a := (&String{Value: "a"}).HashKey()
+	b := (&String{Value: "b"}).HashKey()
+	// ハッシュ値が衝突した場合を再現する
+	b.Value = a.Value
+
+	hash := &Hash{}
+	hash.Set(a, HashPair{Key: &String{Value: "a"}, Value: &Integer{Value: 1}})
+	hash.Set(b, HashPair{Key: &String{Value: "b"}, Value: &Integer{Value: 2}})
+
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("colliding keys overwrote each other. got=%d pairs", len(hash.Pairs))
+	}
+	if hash.Pairs[a].Value.(*Integer).Value != 1 {
+		t.Errorf("wrong value for a. got=%s", hash.Pairs[a].Value.Inspect())
+	}
+}
+
+func TestStringInspectEscapes(t *testing.T) {
+	str := &String{Value: "a\nb\t\"c\"\\"}
+
+	expected := `"a\nb\t\"c\"\\"`
+	if str.Inspect() != expected {
+		t.Errorf("str.Inspect() wrong. expected=%q, got=%q", expected, str.Inspect())
+	}
+}
+
+func TestRange(t *testing.T) {
+	r := &Range{Start: 2, End: 5}
+
+	if r.Len() != 3 {
+		t.Errorf("r.Len() wrong. got=%d", r.Len())
+	}
+	if r.At(1).Value != 3 {
+		t.Errorf("r.At(1) wrong. got=%d", r.At(1).Value)
+	}
+	if r.Inspect() != "2..5" {
+		t.Errorf("r.Inspect() wrong. got=%q", r.Inspect())
+	}
+
+	values := []int64{}
+	r.Each(func(i *Integer) bool {
+		values = append(values, i.Value)
+		return true
+	})
+	if len(values) != 3 || values[0] != 2 || values[2] != 4 {
+		t.Errorf("r.Each visited wrong values. got=%v", values)
+	}
+
+	empty := &Range{Start: 5, End: 2}
+	if empty.Len() != 0 {
+		t.Errorf("empty.Len() wrong. got=%d", empty.Len())
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	big1 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)}
+	big2 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)}
+	diff := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 101)}
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if big1.HashKey() == diff.HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+	if big1.Inspect() != "1267650600228229401496703205376" {
+		t.Errorf("big1.Inspect() wrong. got=%q", big1.Inspect())
+	}
+}
+
+func TestIterators(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []string{"b", "a"} {
+		k := &String{Value: key}
+		hash.Pairs[k.HashKey()] = HashPair{Key: k, Value: k}
+	}
+
+	tests := []struct {
+		iterable Iterable
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}}, []string{"1", `"x"`}},
+		{hash, []string{`"a"`, `"b"`}},
+		{&String{Value: "aあ"}, []string{`"a"`, `"あ"`}},
+		{&Range{Start: 2, End: 4}, []string{"2", "3"}},
+		{&Range{Start: 4, End: 2}, []string{}},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		it := tt.iterable.Iterator()
+		for {
+			val, ok := it.Next()
+			if !ok {
+				break
+			}
+			got = append(got, val.Inspect())
+		}
+
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("iterator of %s returned wrong values. want=%v, got=%v",
+				tt.iterable.(Object).Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := &Hash{}
+	for _, key := range []string{"c", "a", "b", "a"} {
+		k := &String{Value: key}
+		hash.Set(k.HashKey(), HashPair{Key: k, Value: k})
+	}
+	hash.Delete((&String{Value: "c"}).HashKey())
+
+	if hash.Inspect() != `{"a": "a", "b": "b"}` {
+		t.Errorf("hash.Inspect() wrong. got=%q", hash.Inspect())
+	}
+	if len(hash.Keys) != 2 {
+		t.Errorf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+}
+
+func TestPretty(t *testing.T) {
+	hash := &Hash{}
+	for _, key := range []string{"name", "tags"} {
+		k := &String{Value: key}
+		var v Object = &String{Value: "monkey"}
+		if key == "tags" {
+			v = &Array{Elements: []Object{&String{Value: "interpreter"}, &String{Value: "go"}}}
+		}
+		hash.Set(k.HashKey(), HashPair{Key: k, Value: v})
+	}
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, hash, &Array{}}}
+
+	tests := []struct {
+		width    int
+		expected string
+	}{
+		{80, `[1, {"name": "monkey", "tags": ["interpreter", "go"]}, []]`},
+		{40, "[\n  1,\n  {\n    \"name\": \"monkey\",\n    \"tags\": [\"interpreter\", \"go\"]\n  },\n  []\n]"},
+		{20, "[\n  1,\n  {\n    \"name\": \"monkey\",\n    \"tags\": [\n      \"interpreter\",\n      \"go\"\n    ]\n  },\n  []\n]"},
+	}
+
+	for _, tt := range tests {
+		got := Pretty(arr, PrettyOptions{Width: tt.width, Indent: "  "})
+		if got != tt.expected {
+			t.Errorf("Pretty with width %d wrong.\nwant=%s\ngot=%s", tt.width, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b":1,"a":[true,null,"x\n"],"c":{}}`, `{"b":1,"a":[true,null,"x\n"],"c":{}}`},
+		{`123456789012345678901234567890`, `123456789012345678901234567890`},
+		{` [ -1 , 2 ] `, `[-1,2]`},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromJSON([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("FromJSON(%q) returned error: %s", tt.input, err)
+		}
+		data, err := ToJSON(obj)
+		if err != nil {
+			t.Fatalf("ToJSON(%s) returned error: %s", obj.Inspect(), err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("round trip of %q wrong. got=%s", tt.input, data)
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, input := range []string{`1.5`, `[1,`, `1 2`, ``} {
+		if _, err := FromJSON([]byte(input)); err == nil {
+			t.Errorf("FromJSON(%q) did not return error", input)
+		}
+	}
+
+	if _, err := ToJSON(&Generator{}); err == nil || err.Error() != "cannot convert GENERATOR to JSON" {
+		t.Errorf("ToJSON(generator) returned wrong error. got=%v", err)
+	}
+
+	obj, _ := FromJSON([]byte(`[true, null]`))
+	if obj.(*Array).Elements[0] != TRUE || obj.(*Array).Elements[1] != NULL {
+		t.Errorf("FromJSON did not return shared TRUE and NULL")
+	}
+}
+
+func TestAsError(t *testing.T) {
+	if AsError(&Integer{Value: 1}) != nil {
+		t.Errorf("expected nil for non-error object")
+	}
+
+	err := AsError(&Error{Kind: TypeError, Message: "type mismatch", Pos: token.Position{Line: 1, Column: 5}})
+	if err == nil || err.Error() != "TypeError: type mismatch at 1:5" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) || evalErr.Err.Kind != TypeError {
+		t.Errorf("expected *EvalError. got=%T", err)
+	}
+
+	if got := AsError(&Error{Message: "boom"}).Error(); got != "RuntimeError: boom" {
+		t.Errorf("wrong message for error without kind. got=%q", got)
+	}
+}
@@ -0,0 +1,28 @@
+package object
+
+/*
+組み込み関数に許可する操作。環境ごとに設定し、信頼できないスクリプトには必要な操作だけを許可する。
+ゼロ値はいずれの操作も許可しない
+*/
+type Policy struct {
+	AllowFileSystem bool // ファイルの読み書き
+	AllowNetwork    bool // ネットワークへの接続
+	AllowExec       bool // 外部コマンドの実行
+	AllowEnv        bool // 環境変数の読み書き
+	AllowImport     bool // モジュールの読み込み
+}
+
+/*
+Policy をセットしていない環境に適用する Policy。外部コマンドの実行とネットワークへの接続は、
+Policy をセットして明示的に許可しなければ使えない
+*/
+func DefaultPolicy() *Policy {
+	return &Policy{AllowFileSystem: true, AllowEnv: true, AllowImport: true}
+}
+
+/*
+すべての操作を許可する Policy
+*/
+func AllowAll() *Policy {
+	return &Policy{AllowFileSystem: true, AllowNetwork: true, AllowExec: true, AllowEnv: true, AllowImport: true}
+}
@@ -0,0 +1,84 @@
+package object
+
+import (
+	"strings"
+)
+
+/*
+整形表示の設定
+*/
+type PrettyOptions struct {
+	Width  int    // 1行に収める最大の文字数
+	Indent string // 1段の字下げに使う文字列
+}
+
+/*
+REPL が使う整形表示の設定
+*/
+var DefaultPrettyOptions = PrettyOptions{Width: 80, Indent: "  "}
+
+/*
+オブジェクトを整形して表示する。1行で Width に収まる場合は Inspect と同じ表示にし、
+収まらない配列とハッシュは要素ごとに改行して字下げする
+*/
+func Pretty(obj Object, opts PrettyOptions) string {
+	var out strings.Builder
+	writePretty(&out, obj, opts, "", 0)
+	return out.String()
+}
+
+/*
+indentは現在の行の字下げ、prefixは同じ行で obj の前に書かれている文字数
+*/
+func writePretty(out *strings.Builder, obj Object, opts PrettyOptions, indent string, prefix int) {
+	flat := obj.Inspect()
+	if len(indent)+prefix+len(flat) <= opts.Width {
+		out.WriteString(flat)
+		return
+	}
+
+	inner := indent + opts.Indent
+
+	switch obj := obj.(type) {
+	case *Array:
+		if len(obj.Elements) == 0 {
+			out.WriteString(flat)
+			return
+		}
+		out.WriteString("[\n")
+		for i, el := range obj.Elements {
+			out.WriteString(inner)
+			writePretty(out, el, opts, inner, 0)
+			writeSeparator(out, i, len(obj.Elements))
+		}
+		out.WriteString(indent + "]")
+
+	case *Hash:
+		pairs := obj.OrderedPairs()
+		if len(pairs) == 0 {
+			out.WriteString(flat)
+			return
+		}
+		out.WriteString("{\n")
+		for i, pair := range pairs {
+			key := pair.Key.Inspect() + ": "
+			out.WriteString(inner + key)
+			writePretty(out, pair.Value, opts, inner, len(key))
+			writeSeparator(out, i, len(pairs))
+		}
+		out.WriteString(indent + "}")
+
+	default:
+		out.WriteString(flat)
+	}
+}
+
+/*
+要素の区切りを書く。最後の要素の後にはカンマを付けない
+*/
+func writeSeparator(out *strings.Builder, i, length int) {
+	if i < length-1 {
+		out.WriteString(",")
+	}
+	out.WriteString("\n")
+}
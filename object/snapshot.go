@@ -0,0 +1,478 @@
+package object
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"monkey/ast"
+)
+
+/*
+環境のスナップショットの形式。環境と、複数の場所から参照されうるオブジェクト(配列、ハッシュ、
+集合、関数、クラス、インスタンス)はそれぞれ一覧に並べて番号で参照する。
+これにより共有や循環参照(自分自身を呼び出す関数など)も復元できる
+*/
+type snapshot struct {
+	Root         int              `json:"root"`
+	Environments []snapshotEnv    `json:"environments"`
+	Objects      []snapshotObject `json:"objects"`
+}
+
+type snapshotEnv struct {
+	Outer    int               `json:"outer"` // 外側の環境の番号。ない場合は-1
+	Bindings []snapshotBinding `json:"bindings"`
+}
+
+type snapshotBinding struct {
+	Name     string        `json:"name"`
+	Value    snapshotValue `json:"value"`
+	Constant bool          `json:"constant,omitempty"`
+}
+
+/*
+値。整数や文字列などは Value に文字列として書き、共有されうるオブジェクトは Ref で参照する
+*/
+type snapshotValue struct {
+	Type  ObjectType `json:"type"`
+	Value string     `json:"value,omitempty"`
+	Ref   *int       `json:"ref,omitempty"`
+}
+
+type snapshotObject struct {
+	Type        ObjectType                 `json:"type"`
+	Elements    []snapshotValue            `json:"elements,omitempty"`    // 配列、集合
+	Pairs       [][2]snapshotValue         `json:"pairs,omitempty"`       // ハッシュ
+	Function    json.RawMessage            `json:"function,omitempty"`    // 関数の構文木
+	Env         int                        `json:"env,omitempty"`         // 関数、クラスの環境
+	Name        string                     `json:"name,omitempty"`        // クラス
+	Constructor *snapshotValue             `json:"constructor,omitempty"` // クラス
+	Methods     map[string]json.RawMessage `json:"methods,omitempty"`     // クラス
+	Class       *snapshotValue             `json:"class,omitempty"`       // インスタンス
+	Fields      map[string]snapshotValue   `json:"fields,omitempty"`      // インスタンス
+}
+
+/*
+環境とその外側の環境、束縛された値、関数が閉じ込めた環境を丸ごとJSONに書き出す。
+組み込み関数やジェネレーター、チャネルのように書き出せない値がある場合はエラーを返す
+*/
+func (e *Environment) Snapshot() ([]byte, error) {
+	w := &snapshotWriter{
+		envIDs:    map[*Environment]int{},
+		objectIDs: map[Object]int{},
+	}
+	root, err := w.env(e)
+	if err != nil {
+		return nil, err
+	}
+	w.snapshot.Root = root
+
+	return json.Marshal(w.snapshot)
+}
+
+type snapshotWriter struct {
+	snapshot  snapshot
+	envIDs    map[*Environment]int
+	objectIDs map[Object]int
+}
+
+func (w *snapshotWriter) env(e *Environment) (int, error) {
+	if id, ok := w.envIDs[e]; ok {
+		return id, nil
+	}
+	id := len(w.snapshot.Environments)
+	w.envIDs[e] = id
+	w.snapshot.Environments = append(w.snapshot.Environments, snapshotEnv{Outer: -1})
+
+	env := snapshotEnv{Outer: -1, Bindings: []snapshotBinding{}}
+	if e.outer != nil {
+		outer, err := w.env(e.outer)
+		if err != nil {
+			return 0, err
+		}
+		env.Outer = outer
+	}
+	for _, name := range e.Names() {
+		val, _ := e.Get(name)
+		v, err := w.value(val)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", name, err)
+		}
+		env.Bindings = append(env.Bindings, snapshotBinding{Name: name, Value: v, Constant: e.IsConstant(name)})
+	}
+	w.snapshot.Environments[id] = env
+
+	return id, nil
+}
+
+func (w *snapshotWriter) value(obj Object) (snapshotValue, error) {
+	v := snapshotValue{Type: obj.Type()}
+
+	switch obj := obj.(type) {
+	case *Integer, *BigInteger, *Boolean:
+		v.Value = obj.Inspect()
+	case *String:
+		v.Value = obj.Value
+	case *Null:
+	case *Error:
+		v.Value = obj.Message
+	case *Range:
+		v.Value = obj.Inspect()
+	case *Bytes:
+		v.Value = base64.StdEncoding.EncodeToString(obj.Value)
+	case *Array, *Hash, *Set, *Function, *Class, *Instance:
+		id, err := w.object(obj)
+		if err != nil {
+			return v, err
+		}
+		v.Ref = &id
+	default:
+		return v, fmt.Errorf("cannot snapshot %s", obj.Type())
+	}
+
+	return v, nil
+}
+
+func (w *snapshotWriter) values(objs []Object) ([]snapshotValue, error) {
+	values := make([]snapshotValue, len(objs))
+	for i, obj := range objs {
+		v, err := w.value(obj)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (w *snapshotWriter) object(obj Object) (int, error) {
+	if id, ok := w.objectIDs[obj]; ok {
+		return id, nil
+	}
+	// 中身を書く前に番号を決めておき、循環参照が同じ番号を参照するようにする
+	id := len(w.snapshot.Objects)
+	w.objectIDs[obj] = id
+	w.snapshot.Objects = append(w.snapshot.Objects, snapshotObject{})
+
+	o := snapshotObject{Type: obj.Type()}
+	var err error
+
+	switch obj := obj.(type) {
+	case *Array:
+		o.Elements, err = w.values(obj.Elements)
+	case *Set:
+		o.Elements, err = w.values(obj.OrderedElements())
+	case *Hash:
+		for _, pair := range obj.OrderedPairs() {
+			var kv [2]snapshotValue
+			if kv[0], err = w.value(pair.Key); err != nil {
+				break
+			}
+			if kv[1], err = w.value(pair.Value); err != nil {
+				break
+			}
+			o.Pairs = append(o.Pairs, kv)
+		}
+	case *Function:
+		o.Function, err = ast.MarshalNode(&ast.FunctionLiteral{
+			Parameters: obj.Parameters,
+			Variadic:   obj.Variadic,
+			Defaults:   obj.Defaults,
+			Body:       obj.Body,
+			Generator:  obj.Generator,
+		})
+		if err == nil {
+			o.Env, err = w.env(obj.Env)
+		}
+	case *Class:
+		o.Name = obj.Name
+		o.Methods = map[string]json.RawMessage{}
+		for name, method := range obj.Methods {
+			if o.Methods[name], err = ast.MarshalNode(method); err != nil {
+				break
+			}
+		}
+		if err == nil && obj.Constructor != nil {
+			var constructor snapshotValue
+			constructor, err = w.value(obj.Constructor)
+			o.Constructor = &constructor
+		}
+		if err == nil {
+			o.Env, err = w.env(obj.Env)
+		}
+	case *Instance:
+		var class snapshotValue
+		class, err = w.value(obj.Class)
+		o.Class = &class
+		o.Fields = map[string]snapshotValue{}
+		for name, field := range obj.Fields {
+			if err != nil {
+				break
+			}
+			o.Fields[name], err = w.value(field)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	w.snapshot.Objects[id] = o
+	return id, nil
+}
+
+/*
+Snapshot で書き出したJSONから環境を復元する
+*/
+func RestoreEnvironment(data []byte) (*Environment, error) {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+	if s.Root < 0 || s.Root >= len(s.Environments) {
+		return nil, fmt.Errorf("invalid snapshot: root environment %d not found", s.Root)
+	}
+
+	r := &snapshotReader{snapshot: s}
+
+	// 参照を解決できるように、先に全ての環境とオブジェクトを生成しておく
+	r.envs = make([]*Environment, len(s.Environments))
+	for i := range s.Environments {
+		r.envs[i] = NewEnvironment()
+	}
+	r.objects = make([]Object, len(s.Objects))
+	for i, o := range s.Objects {
+		switch o.Type {
+		case ARRAY_OBJ:
+			r.objects[i] = &Array{}
+		case HASH_OBJ:
+			r.objects[i] = &Hash{Pairs: map[HashKey]HashPair{}}
+		case SET_OBJ:
+			r.objects[i] = &Set{Elements: map[HashKey]Object{}}
+		case FUNCTION_OBJ:
+			r.objects[i] = &Function{}
+		case CLASS_OBJ:
+			r.objects[i] = &Class{}
+		case INSTANCE_OBJ:
+			r.objects[i] = &Instance{}
+		default:
+			return nil, fmt.Errorf("invalid snapshot: unknown object type %s", o.Type)
+		}
+	}
+
+	for i, env := range s.Environments {
+		if env.Outer >= 0 {
+			outer, err := r.env(env.Outer)
+			if err != nil {
+				return nil, err
+			}
+			r.envs[i].outer = outer
+		}
+		for _, b := range env.Bindings {
+			val, err := r.value(b.Value)
+			if err != nil {
+				return nil, err
+			}
+			if b.Constant {
+				r.envs[i].SetConstant(b.Name, val)
+			} else {
+				r.envs[i].Set(b.Name, val)
+			}
+		}
+	}
+	for i, o := range s.Objects {
+		if err := r.fill(r.objects[i], o); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.envs[s.Root], nil
+}
+
+type snapshotReader struct {
+	snapshot snapshot
+	envs     []*Environment
+	objects  []Object
+}
+
+func (r *snapshotReader) env(id int) (*Environment, error) {
+	if id < 0 || id >= len(r.envs) {
+		return nil, fmt.Errorf("invalid snapshot: environment %d not found", id)
+	}
+	return r.envs[id], nil
+}
+
+func (r *snapshotReader) value(v snapshotValue) (Object, error) {
+	if v.Ref != nil {
+		if *v.Ref < 0 || *v.Ref >= len(r.objects) {
+			return nil, fmt.Errorf("invalid snapshot: object %d not found", *v.Ref)
+		}
+		return r.objects[*v.Ref], nil
+	}
+
+	switch v.Type {
+	case INTEGER_OBJ, BIG_INTEGER_OBJ:
+		n, ok := new(big.Int).SetString(v.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid snapshot: bad integer %q", v.Value)
+		}
+		return newInteger(n), nil
+	case STRING_OBJ:
+		return &String{Value: v.Value}, nil
+	case BOOLEAN_OBJ:
+		if v.Value == "true" {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case NULL_OBJ:
+		return NULL, nil
+	case ERROR_OBJ:
+		return &Error{Message: v.Value}, nil
+	case RANGE_OBJ:
+		r := &Range{}
+		if _, err := fmt.Sscanf(v.Value, "%d..%d", &r.Start, &r.End); err != nil {
+			return nil, fmt.Errorf("invalid snapshot: bad range %q", v.Value)
+		}
+		return r, nil
+	case BYTES_OBJ:
+		b, err := base64.StdEncoding.DecodeString(v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %s", err)
+		}
+		return &Bytes{Value: b}, nil
+	}
+
+	return nil, fmt.Errorf("invalid snapshot: unknown value type %s", v.Type)
+}
+
+func (r *snapshotReader) values(vs []snapshotValue) ([]Object, error) {
+	objs := make([]Object, len(vs))
+	for i, v := range vs {
+		obj, err := r.value(v)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+	return objs, nil
+}
+
+func (r *snapshotReader) hashable(v snapshotValue) (Object, HashKey, error) {
+	obj, err := r.value(v)
+	if err != nil {
+		return nil, HashKey{}, err
+	}
+	key, ok := obj.(Hashable)
+	if !ok {
+		return nil, HashKey{}, fmt.Errorf("invalid snapshot: unusable as hash key: %s", obj.Type())
+	}
+	return obj, key.HashKey(), nil
+}
+
+func (r *snapshotReader) fill(obj Object, o snapshotObject) error {
+	switch obj := obj.(type) {
+	case *Array:
+		elements, err := r.values(o.Elements)
+		if err != nil {
+			return err
+		}
+		obj.Elements = elements
+
+	case *Set:
+		for _, v := range o.Elements {
+			el, key, err := r.hashable(v)
+			if err != nil {
+				return err
+			}
+			obj.Elements[key] = el
+		}
+
+	case *Hash:
+		for _, kv := range o.Pairs {
+			key, hashed, err := r.hashable(kv[0])
+			if err != nil {
+				return err
+			}
+			value, err := r.value(kv[1])
+			if err != nil {
+				return err
+			}
+			obj.Set(hashed, HashPair{Key: key, Value: value})
+		}
+
+	case *Function:
+		fl, err := functionLiteral(o.Function)
+		if err != nil {
+			return err
+		}
+		if obj.Env, err = r.env(o.Env); err != nil {
+			return err
+		}
+		obj.Parameters = fl.Parameters
+		obj.Variadic = fl.Variadic
+		obj.Defaults = fl.Defaults
+		obj.Body = fl.Body
+		obj.Generator = fl.Generator
+
+	case *Class:
+		obj.Name = o.Name
+		obj.Methods = map[string]*ast.FunctionLiteral{}
+		for name, data := range o.Methods {
+			fl, err := functionLiteral(data)
+			if err != nil {
+				return err
+			}
+			obj.Methods[name] = fl
+		}
+		if o.Constructor != nil {
+			constructor, err := r.value(*o.Constructor)
+			if err != nil {
+				return err
+			}
+			fn, ok := constructor.(*Function)
+			if !ok {
+				return fmt.Errorf("invalid snapshot: constructor of %s is %s", o.Name, constructor.Type())
+			}
+			obj.Constructor = fn
+		}
+		env, err := r.env(o.Env)
+		if err != nil {
+			return err
+		}
+		obj.Env = env
+
+	case *Instance:
+		if o.Class == nil {
+			return fmt.Errorf("invalid snapshot: instance without class")
+		}
+		class, err := r.value(*o.Class)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if obj.Class, ok = class.(*Class); !ok {
+			return fmt.Errorf("invalid snapshot: class of instance is %s", class.Type())
+		}
+		obj.Fields = make(map[string]Object, len(o.Fields))
+		for name, v := range o.Fields {
+			field, err := r.value(v)
+			if err != nil {
+				return err
+			}
+			obj.Fields[name] = field
+		}
+	}
+
+	return nil
+}
+
+func functionLiteral(data json.RawMessage) (*ast.FunctionLiteral, error) {
+	node, err := ast.UnmarshalNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+	fl, ok := node.(*ast.FunctionLiteral)
+	if !ok {
+		return nil, fmt.Errorf("invalid snapshot: expected function literal")
+	}
+	return fl, nil
+}
@@ -0,0 +1,264 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+/*
+構文木を最適化する。リテラルだけからなる算術・比較・論理演算や文字列の連結を畳み込み、
+条件が定数のifから実行されない分岐を取り除く。構文木はその場で書き換え、書き換えた構文木を返す。
+畳み込みは評価器で実際に評価して行うので、評価の結果は最適化の前後で変わらない
+*/
+func Optimize(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = statements(node.Statements)
+		return node
+	case ast.Statement:
+		return statement(node)
+	case ast.Expression:
+		return expression(node)
+	}
+	return node
+}
+
+/*
+文の並びを最適化する。値を使わない位置にある条件が定数のifは、実行される分岐の文で置き換える
+*/
+func statements(stmts []ast.Statement) []ast.Statement {
+	optimized := make([]ast.Statement, 0, len(stmts))
+	for i, stmt := range stmts {
+		stmt = statement(stmt)
+
+		// 最後の文はブロックの値になるので展開しない
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 {
+			if ie, ok := es.Expression.(*ast.IfExpression); ok && ie.Alternative == nil && isConstant(ie.Condition) {
+				optimized = append(optimized, ie.Consequence.Statements...)
+				continue
+			}
+			if isConstant(es.Expression) {
+				continue
+			}
+		}
+		optimized = append(optimized, stmt)
+	}
+	return optimized
+}
+
+func statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = expression(stmt.Value)
+	case *ast.ConstStatement:
+		stmt.Value = expression(stmt.Value)
+	case *ast.FunctionStatement:
+		function(stmt.Function)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		stmt.Expression = expression(stmt.Expression)
+	case *ast.BlockStatement:
+		block(stmt)
+	case *ast.ClassStatement:
+		if stmt.Constructor != nil {
+			function(stmt.Constructor)
+		}
+		for _, method := range stmt.Methods {
+			function(method.Function)
+		}
+	}
+	return stmt
+}
+
+func block(b *ast.BlockStatement) {
+	if b != nil {
+		b.Statements = statements(b.Statements)
+	}
+}
+
+func function(fn *ast.FunctionLiteral) {
+	for name, def := range fn.Defaults {
+		fn.Defaults[name] = expression(def)
+	}
+	block(fn.Body)
+}
+
+func expressions(exprs []ast.Expression) {
+	for i, expr := range exprs {
+		exprs[i] = expression(expr)
+	}
+}
+
+/*
+式の子を最適化してから、式そのものを畳み込む
+*/
+func expression(expr ast.Expression) ast.Expression {
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		expr.Right = expression(expr.Right)
+		if isConstant(expr.Right) {
+			return fold(expr)
+		}
+
+	case *ast.InfixExpression:
+		expr.Left = expression(expr.Left)
+		expr.Right = expression(expr.Right)
+		if isConstant(expr.Left) && isConstant(expr.Right) {
+			return fold(expr)
+		}
+
+	case *ast.IfExpression:
+		expr.Condition = expression(expr.Condition)
+		block(expr.Consequence)
+		block(expr.Alternative)
+		return branch(expr)
+
+	case *ast.FunctionLiteral:
+		function(expr)
+
+	case *ast.ArrayLiteral:
+		expressions(expr.Elements)
+
+	case *ast.HashLiteral:
+		// キーを書き換えるとハッシュのキーとして使っているノードが変わるので、作り直す
+		pairs := make(map[ast.Expression]ast.Expression, len(expr.Pairs))
+		keys := make([]ast.Expression, 0, len(expr.Pairs))
+		for _, key := range expr.OrderedKeys() {
+			value := expression(expr.Pairs[key])
+			key = expression(key)
+			pairs[key] = value
+			keys = append(keys, key)
+		}
+		expr.Pairs, expr.Keys = pairs, keys
+
+	case *ast.CallExpression:
+		expr.Function = expression(expr.Function)
+		expressions(expr.Arguments)
+		for _, arg := range expr.NamedArguments {
+			arg.Value = expression(arg.Value)
+		}
+
+	case *ast.IndexExpression:
+		expr.Left = expression(expr.Left)
+		expr.Index = expression(expr.Index)
+
+	case *ast.SliceExpression:
+		expr.Left = expression(expr.Left)
+		expr.Start = expression(expr.Start)
+		expr.End = expression(expr.End)
+
+	case *ast.MemberExpression:
+		expr.Object = expression(expr.Object)
+
+	case *ast.MatchExpression:
+		expr.Subject = expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			block(arm.Body)
+		}
+
+	case *ast.SpreadExpression:
+		expr.Value = expression(expr.Value)
+
+	case *ast.YieldExpression:
+		expr.Value = expression(expr.Value)
+
+	case *ast.SpawnExpression:
+		expr.Call = expression(expr.Call)
+	}
+	return expr
+}
+
+/*
+条件が定数のifから実行されない分岐を取り除く。どちらの分岐も実行されない場合はnullにする
+*/
+func branch(ie *ast.IfExpression) ast.Expression {
+	if !isConstant(ie.Condition) {
+		return ie
+	}
+
+	taken := ie.Alternative
+	if isTruthy(ie.Condition) {
+		taken = ie.Consequence
+	}
+	if taken == nil {
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: ie.Pos()}}
+	}
+
+	ie.Condition = &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: ie.Condition.Pos()}, Value: true}
+	ie.Consequence = taken
+	ie.Alternative = nil
+	return ie
+}
+
+/*
+畳み込むときの評価の設定。大きな値を作る式は実行されない分岐にあってもメモリを使い切りかねないので、
+小さな上限を超える式は畳み込まずに実行時に任せる。
+オーバーフローする整数演算も、実行時の Config の扱いに任せるためエラーにして畳み込まない
+*/
+var foldConfig = object.Config{
+	MaxSteps:      1000,
+	MaxAllocation: 4096,
+	Overflow:      object.OverflowRaise,
+}
+
+/*
+リテラルだけからなる式を評価して、結果をリテラルに置き換える。
+評価がエラーになる場合や、結果をリテラルで表せない場合は元の式を返す
+*/
+func fold(expr ast.Expression) (folded ast.Expression) {
+	// 評価器がパニックした場合も実行時に任せる
+	defer func() {
+		if recover() != nil {
+			folded = expr
+		}
+	}()
+
+	env := object.NewEnvironment()
+	env.SetConfig(foldConfig)
+
+	pos := expr.Pos()
+	switch result := evaluator.Eval(expr, env).(type) {
+	case *object.Integer:
+		literal := strconv.FormatInt(result.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: pos}, Value: result.Value}
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: result.Value, Pos: pos}, Value: result.Value}
+	case *object.Boolean:
+		tok := token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		if result.Value {
+			tok = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		}
+		return &ast.Boolean{Token: tok, Value: result.Value}
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: pos}}
+	}
+	return expr
+}
+
+/*
+値が定まっていて副作用のないリテラルかどうか判定
+*/
+func isConstant(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		return true
+	}
+	return false
+}
+
+/*
+定数の真偽を評価器と同じ規則で判定する。nullとfalse以外は真
+*/
+func isTruthy(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.Boolean:
+		return expr.Value
+	case *ast.NullLiteral:
+		return false
+	}
+	return true
+}
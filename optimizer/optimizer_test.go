@@ -0,0 +1,71 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"-(2 - 5)", "3"},
+		{"x + 2 * 3", "(x + 6)"},
+		{"!(1 < 2) == false", "true"},
+		{"1 == 1 != x", "(true != x)"},
+		{`"foo" + "bar" + x`, "(foobar + x)"},
+		{"if (1 > 2) { a } else { b }", "iftrue b"},
+		{"if (false) { a }", "null"},
+		{"let f = fn(n = 2 * 2) { if (true) { puts(n); } n };", "let f = fn(n = 4) puts(n)n;"},
+		{"if (x) { 1 + 1 } else { 2 + 2 }", "ifx 2else 4"},
+		// エラーになる式は実行時に任せる
+		{"1 / 0", "(1 / 0)"},
+		{`"a" - "b"`, "(a - b)"},
+		// 大きな値を作る式は、実行されない分岐にあっても畳み込まない
+		{`if (false) { puts("a" * 30000000000) }`, "null"},
+		{`"a" * 3000000000`, "(a * 3000000000)"},
+		{"[0] * 1000000", "([0] * 1000000)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		optimized := Optimize(program)
+		if optimized.String() != tt.expected {
+			t.Errorf("Optimize(%q) wrong. want=%q, got=%q", tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+func TestOptimizePreservesResult(t *testing.T) {
+	tests := []string{
+		"let x = 10; if (true) { let y = x * 2; } y + 1",
+		"let f = fn() { if (1 == 1) { return 5; } 10 }; f()",
+		`let s = "a" + "b" + "c"; s + "d"`,
+		"if (false) { 1 }",
+		"let a = [1 + 1, 2 * 3]; a[1 - 1] + a[0 + 1]",
+		"9223372036854775807 + 1",
+	}
+
+	for _, input := range tests {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		got := evaluator.Eval(Optimize(parse(t, input)), object.NewEnvironment())
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("result of %q changed. want=%s, got=%s", input, want.Inspect(), got.Inspect())
+		}
+	}
+}
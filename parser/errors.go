@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"monkey/token"
+)
+
+/*
+構文解析エラー
+*/
+type ParseError struct {
+	Position token.Position  // エラーになったトークンの位置
+	Expected token.TokenType // 期待していたトークンの種類。特定のトークンを期待していなかった場合は空
+	Got      token.TokenType // 実際に現れたトークンの種類
+	Message  string          // 位置を含まないエラーメッセージ
+}
+
+/*
+位置が分かる場合は line:column を先頭に付けたメッセージを返す
+*/
+func (e ParseError) Error() string {
+	if e.Position.IsValid() {
+		return e.Position.String() + ": " + e.Message
+	}
+	return e.Message
+}
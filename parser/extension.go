@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+拡張用の前置構文解析関数。カレントトークンが登録したトークンの状態で呼ばれ、
+式の最後のトークンをカレントトークンにして返す
+*/
+type PrefixParseFn func(p *Parser) ast.Expression
+
+/*
+拡張用の中置構文解析関数。カレントトークンが登録したトークン、left が左辺の状態で呼ばれる
+*/
+type InfixParseFn func(p *Parser, left ast.Expression) ast.Expression
+
+/*
+literal を種類 t のトークンとして読むオプション。literal には識別子か記号を指定する。
+記号は隣り合った複数のトークンをつなげたものでもよく、最も長く一致するものを使う
+*/
+func WithToken(literal string, t token.TokenType) Option {
+	return func(p *Parser) {
+		if p.tokens == nil {
+			p.tokens = make(map[string]token.TokenType)
+		}
+		p.tokens[literal] = t
+	}
+}
+
+/*
+種類 t のトークンで始まる式の構文解析関数を登録するオプション
+*/
+func WithPrefixOperator(t token.TokenType, fn PrefixParseFn) Option {
+	return func(p *Parser) {
+		p.registerPrefix(t, func() ast.Expression { return fn(p) })
+	}
+}
+
+/*
+種類 t のトークンを優先順位 precedence の中置演算子として登録するオプション
+*/
+func WithInfixOperator(t token.TokenType, precedence int, fn InfixParseFn) Option {
+	return func(p *Parser) {
+		// パッケージの優先順位表は他の構文解析器と共有しているので複製する
+		table := make(map[token.TokenType]int, len(p.precedences)+1)
+		for k, v := range p.precedences {
+			table[k] = v
+		}
+		table[t] = precedence
+		p.precedences = table
+
+		p.registerInfix(t, func(left ast.Expression) ast.Expression { return fn(p, left) })
+	}
+}
+
+/*
+カレントトークンを取得
+*/
+func (p *Parser) CurToken() token.Token {
+	return p.curToken
+}
+
+/*
+次のトークンを取得
+*/
+func (p *Parser) PeekToken() token.Token {
+	return p.peekToken
+}
+
+/*
+トークンを一つ進める
+*/
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+/*
+次のトークンが t であればトークンを進めてtrueを返す。そうでなければエラーを記録してfalseを返す
+*/
+func (p *Parser) ExpectPeek(t token.TokenType) bool {
+	return p.expectPeek(t)
+}
+
+/*
+カレントトークンから優先順位 precedence の式を解析
+*/
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
+
+/*
+カレントトークンの '{' からブロックを解析
+*/
+func (p *Parser) ParseBlockStatement() *ast.BlockStatement {
+	return p.parseBlockStatement()
+}
+
+/*
+カレントトークンの位置で起きたエラーを記録
+*/
+func (p *Parser) AddError(msg string) {
+	p.addError(p.curToken, msg)
+}
+
+/*
+次のトークンを読み込む。WithToken で登録された綴りは、登録された種類のトークンにする
+*/
+func (p *Parser) readToken() token.Token {
+	tok := p.lexToken()
+	if len(p.tokens) == 0 {
+		return tok
+	}
+
+	if tok.Type == token.IDENT {
+		if t, ok := p.tokens[tok.Literal]; ok {
+			tok.Type = t
+		}
+		return tok
+	}
+	if !isSymbol(tok) {
+		return tok
+	}
+
+	// 隣り合う記号のトークンをつなげて、登録された綴りのうち最も長く一致するものを探す
+	run := []token.Token{tok}
+	literal := tok.Literal
+	matched, matchedType := 0, tok.Type
+	if t, ok := p.tokens[literal]; ok {
+		matched, matchedType = 1, t
+	}
+	for p.isTokenPrefix(literal) {
+		next := p.lexToken()
+		run = append(run, next)
+		if !isSymbol(next) || !adjacent(run[len(run)-2], next) {
+			break
+		}
+		literal += next.Literal
+		if t, ok := p.tokens[literal]; ok {
+			matched, matchedType = len(run), t
+		}
+	}
+
+	if matched == 0 {
+		p.pending = append(run[1:], p.pending...)
+		return tok
+	}
+	p.pending = append(run[matched:], p.pending...)
+
+	combined := tok
+	combined.Type = matchedType
+	combined.Literal = ""
+	for _, t := range run[:matched] {
+		combined.Literal += t.Literal
+	}
+	return combined
+}
+
+/*
+先読みして戻したトークンがあればそれを、なければ字句解析器から次のトークンを読み込む
+*/
+func (p *Parser) lexToken() token.Token {
+	if len(p.pending) > 0 {
+		tok := p.pending[0]
+		p.pending = p.pending[1:]
+		return tok
+	}
+	return p.l.NextToken()
+}
+
+/*
+literal より長い登録済みの綴りが literal で始まるかどうか判定
+*/
+func (p *Parser) isTokenPrefix(literal string) bool {
+	for registered := range p.tokens {
+		if len(registered) > len(literal) && strings.HasPrefix(registered, literal) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+記号のトークンかどうか判定。in や typeof のような語の演算子は含まない
+*/
+func isSymbol(tok token.Token) bool {
+	switch tok.Type.Class() {
+	case token.ClassOperator, token.ClassDelimiter, token.ClassIllegal:
+		r, _ := utf8.DecodeRuneInString(tok.Literal)
+		return tok.Literal != "" && !unicode.IsLetter(r)
+	}
+	return false
+}
+
+/*
+b が a の直後に空白を挟まずに続いているかどうか判定
+*/
+func adjacent(a, b token.Token) bool {
+	return !b.NewlineBefore && a.Pos.Line == b.Pos.Line &&
+		b.Pos.Column == a.Pos.Column+utf8.RuneCountInString(a.Literal)
+}
@@ -2,10 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
@@ -13,10 +15,57 @@ type Parser struct {
 
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    []ParseError
+	recovered int // 読み飛ばしによって回復済みのエラーの数
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	newlineTerminates bool // 改行で文を終端するかどうか
+	nesting           int  // 現在の丸カッコ・角カッコ・ハッシュリテラルの入れ子の深さ
+
+	functionDepth int  // 現在の関数本体の入れ子の深さ
+	yieldSeen     bool // 解析中の関数本体に yield が現れたかどうか
+
+	depth    int  // 現在の式とブロックの再帰の深さ
+	maxDepth int  // depth の上限
+	aborted  bool // 上限を超えて解析を打ち切ったかどうか
+
+	precedences map[token.TokenType]int    // 演算子の優先順位。演算子を追加する場合は複製してから変更する
+	tokens      map[string]token.TokenType // WithToken で登録された綴りとトークンの種類
+	pending     []token.Token              // 綴りの照合のために先読みして戻したトークン
+
+	tracer     io.Writer // 構文解析関数の呼び出しの書き出し先。nil の場合はトレースしない
+	traceLevel int       // トレースの字下げの深さ
+}
+
+/*
+構文解析器のオプション
+*/
+type Option func(*Parser)
+
+/*
+改行で文を終端するオプション。セミコロンを省略でき、
+カッコの内側や、行頭が . で始まる場合は次の行に式が続くものとして扱う
+*/
+func WithNewlineTermination() Option {
+	return func(p *Parser) {
+		p.newlineTerminates = true
+	}
+}
+
+/*
+式とブロックの入れ子の深さの既定の上限
+*/
+const DefaultMaxDepth = 1000
+
+/*
+式とブロックの入れ子の深さの上限を設定するオプション。上限を超えた入力は構文エラーにする
+*/
+func WithMaxDepth(depth int) Option {
+	return func(p *Parser) {
+		p.maxDepth = depth
+	}
 }
 
 type (
@@ -27,44 +76,57 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	COALESCE    // ??
 	EQUALS      // ==
 	LESSGREATER // > または <
+	RANGE       // a..b
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X または !X
 	CALL        // myFunction(X)
 	INDEX       // array[index]
+	MEMBER      // hash.key
 )
 
 var precedences = map[token.TokenType]int{
+	token.COALESCE: COALESCE,
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.IN:       LESSGREATER,
+	token.RANGE:    RANGE,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      MEMBER,
 }
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+func New(l *lexer.Lexer, opts ...Option) *Parser {
+	p := &Parser{l: l, errors: []ParseError{}, maxDepth: DefaultMaxDepth, precedences: precedences}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TYPEOF, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -75,8 +137,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+
+	// 組み込みの演算子を登録した後に適用して、オプションで上書きできるようにする
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// 2つトークンを読み込む。curTokenとpeekTokenの両方がセットされる。
 	p.nextToken()
@@ -87,7 +158,7 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.readToken()
 }
 
 // プログラムを解析
@@ -96,8 +167,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
+		if stmt := p.parseStatementWithRecovery(); stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
 		p.nextToken()
@@ -106,13 +176,67 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+/*
+文を解析する。エラーが出た場合は文を捨て、次の文の手前まで読み飛ばして
+後続の文を続けて解析できるようにする
+*/
+func (p *Parser) parseStatementWithRecovery() ast.Statement {
+	errors := len(p.errors)
+	stmt := p.parseStatement()
+	if len(p.errors) == errors {
+		return stmt
+	}
+
+	// 内側のブロックで回復済みのエラーしかなければ読み飛ばさない
+	if len(p.errors) > p.recovered {
+		p.synchronize()
+		p.recovered = len(p.errors)
+	}
+	return nil
+}
+
+/*
+エラーの出た文の残りを読み飛ばす。curToken が文末の ';' になるか、
+peekToken が外側のブロックを閉じる '}' か次の行の文の先頭になった所で止まる
+*/
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.peekTokenIs(token.EOF) {
+		if depth == 0 {
+			if p.curTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekEndsStatement() {
+				return
+			}
+		}
+
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth > 0 {
+				depth--
+			}
+		}
+		p.nextToken()
+	}
+}
+
 // 文を解析
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
+	case token.CONST:
+		return p.parseConstStatement()
+	case token.CLASS:
+		return p.parseClassStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.FUNCTION:
+		// 文の先頭で fn の直後に名前が続く場合は関数宣言とみなす
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -124,6 +248,109 @@ let文を解析
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
+	if p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+		stmt.Pattern = p.parseArrayPattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parseHashPattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+/*
+配列の分割代入パターンを解析
+*/
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+	pattern.Elements = []*ast.Identifier{}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		// ...rest は最後の要素としてのみ指定できる
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		pattern.Elements = append(pattern.Elements, ident)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+/*
+ハッシュの分割代入パターンを解析
+*/
+func (p *Parser) parseHashPattern() ast.Expression {
+	pattern := &ast.HashPattern{Token: p.curToken}
+	pattern.Keys = []*ast.Identifier{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		pattern.Keys = append(pattern.Keys, ident)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+/*
+const文を解析
+*/
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.curToken}
+
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
@@ -145,15 +372,121 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+/*
+関数宣言文を解析
+*/
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	stmt.Name = lit.Name
+	stmt.Function = lit
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+/*
+class文を解析
+*/
+func (p *Parser) parseClassStatement() ast.Statement {
+	stmt := &ast.ClassStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	// コンストラクタのパラメータは省略できる
+	stmt.Constructor = &ast.FunctionLiteral{Token: p.curToken}
+	stmt.Constructor.Parameters = []*ast.Identifier{}
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		if !p.parseFunctionParameters(stmt.Constructor) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Constructor.Body = &ast.BlockStatement{Token: p.curToken}
+	stmt.Constructor.Body.Statements = []ast.Statement{}
+	stmt.Methods = []*ast.MethodDefinition{}
+
+	p.nextToken()
+	for !p.curTokenIs(token.RBRACE) {
+		switch p.curToken.Type {
+		case token.LET:
+			field := p.parseLetStatement()
+			if field == nil {
+				return nil
+			}
+			stmt.Constructor.Body.Statements = append(stmt.Constructor.Body.Statements, field)
+		case token.FUNCTION:
+			method := p.parseMethodDefinition()
+			if method == nil {
+				return nil
+			}
+			stmt.Methods = append(stmt.Methods, method)
+		case token.SEMICOLON:
+		default:
+			msg := fmt.Sprintf("unexpected %s in class body", p.curToken.Type)
+			p.addError(p.curToken, msg)
+			return nil
+		}
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+/*
+クラスのメソッド定義を解析
+*/
+func (p *Parser) parseMethodDefinition() *ast.MethodDefinition {
+	method := &ast.MethodDefinition{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	method.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	method.Function = &ast.FunctionLiteral{Token: method.Token}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.parseFunctionParameters(method.Function) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.parseFunctionBody(method.Function)
+
+	return method
+}
+
 /*
 return文を解析
 */
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
-	p.nextToken()
-
-	stmt.ReturnValue = p.parseExpression(LOWEST)
+	// 値のない return は NULL を返す
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) ||
+		p.peekTokenIs(token.EOF) || p.peekEndsStatement() {
+		stmt.ReturnValue = &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null"}}
+	} else {
+		p.nextToken()
+		stmt.ReturnValue = p.parseExpression(LOWEST)
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -164,7 +497,9 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 // 式文を解析
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	defer untrace(trace("parseExpressionStatement"))
+	if p.tracer != nil {
+		defer p.untrace(p.trace("parseExpressionStatement"))
+	}
 
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -180,12 +515,29 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // 前置構文解析関数エラー
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg)
+}
+
+/*
+不正なトークンをエラーとして記録
+*/
+func (p *Parser) parseIllegal() ast.Expression {
+	msg := fmt.Sprintf("illegal token: %s", p.curToken.Literal)
+	p.addError(p.curToken, msg)
+	return nil
 }
 
 // 式を解析
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	defer untrace(trace("parseExpression"))
+	if p.tracer != nil {
+		defer p.untrace(p.trace("parseExpression"))
+	}
+
+	leave, ok := p.enterDepth()
+	defer leave()
+	if !ok {
+		return nil
+	}
 
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
@@ -194,7 +546,8 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(token.SEMICOLON) && !p.peekEndsStatement() &&
+		precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -208,16 +561,64 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+/*
+改行終端モードで、次のトークンが新しい文の始まりかどうか判定
+*/
+func (p *Parser) peekEndsStatement() bool {
+	return p.newlineTerminates && p.nesting == 0 &&
+		p.peekToken.NewlineBefore && !p.peekTokenIs(token.DOT)
+}
+
+/*
+再帰を一段深くする。上限を超えた場合はエラーを記録して残りの入力を読み飛ばし、falseを返す。
+戻り値の関数を呼び出すと元の深さに戻る
+*/
+func (p *Parser) enterDepth() (func(), bool) {
+	p.depth++
+	leave := func() { p.depth-- }
+
+	if p.aborted {
+		return leave, false
+	}
+	if p.depth > p.maxDepth {
+		p.addError(p.curToken, fmt.Sprintf("maximum nesting depth of %d exceeded", p.maxDepth))
+		p.aborted = true
+		// 深い入れ子を抜ける間に続くエラーを出さないように、入力の最後まで進める
+		for !p.curTokenIs(token.EOF) {
+			p.nextToken()
+		}
+		return leave, false
+	}
+	return leave, true
+}
+
+/*
+カッコの内側に入る。戻り値の関数を呼び出すと外側に戻る
+*/
+func (p *Parser) enterNesting() func() {
+	p.nesting++
+	return func() { p.nesting-- }
+}
+
 // 整数リテラルを解析
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	defer untrace(trace("parseIntegerLiteral"))
+	if p.tracer != nil {
+		defer p.untrace(p.trace("parseIntegerLiteral"))
+	}
 
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	digits, ok := stripDigitSeparators(p.curToken.Literal)
+	if !ok {
+		msg := fmt.Sprintf("misplaced digit separator in %q", p.curToken.Literal)
+		p.addError(p.curToken, msg)
+		return nil
+	}
+
+	value, err := strconv.ParseInt(digits, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 
@@ -226,6 +627,23 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+/*
+数値リテラルから桁区切りのアンダースコアを取り除く。
+アンダースコアは数字の間にのみ置けるため、先頭・末尾・連続している場合はfalseを返す
+*/
+func stripDigitSeparators(literal string) (string, bool) {
+	if !strings.Contains(literal, "_") {
+		return literal, true
+	}
+
+	if strings.HasPrefix(literal, "_") || strings.HasSuffix(literal, "_") ||
+		strings.Contains(literal, "__") {
+		return "", false
+	}
+
+	return strings.ReplaceAll(literal, "_", ""), true
+}
+
 /*
 文字列リテラルを解析
 */
@@ -234,7 +652,9 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	defer untrace(trace("parsePrefixExpression"))
+	if p.tracer != nil {
+		defer p.untrace(p.trace("parsePrefixExpression"))
+	}
 
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -262,6 +682,8 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 ハッシュリテラルを解析
 */
 func (p *Parser) parseHashLiteral() ast.Expression {
+	defer p.enterNesting()()
+
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
@@ -276,6 +698,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -291,7 +714,9 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 // 中置式を解析
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	defer untrace(trace("parseInfixExpression"))
+	if p.tracer != nil {
+		defer p.untrace(p.trace("parseInfixExpression"))
+	}
 
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
@@ -311,8 +736,17 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+/*
+nullリテラルを解析
+*/
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 // グループ化された式を解析
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	defer p.enterNesting()()
+
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -333,7 +767,9 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	p.nextToken()
+	leave := p.enterNesting()
 	expression.Condition = p.parseExpression(LOWEST)
+	leave()
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
@@ -358,6 +794,68 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+/*
+match式を解析
+*/
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	leave := p.enterNesting()
+	expression.Subject = p.parseExpression(LOWEST)
+	leave()
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Arms = []*ast.MatchArm{}
+	for p.peekTokenIs(token.CASE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+/*
+match式の分岐を解析
+*/
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.curToken}
+
+	p.nextToken()
+	arm.Pattern = p.parseExpression(LOWEST)
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	arm.Body = p.parseBlockStatement()
+
+	return arm
+}
+
 /*
 呼び出し式を解析
 */
@@ -365,20 +863,121 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	// 呼び出し式ノードを生成
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	// 引数を解析＆解析結果を呼び出し式ノードの引数リストにセット
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if !p.parseCallArguments(exp) {
+		return nil
+	}
 	// 生成した呼び出し式ノードを返す
 	return exp
 }
 
+/*
+呼び出し式の引数を解析。...expr はスプレッド式、name: expr は名前付き引数として解析する。
+名前付き引数の後に位置引数は置けない
+*/
+func (p *Parser) parseCallArguments(exp *ast.CallExpression) bool {
+	defer p.enterNesting()()
+
+	exp.Arguments = []ast.Expression{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return true
+	}
+
+	p.nextToken()
+	if !p.parseCallArgument(exp) {
+		return false
+	}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		if !p.parseCallArgument(exp) {
+			return false
+		}
+	}
+
+	return p.expectPeek(token.RPAREN)
+}
+
+/*
+呼び出し式の引数を一つ解析
+*/
+func (p *Parser) parseCallArgument(exp *ast.CallExpression) bool {
+	// 名前付き引数
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+		arg := &ast.NamedArgument{Token: p.curToken}
+		arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		exp.NamedArguments = append(exp.NamedArguments, arg)
+		return true
+	}
+
+	if len(exp.NamedArguments) > 0 {
+		p.addError(p.curToken, "positional argument after named argument")
+		return false
+	}
+
+	// スプレッド式
+	if p.curTokenIs(token.ELLIPSIS) {
+		spread := &ast.SpreadExpression{Token: p.curToken}
+		p.nextToken()
+		spread.Value = p.parseExpression(LOWEST)
+		exp.Arguments = append(exp.Arguments, spread)
+		return true
+	}
+
+	exp.Arguments = append(exp.Arguments, p.parseExpression(LOWEST))
+	return true
+}
+
 /*
 添字式を解析
 */
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	defer p.enterNesting()()
+
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
 	p.nextToken()
+
+	// [:end] の形式のスライス
+	if p.curTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	exp.Index = p.parseExpression(LOWEST)
 
+	// [start:end] の形式のスライス
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+/*
+スライス式のコロン以降を解析。コロンがカレントトークンの状態で呼び出す
+*/
+func (p *Parser) parseSliceExpression(
+	tok token.Token,
+	left ast.Expression,
+	start ast.Expression,
+) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -386,18 +985,43 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+/*
+メンバー式を解析
+*/
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 /*
 ブロック文を解析
 */
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	// ブロックの中では再び改行で文を終端する
+	nesting := p.nesting
+	p.nesting = 0
+	defer func() { p.nesting = nesting }()
+
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	leave, ok := p.enterDepth()
+	defer leave()
+	if !ok {
+		return block
+	}
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
+		if stmt := p.parseStatementWithRecovery(); stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
@@ -413,13 +1037,21 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	// 関数リテラルノードを生成
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	// 名前付き関数リテラルの場合は名前を読み込む
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		lit.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	// 次のトークンが左丸カッコでなかったら何も返さない(構文解析エラー)
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	} // トークンを一つ進める。左丸カッコがカレントになる。
 
 	// パラメータを解析＆関数リテラルノードのパラメータリストにセット
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	// 次のトークンが左中カッコかどうかチェック。左中カッコでない場合、関数本体のブロック文が不正なので何も返さない(構文解析エラー)
 	if !p.expectPeek(token.LBRACE) {
@@ -427,34 +1059,89 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	} // トークンを一つ進める。左中カッコがカレントになる。
 
 	// 関数本体(ブロック文)を解析＆関数リテラルノードの本体にセット
-	lit.Body = p.parseBlockStatement()
+	p.parseFunctionBody(lit)
 
 	// 生成した関数リテラルノードを返す。これにはパラメータリストと本体が含まれている。
 	return lit
 }
 
 /*
-関数パラメータを解析
+関数本体を解析する。本体に yield が現れた場合はジェネレーター関数とする
+*/
+func (p *Parser) parseFunctionBody(lit *ast.FunctionLiteral) {
+	outerYieldSeen := p.yieldSeen
+	p.functionDepth++
+	p.yieldSeen = false
+
+	lit.Body = p.parseBlockStatement()
+	lit.Generator = p.yieldSeen
+
+	p.functionDepth--
+	p.yieldSeen = outerYieldSeen
+}
+
+/*
+yield式を解析
+*/
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.curToken}
+
+	if p.functionDepth == 0 {
+		p.addError(p.curToken, "yield outside function")
+		return nil
+	}
+	p.yieldSeen = true
+
+	// 値のない yield は NULL を生成する
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) ||
+		p.peekTokenIs(token.RPAREN) || p.peekTokenIs(token.EOF) || p.peekEndsStatement() {
+		return expression
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	return expression
+}
+
+/*
+spawn式を解析
+*/
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Call = p.parseExpression(PREFIX)
+	if expression.Call == nil {
+		return nil
+	}
+
+	return expression
+}
+
+/*
+関数パラメータを解析し、関数リテラルノードにセットする
 */
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	defer p.enterNesting()()
+
 	// パラメータリストを定義
-	identifiers := []*ast.Identifier{}
+	lit.Parameters = []*ast.Identifier{}
 
-	// 次のトークンが右丸カッコかどうかチェック。右丸カッコでない場合、パラメータ無しとわかる。
+	// 次のトークンが右丸カッコかどうかチェック。右丸カッコの場合、パラメータ無しとわかる。
 	if p.peekTokenIs(token.RPAREN) {
 		// トークンを一つ進める。右丸カッコがカレントになる。
 		p.nextToken()
-		// 空のパラメータリストを返す
-		return identifiers
+		return true
 	}
 
 	// トークンを一つ進める。一つ目のパラメータがカレントになる。
 	p.nextToken()
 
-	// 一つ目のパラメータのノード(識別子)を生成
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	// 一つ目のパラメータをパラメータリストに追加
-	identifiers = append(identifiers, ident)
+	// 一つ目のパラメータを解析してパラメータリストに追加
+	if !p.parseFunctionParameter(lit) {
+		return false
+	}
 
 	// 次のトークンがカンマである間ループさせる
 	for p.peekTokenIs(token.COMMA) {
@@ -462,19 +1149,57 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		p.nextToken()
 		// トークンを一つ進める。次のパラメータがカレントになる。
 		p.nextToken()
-		// 次のパラメータのノード(識別子)を生成
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		// 次のパラメータをパラメータリストに追加
-		identifiers = append(identifiers, ident)
+		// 次のパラメータを解析してパラメータリストに追加
+		if !p.parseFunctionParameter(lit) {
+			return false
+		}
 	}
 
-	// 全てのパラメータを解析した後、次のトークンが右丸カッコでなかったら何も返さない(構文解析エラー)
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+	// 全てのパラメータを解析した後、次のトークンが右丸カッコでなかったら構文解析エラー
+	return p.expectPeek(token.RPAREN)
+}
+
+/*
+パラメータを一つ解析してパラメータリストに追加する。
+...name は可変長パラメータとして扱い、最後のパラメータにのみ指定できる。
+name = expr はデフォルト値付きのパラメータとして扱う
+*/
+func (p *Parser) parseFunctionParameter(lit *ast.FunctionLiteral) bool {
+	if lit.Variadic {
+		p.addError(p.curToken, "variadic parameter must be the last parameter")
+		return false
+	}
+
+	if p.curTokenIs(token.ELLIPSIS) {
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		lit.Variadic = true
+	}
+
+	// パラメータのノード(識別子)を生成してパラメータリストに追加
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	lit.Parameters = append(lit.Parameters, ident)
+
+	if p.peekTokenIs(token.ASSIGN) {
+		if lit.Variadic {
+			p.addError(p.curToken, "variadic parameter cannot have a default value")
+			return false
+		}
+		p.nextToken()
+		p.nextToken()
+
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return false
+		}
+		if lit.Defaults == nil {
+			lit.Defaults = make(map[string]ast.Expression)
+		}
+		lit.Defaults[ident.Value] = value
 	}
 
-	// パラメータリストを返す
-	return identifiers
+	return true
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -495,14 +1220,46 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+/*
+エラーメッセージの一覧を取得する。各メッセージには line:column が先頭に付く
+*/
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Error()
+	}
+	return msgs
+}
+
+/*
+構文解析エラーの一覧を取得する
+*/
+func (p *Parser) ParseErrors() []ParseError {
 	return p.errors
 }
 
+/*
+tok の位置で起きたエラーを記録する。解析を打ち切った後のエラーは記録しない
+*/
+func (p *Parser) addError(tok token.Token, msg string) {
+	if p.aborted {
+		return
+	}
+	p.errors = append(p.errors, ParseError{Position: tok.Pos, Got: tok.Type, Message: msg})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
+	if p.aborted {
+		return
+	}
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errors = append(p.errors, ParseError{
+		Position: p.peekToken.Pos,
+		Expected: t,
+		Got:      p.peekToken.Type,
+		Message:  msg,
+	})
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -517,8 +1274,19 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+/*
+中置・後置演算子のトークンの優先順位を取得。演算子でない場合は LOWEST を返す
+*/
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
+	if p, ok := p.precedences[p.peekToken.Type]; ok {
 		return p
 	}
 
@@ -526,7 +1294,7 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	if p, ok := p.precedences[p.curToken.Type]; ok {
 		return p
 	}
 
@@ -537,6 +1305,8 @@ func (p *Parser) curPrecedence() int {
 式リストを解析
 */
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	defer p.enterNesting()()
+
 	list := []ast.Expression{}
 
 	if p.peekTokenIs(end) {
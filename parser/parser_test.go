@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -77,6 +80,28 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestBareReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return;", "return null;"},
+		{"return", "return null;"},
+		{"fn() { return }", "fn() return null;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -349,6 +374,50 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"1..n + 1",
+			"(1 .. (n + 1))",
+		},
+		{
+			"a < 1..2",
+			"(a < (1 .. 2))",
+		},
+		{
+			"x in arr == true",
+			"((x in arr) == true)",
+		},
+		{
+			"x + 1 in 0..10",
+			"((x + 1) in (0 .. 10))",
+		},
+		{
+			"typeof a + b",
+			"((typeof a) + b)",
+		},
+		{
+			"typeof x == \"INTEGER\"",
+			"((typeof x) == INTEGER)",
+		},
+		{
+			"a.b.c",
+			"((a.b).c)",
+		},
+		{
+			"a.b[0] * c.d(1)",
+			"(((a.b)[0]) * (c.d)(1))",
+		},
+		{
+			"-a.b",
+			"(-(a.b))",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a ?? b ?? c + 1",
+			"((a ?? b) ?? (c + 1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -987,3 +1056,812 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "let x = 5; /* never closed"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. got=%d (%q)", len(errors), errors)
+	}
+
+	expected := "1:12: illegal token: unterminated block comment"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestIntegerLiteralDigitSeparators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1_000_000;", 1000000},
+		{"1_2_3;", 123},
+		{"42;", 42},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestMisplacedDigitSeparators(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"1_;", `1:1: misplaced digit separator in "1_"`},
+		{"1__0;", `1:1: misplaced digit separator in "1__0"`},
+	}
+
+	for _, tt := range tests {
+		testParserError(t, tt.input, tt.expectedError)
+	}
+}
+
+func testParserError(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	for _, msg := range p.Errors() {
+		if msg == expected {
+			return
+		}
+	}
+
+	t.Errorf("expected parser error %q for input %q. got=%q",
+		expected, input, p.Errors())
+}
+
+func TestNullLiteralExpression(t *testing.T) {
+	input := "null;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	null, ok := stmt.Expression.(*ast.NullLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.NullLiteral. got=%T", stmt.Expression)
+	}
+	if null.TokenLiteral() != "null" {
+		t.Errorf("null.TokenLiteral not %q. got=%q", "null", null.TokenLiteral())
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { case 1 { "one" } case [h, t] { h } case {"type": k} { k } case _ { 0 } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	if len(exp.Arms) != 4 {
+		t.Fatalf("exp.Arms does not contain 4 arms. got=%d", len(exp.Arms))
+	}
+
+	testIntegerLiteral(t, exp.Arms[0].Pattern, 1)
+	if _, ok := exp.Arms[1].Pattern.(*ast.ArrayLiteral); !ok {
+		t.Errorf("arm 1 pattern is not ast.ArrayLiteral. got=%T", exp.Arms[1].Pattern)
+	}
+	if _, ok := exp.Arms[2].Pattern.(*ast.HashLiteral); !ok {
+		t.Errorf("arm 2 pattern is not ast.HashLiteral. got=%T", exp.Arms[2].Pattern)
+	}
+	testIdentifier(t, exp.Arms[3].Pattern, "_")
+}
+
+func TestConstStatements(t *testing.T) {
+	input := "const x = 5; const name = \"monkey\";"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	tests := []string{"x", "name"}
+	for i, name := range tests {
+		stmt, ok := program.Statements[i].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("s not *ast.ConstStatement. got=%T", program.Statements[i])
+		}
+		if stmt.Name.Value != name {
+			t.Errorf("stmt.Name.Value not '%s'. got=%s", name, stmt.Name.Value)
+		}
+	}
+}
+
+func TestLetArrayDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, c] = arr;", "let [a, b, c] = arr;"},
+		{"let [head, ...tail] = arr;", "let [head, ...tail] = arr;"},
+		{"let [] = arr;", "let [] = arr;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("s not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if _, ok := stmt.Pattern.(*ast.ArrayPattern); !ok {
+			t.Fatalf("stmt.Pattern not *ast.ArrayPattern. got=%T", stmt.Pattern)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+
+	testParserError(t, "let [a, ...b, c] = arr;",
+		"1:13: expected next token to be ], got , instead")
+}
+
+func TestLetHashDestructuring(t *testing.T) {
+	input := "let {name, age} = person;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("s not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	pattern, ok := stmt.Pattern.(*ast.HashPattern)
+	if !ok {
+		t.Fatalf("stmt.Pattern not *ast.HashPattern. got=%T", stmt.Pattern)
+	}
+	if len(pattern.Keys) != 2 {
+		t.Fatalf("pattern.Keys does not contain 2 keys. got=%d", len(pattern.Keys))
+	}
+	if stmt.String() != input {
+		t.Errorf("stmt.String() wrong. expected=%q, got=%q", input, stmt.String())
+	}
+}
+
+func TestVariadicFunctionParameterParsing(t *testing.T) {
+	input := "fn(a, ...rest) { rest };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+
+	if !function.Variadic {
+		t.Fatalf("function.Variadic is not true")
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function.Parameters wrong. want 2, got=%d", len(function.Parameters))
+	}
+	testLiteralExpression(t, function.Parameters[0], "a")
+	testLiteralExpression(t, function.Parameters[1], "rest")
+
+	if function.String() != "fn(a, ...rest) rest" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+
+	testParserError(t, "fn(...rest, a) { a };",
+		"1:13: variadic parameter must be the last parameter")
+}
+
+func TestDefaultFunctionParameterParsing(t *testing.T) {
+	input := "fn(x, y = 10, z = x * 2) { x };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+
+	if len(function.Parameters) != 3 {
+		t.Fatalf("function.Parameters wrong. want 3, got=%d", len(function.Parameters))
+	}
+	if _, ok := function.Defaults["x"]; ok {
+		t.Errorf("parameter x should not have a default value")
+	}
+	testIntegerLiteral(t, function.Defaults["y"], 10)
+	testInfixExpression(t, function.Defaults["z"], "x", "*", 2)
+
+	testParserError(t, "fn(...rest = 1) { rest };",
+		"1:7: variadic parameter cannot have a default value")
+}
+
+func TestCallExpressionSpreadArguments(t *testing.T) {
+	input := "add(1, ...args, ...[2, 3])"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	spread, ok := exp.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 is not ast.SpreadExpression. got=%T", exp.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "args")
+
+	if exp.String() != "add(1, ...args, ...[2, 3])" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
+func TestCallExpressionNamedArguments(t *testing.T) {
+	input := `makeUser(1, name: "a", age: 2 + 1)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if len(exp.Arguments) != 1 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	if len(exp.NamedArguments) != 2 {
+		t.Fatalf("wrong length of named arguments. got=%d", len(exp.NamedArguments))
+	}
+
+	if exp.NamedArguments[0].Name.Value != "name" {
+		t.Errorf("named argument 0 wrong. got=%q", exp.NamedArguments[0].Name.Value)
+	}
+	testInfixExpression(t, exp.NamedArguments[1].Value, 2, "+", 1)
+
+	if exp.String() != "makeUser(1, name: a, age: (2 + 1))" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+
+	testParserError(t, "f(a: 1, 2)", "1:9: positional argument after named argument")
+}
+
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr[1:3]", "(arr[1:3])"},
+		{"s[2:]", "(s[2:])"},
+		{"s[:2]", "(s[:2])"},
+		{"s[:]", "(s[:])"},
+		{"arr[a + 1:-1]", "(arr[(a + 1):(-1)])"},
+		{"arr[1]", "(arr[1])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestClassStatement(t *testing.T) {
+	input := `class Point(x, y = 0) {
+	let sum = x + y;
+	fn norm() { self.x * self.x + self.y * self.y }
+	fn add(other) { Point(self.x + other.x, self.y + other.y) };
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ClassStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ClassStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "Point" {
+		t.Errorf("stmt.Name.Value not 'Point'. got=%s", stmt.Name.Value)
+	}
+	if len(stmt.Constructor.Parameters) != 2 {
+		t.Errorf("constructor has wrong parameters. got=%d", len(stmt.Constructor.Parameters))
+	}
+	if len(stmt.Constructor.Body.Statements) != 1 {
+		t.Errorf("class has wrong number of fields. got=%d", len(stmt.Constructor.Body.Statements))
+	}
+	if len(stmt.Methods) != 2 {
+		t.Fatalf("class has wrong number of methods. got=%d", len(stmt.Methods))
+	}
+	if stmt.Methods[1].Name.Value != "add" {
+		t.Errorf("method name not 'add'. got=%s", stmt.Methods[1].Name.Value)
+	}
+
+	expected := "class Point(x, y = 0) { let sum = (x + y); " +
+		"fn norm() (((self.x) * (self.x)) + ((self.y) * (self.y))) " +
+		"fn add(other) Point(((self.x) + (other.x)), ((self.y) + (other.y))) }"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong.\nexpected=%q\ngot=%q", expected, stmt.String())
+	}
+
+	testParserError(t, "class A { 1 }", "1:11: unexpected INT in class body")
+}
+
+func TestNewlineTermination(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = b\n(c)", "let a = b;c"},
+		{"x\n-1", "x(-1)"},
+		{"x\n[1, 2]", "x[1, 2]"},
+		{"a +\nb", "(a + b)"},
+		{"f(a,\nb)\n(c)", "f(a, b)c"},
+		{"(a\n+ b)", "(a + b)"},
+		{"[a\n- b]", "[(a - b)]"},
+		{"{\"k\": a\n- b}", "{k:(a - b)}"},
+		{"obj\n.method()", "(obj.method)()"},
+		{"f(fn() {\nx\n-1\n})", "f(fn() x(-1))"},
+		{"if (a\n< b) {\nx\n-1\n}", "if(a < b) x(-1)"},
+		{"let a = 1; let b = 2\nlet c = 3", "let a = 1;let b = 2;let c = 3;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l, WithNewlineTermination())
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("input %q: expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	// オプションを指定しない場合は改行で文を終端しない
+	l := lexer.New("x\n-1")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if program.String() != "(x - 1)" {
+		t.Errorf("expected=%q, got=%q", "(x - 1)", program.String())
+	}
+}
+
+func TestNamedFunctionLiteralParsing(t *testing.T) {
+	input := "let f = fn fact(n) { n };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+	if function.Name == nil || function.Name.Value != "fact" {
+		t.Fatalf("function.Name wrong. got=%+v", function.Name)
+	}
+	if function.String() != "fn fact(n) n" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	input := `fn add(x, y) { x + y }
+let f = fn(x) { x };
+fn(x) { x }(1);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "add" {
+		t.Errorf("stmt.Name.Value not 'add'. got=%q", stmt.Name.Value)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Errorf("function parameters wrong. want 2, got=%d", len(stmt.Function.Parameters))
+	}
+	if stmt.String() != "fn add(x, y) (x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	// 名前のない関数リテラルは式文のまま
+	if _, ok := program.Statements[2].(*ast.ExpressionStatement); !ok {
+		t.Fatalf("program.Statements[2] is not ast.ExpressionStatement. got=%T", program.Statements[2])
+	}
+}
+
+func TestYieldExpressionParsing(t *testing.T) {
+	input := "let gen = fn(n) { yield n; yield; fn() { 1 } };"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	function := stmt.Value.(*ast.FunctionLiteral)
+	if !function.Generator {
+		t.Errorf("function.Generator is not true")
+	}
+
+	yield, ok := function.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.YieldExpression)
+	if !ok {
+		t.Fatalf("statement is not ast.YieldExpression. got=%T",
+			function.Body.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, yield.Value, "n")
+
+	bare := function.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.YieldExpression)
+	if bare.Value != nil {
+		t.Errorf("bare yield has value. got=%s", bare.Value)
+	}
+
+	// yield を含まない内側の関数はジェネレーターではない
+	inner := function.Body.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if inner.Generator {
+		t.Errorf("inner function should not be a generator")
+	}
+}
+
+func TestYieldOutsideFunction(t *testing.T) {
+	testParserError(t, "yield 1;", "1:1: yield outside function")
+}
+
+func TestSpawnExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn fn() { 1 }", "spawn fn() 1"},
+		{"spawn worker(1, 2)", "spawn worker(1, 2)"},
+		{"let c = spawn f;", "let c = spawn f;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	infix := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1"},
+		{let, "1:1"},
+		{let.Name, "1:5"},
+		{fn, "1:11"},
+		{fn.Parameters[1], "1:17"},
+		{infix, "2:5"},
+		{infix.Left, "2:3"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("position of %q wrong. expected=%s, got=%s",
+				tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	input := `let = 5;
+let y 10;
+if (x) { let = 1; } let z = ;
+let ok = 1;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"1:5: expected next token to be IDENT, got = instead",
+		"2:7: expected next token to be =, got INT instead",
+		"3:14: expected next token to be IDENT, got = instead",
+		"3:29: no prefix parse function for ; found",
+	}
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%q)", len(expected), len(errors), errors)
+	}
+	for i, msg := range expected {
+		if errors[i] != msg {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i])
+		}
+	}
+
+	if len(program.Statements) != 1 || program.Statements[0].String() != "let ok = 1;" {
+		t.Errorf("statements after errors not parsed. got=%q", program.String())
+	}
+}
+
+func TestStructuredParseErrors(t *testing.T) {
+	input := "let x 5;\nlet y = ];"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	expected := []ParseError{
+		{
+			Position: token.Position{Line: 1, Column: 7},
+			Expected: token.ASSIGN,
+			Got:      token.INT,
+			Message:  "expected next token to be =, got INT instead",
+		},
+		{
+			Position: token.Position{Line: 2, Column: 9},
+			Got:      token.RBRACKET,
+			Message:  "no prefix parse function for ] found",
+		},
+	}
+
+	errors := p.ParseErrors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d (%+v)", len(expected), len(errors), errors)
+	}
+	for i, want := range expected {
+		if errors[i] != want {
+			t.Errorf("errors[%d] wrong. want=%+v, got=%+v", i, want, errors[i])
+		}
+	}
+
+	if p.Errors()[0] != "1:7: expected next token to be =, got INT instead" {
+		t.Errorf("Errors() wrong. got=%q", p.Errors())
+	}
+}
+
+func TestCustomOperators(t *testing.T) {
+	// a ** b は右結合で pow(a, b) の呼び出しにする
+	pow := func(p *Parser, left ast.Expression) ast.Expression {
+		call := &ast.CallExpression{
+			Token:    p.CurToken(),
+			Function: &ast.Identifier{Token: p.CurToken(), Value: "pow"},
+		}
+		p.NextToken()
+		call.Arguments = []ast.Expression{left, p.ParseExpression(PRODUCT)}
+		return call
+	}
+	mod := func(p *Parser, left ast.Expression) ast.Expression {
+		exp := &ast.InfixExpression{Token: p.CurToken(), Operator: "%", Left: left}
+		p.NextToken()
+		exp.Right = p.ParseExpression(PRODUCT)
+		return exp
+	}
+	// unless (cond) { ... } は if (!cond) { ... } にする
+	unless := func(p *Parser) ast.Expression {
+		exp := &ast.IfExpression{Token: p.CurToken()}
+		if !p.ExpectPeek(token.LPAREN) {
+			return nil
+		}
+		p.NextToken()
+		exp.Condition = &ast.PrefixExpression{Operator: "!", Right: p.ParseExpression(LOWEST)}
+		if !p.ExpectPeek(token.RPAREN) || !p.ExpectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Consequence = p.ParseBlockStatement()
+		return exp
+	}
+
+	opts := []Option{
+		WithToken("**", "POW"),
+		WithInfixOperator("POW", PRODUCT+1, pow),
+		WithToken("%", "MOD"),
+		WithInfixOperator("MOD", PRODUCT, mod),
+		WithToken("unless", "UNLESS"),
+		WithPrefixOperator("UNLESS", unless),
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 ** 2 ** 2", "(2 * pow(3, pow(2, 2)))"},
+		{"7 % 3 + 1", "((7 % 3) + 1)"},
+		{"unless (x) { y }", "if(!x) y"},
+		{"let unlessX = 1", "let unlessX = 1;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), opts...)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	// 空白で離れた * * は ** にならない
+	p := New(lexer.New("2 * *3"), opts...)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("separated symbols were combined")
+	}
+
+	// 他の構文解析器には影響しない
+	p = New(lexer.New("1 % 2"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("custom operator leaked into default parser")
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	deep := 100000
+	tests := []struct {
+		input string
+		opts  []Option
+		err   string
+	}{
+		{strings.Repeat("(", deep) + "1" + strings.Repeat(")", deep), nil, "maximum nesting depth of 1000 exceeded"},
+		{strings.Repeat("!", deep) + "true", nil, "maximum nesting depth of 1000 exceeded"},
+		{strings.Repeat("if (x) { ", deep) + strings.Repeat("}", deep), nil, "maximum nesting depth of 1000 exceeded"},
+		{"((((1))))", []Option{WithMaxDepth(3)}, "1:4: maximum nesting depth of 3 exceeded"},
+		{"((1))", []Option{WithMaxDepth(3)}, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), tt.opts...)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if tt.err == "" {
+			if len(errors) != 0 {
+				t.Errorf("unexpected errors: %q", errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.HasSuffix(errors[0], tt.err) {
+			t.Errorf("wrong errors. want=%q, got=%d errors (first: %q)", tt.err, len(errors), errors[:1])
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	p := New(lexer.New("-1 + x;"), WithTrace(&out))
+	p.ParseProgram()
+
+	expected := "BEGIN parseExpressionStatement\n" +
+		"\tBEGIN parseExpression\n" +
+		"\t\tBEGIN parsePrefixExpression\n" +
+		"\t\t\tBEGIN parseExpression\n" +
+		"\t\t\t\tBEGIN parseIntegerLiteral\n" +
+		"\t\t\t\tEND parseIntegerLiteral\n" +
+		"\t\t\tEND parseExpression\n" +
+		"\t\tEND parsePrefixExpression\n" +
+		"\t\tBEGIN parseInfixExpression\n" +
+		"\t\t\tBEGIN parseExpression\n" +
+		"\t\t\tEND parseExpression\n" +
+		"\t\tEND parseInfixExpression\n" +
+		"\tEND parseExpression\n" +
+		"END parseExpressionStatement\n"
+	if out.String() != expected {
+		t.Errorf("trace wrong.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"let x = 5; x * (2 + 3);",
+		"fn add(a, b = 1, ...rest) { return a + b; }",
+		`let h = {"a": [1, 2][0], "b": fn() { yield 1 }}; h.a`,
+		"match (x) { case [a, b] { a } case {k} { k } case _ { null } }",
+		"class Point(x, y = 0) { let z = x; fn norm() { x * y } }",
+		"let [a, ...b] = c; f(...xs, sep: 1); s[1:2]; spawn g(); typeof -x ?? 1..3",
+		"if (x) { 1 } else { 2 }",
+		"<<~EOS\n  doc\n  EOS",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		for _, opts := range [][]Option{nil, {WithNewlineTermination()}} {
+			p := New(lexer.New(input), opts...)
+			program := p.ParseProgram()
+			// エラーのある文は捨てられるので、文字列表現はいつでも作れる
+			_ = program.String()
+		}
+	})
+}
@@ -1,31 +1,43 @@
 package parser
 
 import (
+	"io"
 	"strings"
 )
 
-var traceLevel int = 0
-
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+/*
+構文解析関数の呼び出しを w に書き出すオプション。w が nil の場合は書き出さない
+*/
+func WithTrace(w io.Writer) Option {
+	return func(p *Parser) {
+		p.tracer = w
+	}
+}
+
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
 }
 
-func tracePrint(fs string) {
-	// fmt.Printf("%s%s\n", identLevel(), fs)
+func (p *Parser) tracePrint(fs string) {
+	io.WriteString(p.tracer, p.identLevel()+fs+"\n")
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (p *Parser) incIdent() { p.traceLevel = p.traceLevel + 1 }
+func (p *Parser) decIdent() { p.traceLevel = p.traceLevel - 1 }
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
+/*
+構文解析関数の開始を書き出す。呼び出し側で p.tracer が nil でないことを確認してから
+defer p.untrace(p.trace("...")) として使い、トレースしない場合の負荷をなくす
+*/
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	p.tracePrint("BEGIN " + msg)
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	p.tracePrint("END " + msg)
+	p.decIdent()
 }
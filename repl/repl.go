@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/diagnostic"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
 	"monkey/token"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -26,32 +29,38 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+/*
+対話的に入力されたコードを評価する。組み込み関数には policy で許可した操作だけを許可する
+*/
+func Start(in io.Reader, out io.Writer, policy *object.Policy) {
+	// スクリプトの input や readLine と同じ読み込み元を共有する
+	reader := bufio.NewReader(in)
+	evaluator.SetInput(reader)
 	env := object.NewEnvironment()
+	env.SetPolicy(policy)
 
 	for {
 		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
+		line = strings.TrimRight(line, "\r\n")
 
-		line := scanner.Text()
 		l := lexer.New(line)
 
-		p := parser.New(l)
+		p := parser.New(l, parser.WithNewlineTermination())
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, line, p.ParseErrors())
 			continue
 		}
+		resolver.Resolve(program)
 
 		evaluated := evaluator.Eval(program, env)
 		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+			printResult(out, line, evaluated)
 		}
 
 		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
@@ -60,11 +69,25 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, MONKEY_FACE)
-		io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-		io.WriteString(out, " parser errors:\n")
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, source string, errors []parser.ParseError) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(out, " parser errors:\n")
+	for _, err := range errors {
+		diagnostic.Render(out, source, err.Position, err.Error())
 	}
 }
+
+/*
+評価結果を表示する。入力した行で起きたエラーには該当箇所を示す
+*/
+func printResult(out io.Writer, source string, evaluated object.Object) {
+	msg := object.Pretty(evaluated, object.DefaultPrettyOptions)
+
+	// モジュールなど別のファイルで起きたエラーは入力した行と対応しない
+	if err, ok := evaluated.(*object.Error); ok && err.Pos.File == "" {
+		diagnostic.Render(out, source, err.Pos, msg)
+		return
+	}
+	io.WriteString(out, msg+"\n")
+}
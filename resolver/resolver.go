@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"monkey/ast"
+)
+
+/*
+スコープの種類。評価器が環境を作る単位に対応する
+*/
+type scopeKind int
+
+const (
+	functionScope scopeKind = iota // 関数呼び出しの環境。束縛はスロットに割り当てる
+	nameScope                      // 名前付き関数リテラルが自身の名前だけを束縛する環境
+	opaqueScope                    // トップレベルやmatch式の分岐など、束縛を静的に決められない環境
+)
+
+type scope struct {
+	outer *scope
+	kind  scopeKind
+	slots map[string]int // functionScope の名前ごとのスロット番号
+	names []string       // スロット番号順の名前。nameScope では束縛する名前
+}
+
+/*
+構文木の識別子を、評価器が名前で環境を探さずに済むよう関数の環境のスロットに解決する。
+関数リテラルには呼び出し時の環境のスロットに割り当てる名前を記録する。
+束縛先を静的に決められない識別子は未解決のまま残し、評価器は名前で環境を探す
+*/
+func Resolve(node ast.Node) {
+	r := &resolver{scope: &scope{kind: opaqueScope}}
+	ast.Walk(r, node)
+}
+
+type resolver struct {
+	scope *scope
+}
+
+func (r *resolver) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node)
+		return nil
+
+	// 分岐の本体は識別子パターンを束縛した新しい環境で評価される
+	case *ast.MatchArm:
+		r.enter(&scope{kind: opaqueScope})
+		ast.Walk(r, node.Body)
+		r.leave()
+		return nil
+
+	// メソッドは self を束縛した環境で呼び出される
+	case *ast.ClassStatement:
+		r.resolveIdentifier(node.Name)
+		r.enter(&scope{kind: opaqueScope})
+		r.resolveFunction(node.Constructor, "self")
+		for _, m := range node.Methods {
+			r.resolveFunction(m.Function)
+		}
+		r.leave()
+		return nil
+
+	// プロパティ名や引数名は環境から探す識別子ではない
+	case *ast.MemberExpression:
+		ast.Walk(r, node.Object)
+		return nil
+	case *ast.NamedArgument:
+		ast.Walk(r, node.Value)
+		return nil
+	}
+
+	return r
+}
+
+/*
+関数リテラルの本体を解決する。パラメータ、predeclared、本体で宣言される名前の順にスロットを割り当てる
+*/
+func (r *resolver) resolveFunction(fl *ast.FunctionLiteral, predeclared ...string) {
+	if fl.Name != nil {
+		fl.Name.Resolve(0, -1)
+		r.enter(&scope{kind: nameScope, names: []string{fl.Name.Value}})
+		defer r.leave()
+	}
+
+	s := &scope{kind: functionScope, slots: make(map[string]int)}
+	r.enter(s)
+	defer r.leave()
+
+	for _, param := range fl.Parameters {
+		declare(s, param.Value)
+	}
+	for _, name := range predeclared {
+		declare(s, name)
+	}
+	// if式のブロックは関数の環境を共有するので、本体の奥で宣言される名前も先に割り当てる
+	for _, param := range fl.Parameters {
+		if def, ok := fl.Defaults[param.Value]; ok {
+			declareAll(s, def)
+		}
+	}
+	declareAll(s, fl.Body)
+
+	for _, param := range fl.Parameters {
+		r.resolveIdentifier(param)
+		if def, ok := fl.Defaults[param.Value]; ok {
+			ast.Walk(r, def)
+		}
+	}
+	ast.Walk(r, fl.Body)
+
+	fl.SetSlots(s.names)
+}
+
+/*
+識別子を外側のスコープへ順に探して解決する。静的に決められなければ未解決にし、
+束縛されていないことが確かな関数の環境を名前で探さずに済むよう、探し始める環境の深さを記録する
+*/
+func (r *resolver) resolveIdentifier(ident *ast.Identifier) {
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		switch s.kind {
+		case functionScope:
+			if slot, ok := s.slots[ident.Value]; ok {
+				ident.Resolve(depth, slot)
+				return
+			}
+		case nameScope:
+			if s.names[0] == ident.Value {
+				ident.Resolve(depth, -1)
+				return
+			}
+		case opaqueScope:
+			ident.Resolve(depth, -1)
+			return
+		}
+		depth++
+	}
+	ident.Resolve(0, -1)
+}
+
+func (r *resolver) enter(s *scope) {
+	s.outer = r.scope
+	r.scope = s
+}
+
+func (r *resolver) leave() {
+	r.scope = r.scope.outer
+}
+
+/*
+名前にスロットを割り当てる。割り当て済みの名前は同じスロットを使う
+*/
+func declare(s *scope, name string) {
+	if _, ok := s.slots[name]; ok {
+		return
+	}
+	s.slots[name] = len(s.names)
+	s.names = append(s.names, name)
+}
+
+/*
+node の中で関数の環境に束縛される名前をすべて割り当てる。
+別の環境で評価される関数リテラルやmatch式の分岐、クラスの本体には入らない
+*/
+func declareAll(s *scope, node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MatchArm:
+			return false
+		case *ast.ClassStatement:
+			declare(s, n.Name.Value)
+			return false
+		case *ast.LetStatement:
+			if n.Name != nil {
+				declare(s, n.Name.Value)
+			}
+			switch pattern := n.Pattern.(type) {
+			case *ast.ArrayPattern:
+				for _, el := range pattern.Elements {
+					declare(s, el.Value)
+				}
+				if pattern.Rest != nil {
+					declare(s, pattern.Rest.Value)
+				}
+			case *ast.HashPattern:
+				for _, key := range pattern.Keys {
+					declare(s, key.Value)
+				}
+			}
+		case *ast.ConstStatement:
+			declare(s, n.Name.Value)
+		case *ast.FunctionStatement:
+			declare(s, n.Name.Value)
+		}
+		return true
+	})
+}
@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	input := `
+let g = 1;
+let f = fn(a, b) {
+	let c = a;
+	if (b) { let d = b; }
+	let inner = fn(x) { x + a + c + g };
+	match (a) { case y { let z = y; y + a } }
+	let named = fn h() { h + a };
+	inner
+};
+class C(p) { let q = p; fn m() { self.q + q } }
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	Resolve(program)
+
+	type resolution struct {
+		depth, slot int
+		ok          bool
+	}
+	got := map[string][]resolution{}
+	var functions []*ast.FunctionLiteral
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			depth, slot, ok := n.Slot()
+			got[n.Value] = append(got[n.Value], resolution{depth, slot, ok})
+		case *ast.FunctionLiteral:
+			functions = append(functions, n)
+		}
+		return true
+	})
+
+	tests := []struct {
+		name     string
+		expected []resolution
+	}{
+		// トップレベルの束縛は、関数の環境を飛ばしてトップレベルの環境から名前で探す
+		{"g", []resolution{{0, -1, false}, {2, -1, false}}},
+		// パラメータと本体の宣言は関数のスロットに割り当てる
+		{"a", []resolution{{0, 0, true}, {0, 0, true}, {1, 0, true}, {0, 0, true}, {0, -1, false}, {2, 0, true}}},
+		{"b", []resolution{{0, 1, true}, {0, 1, true}, {0, 1, true}}},
+		{"c", []resolution{{0, 2, true}, {1, 2, true}}},
+		{"d", []resolution{{0, 3, true}}},
+		{"x", []resolution{{0, 0, true}, {0, 0, true}}},
+		// match式の分岐の束縛は名前で探す
+		{"z", []resolution{{0, -1, false}}},
+		// 名前付き関数リテラルの名前は、名前を束縛した環境から名前で探す
+		{"h", []resolution{{0, -1, false}, {1, -1, false}}},
+		// メソッドからはselfを束縛した環境から名前で探す。プロパティ名は解決しない
+		{"q", []resolution{{0, 2, true}, {0, -1, false}, {1, -1, false}}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(got[tt.name], tt.expected) {
+			t.Errorf("resolution of %s wrong.\nwant=%v\ngot =%v", tt.name, tt.expected, got[tt.name])
+		}
+	}
+
+	expectedSlots := [][]string{
+		{"a", "b", "c", "d", "inner", "named"},
+		{"x"},
+		{},
+		{"p", "self", "q"},
+		{},
+	}
+	if len(functions) != len(expectedSlots) {
+		t.Fatalf("wrong number of functions. got=%d", len(functions))
+	}
+	for i, fl := range functions {
+		if len(fl.Slots()) != len(expectedSlots[i]) || (len(fl.Slots()) > 0 && !reflect.DeepEqual(fl.Slots(), expectedSlots[i])) {
+			t.Errorf("functions[%d].Slots() wrong. want=%v, got=%v", i, expectedSlots[i], fl.Slots())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package token
+
+/*
+構文強調などに使うトークンの分類
+*/
+type Class int
+
+const (
+	ClassIllegal    Class = iota // 不正なトークン
+	ClassEOF                     // 入力の終わり
+	ClassComment                 // コメント
+	ClassIdentifier              // 識別子
+	ClassKeyword                 // let や fn などのキーワード
+	ClassLiteral                 // 整数・文字列と true, false, null
+	ClassOperator                // + や == などの演算子。in と typeof も含む
+	ClassDelimiter               // カッコや区切り記号
+)
+
+var classNames = map[Class]string{
+	ClassIllegal:    "illegal",
+	ClassEOF:        "eof",
+	ClassComment:    "comment",
+	ClassIdentifier: "identifier",
+	ClassKeyword:    "keyword",
+	ClassLiteral:    "literal",
+	ClassOperator:   "operator",
+	ClassDelimiter:  "delimiter",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+/*
+トークンの種類の分類を取得
+*/
+func (t TokenType) Class() Class {
+	switch t {
+	case EOF:
+		return ClassEOF
+	case COMMENT:
+		return ClassComment
+	case IDENT:
+		return ClassIdentifier
+	case INT, STRING, TRUE, FALSE, NULL:
+		return ClassLiteral
+	case ASSIGN, PLUS, MINUS, BANG, ASTERISK, SLASH, LT, GT, EQ, NOT_EQ,
+		COALESCE, RANGE, IN, TYPEOF:
+		return ClassOperator
+	case COMMA, SEMICOLON, COLON, ELLIPSIS, DOT,
+		LPAREN, RPAREN, LBRACE, RBRACE, LBRACKET, RBRACKET:
+		return ClassDelimiter
+	}
+
+	for _, keyword := range keywords {
+		if t == keyword {
+			return ClassKeyword
+		}
+	}
+	return ClassIllegal
+}
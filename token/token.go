@@ -1,15 +1,46 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type          TokenType
+	Literal       string
+	NewlineBefore bool     // 直前に改行があったかどうか
+	Pos           Position // ソースコード上の位置
+}
+
+/*
+ソースコード上の位置。行と列は1から数え、列は文字単位で数える
+*/
+type Position struct {
+	File   string // ファイル名。標準入力やREPLの場合は空
+	Line   int
+	Column int
+}
+
+/*
+位置が設定されているかどうか判定
+*/
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+/*
+file:line:column の形式の文字列。ファイル名がない場合は line:column にする
+*/
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // // ... または # ...
 
 	// 識別子 + リテラル
 	IDENT  = "IDENT" // add, foobar, x, y, ...
@@ -29,10 +60,15 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	COALESCE = "??"
+	RANGE    = ".."
+
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -44,21 +80,39 @@ const (
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	NULL     = "NULL"
+	MATCH    = "MATCH"
+	CASE     = "CASE"
+	CLASS    = "CLASS"
+	IN       = "IN"
+	TYPEOF   = "TYPEOF"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
 )
 
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"true":   TRUE,
 	"false":  FALSE,
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"null":   NULL,
+	"match":  MATCH,
+	"case":   CASE,
+	"class":  CLASS,
+	"in":     IN,
+	"typeof": TYPEOF,
+	"yield":  YIELD,
+	"spawn":  SPAWN,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"monkey/code"
+)
+
+/*
+関数呼び出しのフレーム
+*/
+type Frame struct {
+	cl          *Closure
+	ip          int // 次に読み込む命令の直前の位置
+	op          int // 実行中の命令の位置
+	basePointer int // ローカル変数の先頭のスタック上の位置
+
+	tailCall string // 末尾呼び出しでフレームを置き換えた場合の、呼び出した関数の名前
+}
+
+func NewFrame(cl *Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
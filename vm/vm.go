@@ -0,0 +1,592 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"sync/atomic"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+/*
+クロージャ。コンパイル済みの関数と、作成時に閉じ込めた自由変数を持つ
+*/
+type Closure struct {
+	Fn   *object.CompiledFunction
+	Free []object.Object
+
+	program *program // 呼び出し時に参照する定数とグローバル変数
+}
+
+func (c *Closure) Type() object.ObjectType { return object.FUNCTION_OBJ }
+func (c *Closure) Inspect() string         { return c.Fn.Source }
+
+/*
+評価器から呼び出す。組み込み関数にコールバックとして渡された場合に使われる
+*/
+func (c *Closure) Call(args []object.Object) object.Object {
+	// 組み込み関数を介した再帰はGoのスタックを使うので、入れ子の数もフレームと同じく制限する
+	if atomic.AddInt64(&c.program.calls, 1) > MaxFrames {
+		atomic.AddInt64(&c.program.calls, -1)
+		return &object.Error{Kind: object.LimitError, Message: "stack overflow"}
+	}
+	defer atomic.AddInt64(&c.program.calls, -1)
+
+	vm := &VM{program: c.program, stack: make([]object.Object, StackSize), frames: make([]*Frame, MaxFrames)}
+
+	vm.push(c)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	if err := vm.callClosure(c, len(args)); err != nil {
+		return err
+	}
+	return vm.run()
+}
+
+/*
+実行中のプログラムが共有する定数とグローバル変数
+*/
+type program struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+	calls       int64 // 評価器から呼び出されて実行中のクロージャの数
+	steps       int64 // 実行した命令の数
+	allocated   int64 // 作った値のおおよその大きさの累計
+	config      object.Config
+	env         *object.Environment // 組み込み関数に適用する Policy と Config を持つ環境
+	ctx         context.Context     // 実行を打ち切るためのコンテキスト
+	done        <-chan struct{}     // ctx の Done。nil なら打ち切らない
+}
+
+/*
+バイトコードを実行する仮想マシン
+*/
+type VM struct {
+	*program
+
+	stack []object.Object
+	sp    int // 次に積む位置。スタックの先頭は stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	marks []argumentsMark // 引数を評価中の呼び出し
+
+	lastPopped object.Object
+}
+
+/*
+OpArguments で記録する、引数を評価中の呼び出し
+*/
+type argumentsMark struct {
+	frame int // 呼び出し式を評価しているフレームの番号
+	sp    int // 最初の引数を積む位置。呼び出す関数は stack[sp-1]
+	call  int // 対応する OpCall の位置
+}
+
+/*
+新規仮想マシンを生成
+*/
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		CallNames:    bytecode.CallNames,
+	}
+	p := &program{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+		env:         object.NewEnvironment(),
+	}
+	mainFrame := NewFrame(&Closure{Fn: mainFn, program: p}, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		program:     p,
+		stack:       make([]object.Object, StackSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+/*
+プログラムを実行し、最後の式文の値かトップレベルのreturn文の値を返す。
+実行時エラーの場合は評価器と同じくエラーオブジェクトを返す
+*/
+func (vm *VM) Run() object.Object {
+	vm.steps = 0
+	vm.allocated = 0
+	return vm.run()
+}
+
+/*
+ctx が終了するまでプログラムを実行する。評価器の EvalContext と同じく、終了すれば実行を打ち切ってエラーオブジェクトを返す。
+命令を実行するたびに ctx を確認し、import で読み込むモジュールの評価や組み込み関数のコールバックも打ち切る
+*/
+func (vm *VM) RunContext(ctx context.Context) object.Object {
+	prev := vm.env.SetContext(ctx)
+	defer vm.env.SetContext(prev)
+	vm.ctx, vm.done = ctx, ctx.Done()
+	defer func() { vm.ctx, vm.done = nil, nil }()
+
+	return vm.Run()
+}
+
+/*
+組み込み関数に許可する操作をセットする。評価器の環境の Policy と同じく、nil なら DefaultPolicy を適用する
+*/
+func (vm *VM) SetPolicy(policy *object.Policy) {
+	vm.env.SetPolicy(policy)
+}
+
+/*
+評価の設定をセットする。評価器の環境の Config と同じく、Run のたびに上限までの量を数え直す
+*/
+func (vm *VM) SetConfig(config object.Config) {
+	vm.config = config
+	vm.env.SetConfig(config)
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+/*
+最初のフレームから戻るか、命令列の終わりに達するまで実行する
+*/
+func (vm *VM) run() object.Object {
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+		frame.op = frame.ip
+
+		ins := frame.Instructions()
+		op := code.Opcode(ins[frame.ip])
+
+		if vm.done != nil {
+			select {
+			case <-vm.done:
+				err := &object.Error{Kind: object.LimitError, Message: fmt.Sprintf("evaluation canceled: %s", vm.ctx.Err())}
+				if !vm.raise(err) {
+					return err
+				}
+				continue
+			default:
+			}
+		}
+
+		// 評価器の MaxSteps と同じく、実行する命令の数を制限する
+		if vm.config.MaxSteps > 0 {
+			vm.steps++
+			if vm.steps > vm.config.MaxSteps {
+				err := &object.Error{Kind: object.LimitError, Message: fmt.Sprintf("step limit exceeded: %d", vm.config.MaxSteps)}
+				if !vm.raise(err) {
+					return err
+				}
+				continue
+			}
+		}
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE)
+		case code.OpFalse:
+			err = vm.push(object.FALSE)
+		case code.OpNull:
+			err = vm.push(object.NULL)
+
+		case code.OpPrefix:
+			operator := vm.constants[code.ReadUint16(ins[frame.ip+1:])].(*object.String).Value
+			frame.ip += 2
+			err = vm.pushResult(evaluator.EvalPrefix(operator, vm.pop(), vm.config))
+
+		case code.OpInfix:
+			operator := vm.constants[code.ReadUint16(ins[frame.ip+1:])].(*object.String).Value
+			frame.ip += 2
+			right := vm.pop()
+			left := vm.pop()
+			result := evaluator.EvalInfix(operator, left, right, vm.config)
+			if err = vm.allocate(evaluator.AllocationSize(result)); err == nil {
+				err = vm.pushResult(result)
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			if vm.stack[vm.sp-1] != object.NULL {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			err = vm.pushGlobal(int(globalIndex))
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[frame.ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[frame.ip+1:])
+			frame.ip += 1
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[frame.ip+1:])
+			frame.ip += 1
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[frame.ip+1:])
+			frame.ip += 1
+			err = vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			array := &object.Array{Elements: elements}
+			if err = vm.allocate(evaluator.AllocationSize(array)); err == nil {
+				err = vm.push(array)
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			hash, hashErr := vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp -= numElements
+			if hashErr != nil {
+				err = hashErr
+			} else if err = vm.allocate(evaluator.AllocationSize(hash)); err == nil {
+				err = vm.push(hash)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.EvalIndex(left, index))
+
+		case code.OpMember:
+			name := vm.constants[code.ReadUint16(ins[frame.ip+1:])].(*object.String).Value
+			frame.ip += 2
+			err = vm.pushResult(evaluator.EvalMember(vm.pop(), name))
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[frame.ip+1:])
+			numFree := code.ReadUint8(ins[frame.ip+3:])
+			frame.ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		case code.OpArguments:
+			call := int(code.ReadUint16(ins[frame.ip+1:]))
+			frame.ip += 2
+			vm.marks = append(vm.marks, argumentsMark{frame: vm.framesIndex, sp: vm.sp, call: call})
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[frame.ip+1:])
+			frame.ip += 1
+			vm.marks = vm.marks[:len(vm.marks)-1]
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue, code.OpReturn:
+			returnValue := object.Object(object.NULL)
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
+			if vm.framesIndex == 1 {
+				return returnValue
+			}
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+		}
+
+		if err != nil && !vm.raise(err) {
+			return err
+		}
+	}
+
+	return vm.lastPopped
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return &object.Error{Kind: object.LimitError, Message: "stack overflow"}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+/*
+評価器の関数の結果を積む。エラーの場合は積まずにエラーを返す
+*/
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	return vm.push(o)
+}
+
+/*
+評価器の Config の MaxAllocation と同じく、作った値の大きさの累計を制限する
+*/
+func (vm *VM) allocate(size int64) *object.Error {
+	if vm.config.MaxAllocation <= 0 || size == 0 {
+		return nil
+	}
+	vm.allocated += size
+	if vm.allocated > vm.config.MaxAllocation {
+		return &object.Error{Kind: object.LimitError, Message: fmt.Sprintf("allocation limit exceeded: %d", vm.config.MaxAllocation)}
+	}
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+/*
+グローバル変数を積む。値が束縛される前であれば、評価器と同じく組み込み関数を探す
+*/
+func (vm *VM) pushGlobal(index int) *object.Error {
+	if val := vm.globals[index]; val != nil {
+		return vm.push(val)
+	}
+
+	name := vm.globalNames[index]
+	if builtin, ok := evaluator.EnvironmentBuiltin(name, vm.env); ok {
+		return vm.push(builtin)
+	}
+	return &object.Error{Kind: object.NameError, Message: fmt.Sprintf("identifier not found: %s", name)}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, &object.Error{Kind: object.TypeError, Message: fmt.Sprintf("unusable as hash key: %s", key.Type())}
+		}
+
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) *object.Error {
+	function := vm.constants[constIndex].(*object.CompiledFunction)
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&Closure{Fn: function, Free: free, program: vm.program})
+}
+
+/*
+スタックに積まれた関数を呼び出す。クロージャ以外は評価器と同じ方法で呼び出し、結果を積む
+*/
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	if cl, ok := callee.(*Closure); ok {
+		return vm.callClosure(cl, numArgs)
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+
+	var result object.Object
+	if builtin, ok := callee.(*object.Builtin); ok {
+		result = evaluator.CallBuiltin(builtin, args)
+		if vm.config.MaxAllocation > 0 {
+			if err := vm.allocate(evaluator.BuiltinAllocationSize(result, args)); err != nil {
+				return err
+			}
+		}
+	} else {
+		result = evaluator.Apply(callee, args)
+	}
+	if result == nil {
+		result = object.NULL
+	}
+	return vm.pushResult(result)
+}
+
+/*
+クロージャのフレームを積む。可変長パラメータには残りの引数を配列にして渡し、可変長パラメータがなければ引数の数を確かめる。
+末尾位置の呼び出しであれば、実行中のフレームを置き換えてフレームを増やさない
+*/
+func (vm *VM) callClosure(cl *Closure, numArgs int) *object.Error {
+	fn := cl.Fn
+
+	fixed := fn.NumParameters
+	if fn.Variadic {
+		fixed--
+	}
+	if numArgs < fixed || !fn.Variadic && numArgs > fixed {
+		return &object.Error{Kind: object.ArgumentError, Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d", numArgs, fixed)}
+	}
+
+	tailCall := ""
+	if vm.isTailCall() {
+		// 呼び出す関数と引数を実行中のフレームの関数の位置に移してからフレームを捨てる
+		frame := vm.popFrame()
+		start := vm.sp - 1 - numArgs
+		copy(vm.stack[frame.basePointer-1:], vm.stack[start:vm.sp])
+		vm.sp = frame.basePointer + numArgs
+		tailCall = frame.cl.Fn.CallNames[frame.op]
+	}
+
+	if fn.Variadic {
+		rest := make([]object.Object, numArgs-fixed)
+		copy(rest, vm.stack[vm.sp-len(rest):vm.sp])
+		vm.sp -= len(rest)
+		vm.push(&object.Array{Elements: rest})
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return &object.Error{Kind: object.LimitError, Message: "stack overflow"}
+	}
+	basePointer := vm.sp - fn.NumParameters
+	frame := NewFrame(cl, basePointer)
+	frame.tailCall = tailCall
+	vm.pushFrame(frame)
+	if basePointer+fn.NumLocals >= StackSize {
+		vm.popFrame()
+		return &object.Error{Kind: object.LimitError, Message: "stack overflow"}
+	}
+	vm.sp = basePointer + fn.NumLocals
+
+	return nil
+}
+
+/*
+実行中の OpCall の後に、無条件分岐をたどって OpReturnValue しかないかどうか判定。
+最初のフレームはトップレベルか評価器から呼び出されたクロージャなので置き換えない
+*/
+func (vm *VM) isTailCall() bool {
+	if vm.framesIndex <= 1 {
+		return false
+	}
+	if len(vm.marks) > 0 && vm.marks[len(vm.marks)-1].frame == vm.framesIndex {
+		return false
+	}
+
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+	pos := frame.ip + 1
+	for pos < len(ins) && code.Opcode(ins[pos]) == code.OpJump {
+		pos = int(code.ReadUint16(ins[pos+1:]))
+	}
+	return pos < len(ins) && code.Opcode(ins[pos]) == code.OpReturnValue
+}
+
+/*
+実行中の命令で起きたエラーを処理する。エラーを引数として受け取る組み込み関数の呼び出しの中であれば
+その関数を呼び出して実行を続け、trueを返す。そうでなければ呼び出し元のフレームをたどってfalseを返す
+*/
+func (vm *VM) raise(err *object.Error) bool {
+	frame := vm.currentFrame()
+	if !err.Pos.IsValid() {
+		err.Pos = frame.cl.Fn.Positions[frame.op]
+	} else if name, ok := frame.cl.Fn.CallNames[frame.op]; ok {
+		err.Stack = append(err.Stack, name)
+	}
+
+	for {
+		// 引数の評価でエラーが起きた呼び出しを内側から調べる
+		for len(vm.marks) > 0 && vm.marks[len(vm.marks)-1].frame == vm.framesIndex {
+			mark := vm.marks[len(vm.marks)-1]
+			vm.marks = vm.marks[:len(vm.marks)-1]
+
+			builtin, ok := vm.stack[mark.sp-1].(*object.Builtin)
+			if !ok || !builtin.CatchErrors {
+				continue
+			}
+			vm.sp = mark.sp - 1
+			frame.ip = mark.call + 1
+			frame.op = mark.call
+			result := evaluator.CallBuiltin(builtin, []object.Object{err})
+			if resultErr, ok := result.(*object.Error); ok {
+				return vm.raise(resultErr)
+			}
+			vm.push(result)
+			return true
+		}
+
+		if vm.framesIndex == 1 {
+			return false
+		}
+
+		// 呼び出し元のフレームに戻り、呼び出した関数の名前を積む
+		returned := vm.popFrame()
+		vm.sp = returned.basePointer - 1
+		if returned.tailCall != "" {
+			err.Stack = append(err.Stack, returned.tailCall)
+		}
+		frame = vm.currentFrame()
+		err.Stack = append(err.Stack, frame.cl.Fn.CallNames[frame.op])
+	}
+}
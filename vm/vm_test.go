@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"context"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+func run(t *testing.T, input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(c.Bytecode()).Run()
+}
+
+func runWithConfig(t *testing.T, input string, config object.Config) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(c.Bytecode())
+	machine.SetConfig(config)
+	return machine.Run()
+}
+
+func eval(t *testing.T, input string) object.Object {
+	p := parser.New(lexer.New(input))
+	return evaluator.Eval(p.ParseProgram(), object.NewEnvironment())
+}
+
+func TestMatchesEvaluator(t *testing.T) {
+	tests := []string{
+		// 演算
+		"1 + 2 * 3 - 4 / 2",
+		"-5 + 10 == 5",
+		"!(1 < 2) != true",
+		`"foo" + "bar"`,
+		`"ab" * 3`,
+		"[1, 2] + [3]",
+		"2 in [1, 2, 3]",
+		"typeof 1",
+		"null ?? 5",
+		"3 ?? undefinedName",
+		"9223372036854775807 + 1",
+
+		// 変数と条件分岐
+		"let x = 5; let y = x * 2; x + y",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (false) { 10 }",
+		"let a = 1; if (true) { let a = 2; }; a",
+		"const c = 3; c * c",
+
+		// 配列・ハッシュ
+		"[1, 2 * 2, 3 + 3][1]",
+		`{"a": 1, "b": 2}["b"]`,
+		`let h = {"name": "monkey"}; h.name`,
+		"[1, 2, 3].length()",
+		"[][0]",
+
+		// 関数とクロージャ
+		"let add = fn(a, b) { a + b }; add(1, 2)",
+		"let f = fn() { return 1; 2 }; f()",
+		"let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)",
+		"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)",
+		"fn counter(n) { if (n == 0) { return 0; } counter(n - 1) } counter(10)",
+		"let f = fn() { g() }; let g = fn() { 42 }; f()",
+		"let wrapper = fn() { let inner = fn(n) { if (n == 0) { 0 } else { inner(n - 1) } }; inner(5) }; wrapper()",
+		"let sum = fn(...xs) { reduce(xs, 0, fn(acc, x) { acc + x }) }; sum(1, 2, 3)",
+		"fn(x) { x * 2 }",
+
+		// 末尾呼び出しはフレームを積まない
+		"let loop = fn(n, acc) { if (n == 0) { return acc; } loop(n - 1, acc + n) }; loop(5000, 0)",
+		"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(5001)",
+		"let a = fn() { b() }; let b = fn() { c() }; let c = fn() { 1 + true }; let f = fn() { let x = a(); x }; f()",
+
+		// 組み込み関数とコールバック
+		`len("hello")`,
+		"map([1, 2, 3], fn(x) { x * 10 })",
+		"filter([1, 2, 3, 4], fn(x) { x > 2 })",
+		"let len = fn(x) { 0 }; len([1])",
+		"isError(1 + true)",
+		"isError(len(1))",
+
+		// トップレベルのreturn
+		"return 10; 20",
+
+		// エラー
+		"1 + true",
+		"let f = fn() { 1 + true }; f()",
+		"let outer = fn() { inner() }; let inner = fn() { -true }; outer()",
+		"map([1], fn(x) { x + true })",
+		"undefinedName",
+		`{[1]: 2}`,
+		"let f = fn(x) { 10 / x }; f(0)",
+		"fn(x, y) { x + y }(1)",
+		"let f = fn(a) { a }; f(1, 2)",
+		"let f = fn(a) { a }; let g = fn() { f(1, 2) }; g()",
+		"let f = fn(x, y) { x }; let g = fn() { f(1) }; g()",
+	}
+
+	for _, input := range tests {
+		expected := eval(t, input)
+		got := run(t, input)
+		if got == nil || expected == nil {
+			if got != expected {
+				t.Errorf("%q: want=%v, got=%v", input, expected, got)
+			}
+			continue
+		}
+		if got.Type() != expected.Type() || got.Inspect() != expected.Inspect() {
+			t.Errorf("%q: want=%s (%s), got=%s (%s)", input, expected.Inspect(), expected.Type(), got.Inspect(), got.Type())
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []string{
+		"let f = fn(n) { 1 + f(n + 1) }; f(0)",
+		// 組み込み関数のコールバックを介した再帰
+		"let g = fn(x) { map([x], g) }; g(1)",
+	}
+
+	for _, input := range tests {
+		err, ok := run(t, input).(*object.Error)
+		if !ok || err.Message != "stack overflow" {
+			t.Errorf("%q: expected stack overflow error. got=%v", input, err)
+		}
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	config := object.Config{MaxSteps: 1000}
+
+	if result := runWithConfig(t, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)", config); result.Inspect() != "0" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	err, ok := runWithConfig(t, "let loop = fn() { loop() }; loop()", config).(*object.Error)
+	if !ok || err.Message != "step limit exceeded: 1000" {
+		t.Errorf("expected step limit error. got=%v", err)
+	}
+}
+
+func TestMaxAllocation(t *testing.T) {
+	config := object.Config{MaxAllocation: 1 << 16}
+
+	if result := runWithConfig(t, `len("ab" * 100)`, config); result.Inspect() != "200" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	inputs := []string{
+		`"ab" * 1000000000000`,
+		`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(arr + [n], n - 1) } }; grow([], 1000)`,
+		`let grow = fn(arr, n) { if (n == 0) { arr } else { grow(push(arr, n), n - 1) } }; grow([], 1000)`,
+	}
+	for _, input := range inputs {
+		err, ok := runWithConfig(t, input, config).(*object.Error)
+		if !ok || err.Message != "allocation limit exceeded: 65536" {
+			t.Errorf("expected allocation limit error for %q. got=%v", input, err)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []string{
+		"let loop = fn() { loop() }; loop()",
+		// 組み込み関数のコールバックの中の繰り返しと、エラーを受け取る組み込み関数
+		"let loop = fn(x) { loop(x + 1) }; map([1], fn(x) { isError(loop(x)) })",
+	}
+
+	for _, input := range tests {
+		c := compiler.New()
+		if err := c.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(c.Bytecode())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		result := machine.RunContext(ctx)
+		cancel()
+
+		err, ok := result.(*object.Error)
+		if !ok || !strings.HasPrefix(err.Message, "evaluation canceled: context deadline exceeded") {
+			t.Errorf("%q: expected cancellation error. got=%s", input, result.Inspect())
+		}
+
+		// 実行が終われば、セットする前のコンテキストに戻す
+		if machine.env.Context() != nil || machine.done != nil {
+			t.Errorf("%q: context was not restored", input)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	c := compiler.New()
+	if err := c.Compile(parser.New(lexer.New(`let f = fn() { exec("true") }; [len([1]), f()]`)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(c.Bytecode())
+	machine.SetPolicy(&object.Policy{})
+
+	err, ok := machine.Run().(*object.Error)
+	if !ok || err.Message != "process execution is disabled: exec" {
+		t.Errorf("expected policy error. got=%v", err)
+	}
+}